@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"path"
 	"strings"
 
 	"protiumx.dev/simia/token"
@@ -10,6 +11,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	// Pos is the position of the token that starts the node, or of its operator
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -33,6 +36,10 @@ func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -48,6 +55,10 @@ func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
 
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
@@ -63,6 +74,10 @@ func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
 
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
@@ -78,6 +93,10 @@ func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
 
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+
 func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
@@ -86,6 +105,8 @@ type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
 	Value Expression
+	// Exported bindings of a module are visible to the programs that import it
+	Exported bool
 }
 
 func (ls *LetStatement) statementNode() {}
@@ -94,8 +115,15 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
 func (ls *LetStatement) String() string {
 	var out strings.Builder
+	if ls.Exported {
+		out.WriteString("export ")
+	}
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
 	out.WriteString(" = ")
@@ -107,6 +135,35 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// ImportStatement binds the exports of a module, e.g. `import "lib/strings" as str`
+type ImportStatement struct {
+	Token token.Token
+	Path  string
+	// Name is the last element of the path unless the import uses `as`
+	Name *Identifier
+}
+
+func (is *ImportStatement) statementNode() {}
+
+func (is *ImportStatement) TokenLiteral() string {
+	return is.Token.Literal
+}
+
+func (is *ImportStatement) Pos() token.Position {
+	return is.Token.Pos
+}
+
+func (is *ImportStatement) String() string {
+	var out strings.Builder
+	out.WriteString(is.TokenLiteral() + " ")
+	out.WriteString(`"` + is.Path + `"`)
+	if is.Name.Value != path.Base(is.Path) {
+		out.WriteString(" as " + is.Name.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
@@ -118,6 +175,10 @@ func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
 
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
+
 func (rs *ReturnStatement) String() string {
 	var out strings.Builder
 	out.WriteString(rs.TokenLiteral() + " ")
@@ -131,6 +192,8 @@ func (rs *ReturnStatement) String() string {
 type BlockStatment struct {
 	Token      token.Token
 	Statements []Statement
+	// End is the position of the closing brace
+	End token.Position
 }
 
 func (bs *BlockStatment) statementNode() {}
@@ -138,6 +201,10 @@ func (bs *BlockStatment) TokenLiteral() string {
 	return bs.Token.Literal
 }
 
+func (bs *BlockStatment) Pos() token.Position {
+	return bs.Token.Pos
+}
+
 func (bs *BlockStatment) String() string {
 	var out strings.Builder
 	for _, s := range bs.Statements {
@@ -158,6 +225,10 @@ func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
 func (ie *IfExpression) String() string {
 	var out strings.Builder
 	out.WriteString("if")
@@ -184,6 +255,10 @@ func (fe *ForExpression) TokenLiteral() string {
 	return fe.Token.Literal
 }
 
+func (fe *ForExpression) Pos() token.Position {
+	return fe.Token.Pos
+}
+
 func (fe *ForExpression) String() string {
 	var out strings.Builder
 	out.WriteString("for (")
@@ -208,6 +283,10 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
 func (fl *FunctionLiteral) String() string {
 	var out strings.Builder
 	params := make([]string, len(fl.Parameters))
@@ -230,6 +309,8 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	// End is the position of the closing parenthesis
+	End token.Position
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -238,6 +319,10 @@ func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
 
+func (ce *CallExpression) Pos() token.Position {
+	return ce.Token.Pos
+}
+
 func (ce *CallExpression) String() string {
 	var out strings.Builder
 	args := make([]string, len(ce.Arguments))
@@ -264,6 +349,10 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -283,6 +372,10 @@ func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
 
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
 func (pe *PrefixExpression) String() string {
 	var out strings.Builder
 	out.WriteString("(")
@@ -304,6 +397,8 @@ func (oe *InfixExpression) expressionNode() {}
 
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
 
+func (oe *InfixExpression) Pos() token.Position { return oe.Token.Pos }
+
 func (oe *InfixExpression) String() string {
 	var out strings.Builder
 	out.WriteString("(")
@@ -330,6 +425,13 @@ func (p *Program) TokenLiteral() string {
 	return p.Statements[0].TokenLiteral()
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) == 0 {
+		return token.Position{}
+	}
+	return p.Statements[0].Pos()
+}
+
 func (p *Program) String() string {
 	var out strings.Builder
 	for _, s := range p.Statements {
@@ -341,6 +443,8 @@ func (p *Program) String() string {
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	// End is the position of the closing bracket
+	End token.Position
 }
 
 func (al *ArrayLiteral) expressionNode() {}
@@ -349,6 +453,10 @@ func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
 
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+
 func (al *ArrayLiteral) String() string {
 	var out strings.Builder
 	elements := make([]string, len(al.Elements))
@@ -375,6 +483,10 @@ func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *IndexExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
 func (ie *IndexExpression) String() string {
 	var out strings.Builder
 
@@ -390,6 +502,8 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	// End is the position of the closing brace
+	End token.Position
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -398,6 +512,10 @@ func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
 
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+
 func (hl *HashLiteral) String() string {
 	var out strings.Builder
 
@@ -427,6 +545,10 @@ func (ie *InExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+func (ie *InExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
 func (ie *InExpression) String() string {
 	var out strings.Builder
 	out.WriteString("(")
@@ -449,6 +571,10 @@ func (ae *AssignExpression) TokenLiteral() string {
 	return ae.Token.Literal
 }
 
+func (ae *AssignExpression) Pos() token.Position {
+	return ae.Token.Pos
+}
+
 func (ae *AssignExpression) String() string {
 	var out strings.Builder
 	out.WriteString(ae.Identifier.String())
@@ -26,3 +26,51 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestTree(t *testing.T) {
+	ident := func(name string, line, column int) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Pos: token.Position{Line: line, Column: column}}, Value: name}
+	}
+
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Pos: token.Position{Line: 1, Column: 1}},
+				Name:  ident("f", 1, 5),
+				Value: &FunctionLiteral{
+					Token:      token.Token{Type: token.FUNCTION, Literal: "fn", Pos: token.Position{Line: 1, Column: 9}},
+					Parameters: []*Identifier{ident("x", 1, 12)},
+					Body: &BlockStatment{
+						Token: token.Token{Type: token.LBRACE, Literal: "{", Pos: token.Position{Line: 1, Column: 15}},
+						Statements: []Statement{
+							&ExpressionStatement{
+								Token: token.Token{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 1, Column: 17}},
+								Expression: &InfixExpression{
+									Token:    token.Token{Type: token.PLUS, Literal: "+", Pos: token.Position{Line: 1, Column: 19}},
+									Left:     ident("x", 1, 17),
+									Operator: "+",
+									Right:    &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1", Pos: token.Position{Line: 1, Column: 21}}, Value: 1},
+								},
+							},
+						},
+					},
+					Name: "f",
+				},
+			},
+			(*ReturnStatement)(nil),
+		},
+	}
+
+	expected := `Program
+  LetStatement f 1:1
+    FunctionLiteral f(x) 1:9
+      BlockStatement 1:15
+        ExpressionStatement 1:17
+          InfixExpression + 1:19
+            Identifier x 1:17
+            IntegerLiteral 1 1:21
+`
+	if got := Tree(program); got != expected {
+		t.Errorf("wrong tree.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -0,0 +1,150 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tree describes the node and its children, one node per line indented by depth,
+// with the position of each node, e.g.
+//
+//	Program
+//	  LetStatement x 1:1
+//	    IntegerLiteral 1 1:9
+func Tree(node Node) string {
+	var out strings.Builder
+	writeTree(&out, node, 0)
+	return out.String()
+}
+
+func writeTree(out *strings.Builder, node Node, depth int) {
+	label, children := describe(node)
+	out.WriteString(strings.Repeat("  ", depth))
+	out.WriteString(label)
+	if pos := node.Pos(); pos.Line != 0 {
+		if _, ok := node.(*Program); !ok {
+			fmt.Fprintf(out, " %s", pos)
+		}
+	}
+	out.WriteString("\n")
+
+	for _, child := range children {
+		// nodes that failed to parse are nil
+		if child != nil && !isNil(child) {
+			writeTree(out, child, depth+1)
+		}
+	}
+}
+
+// describe returns the line of a node and its children
+func describe(node Node) (string, []Node) {
+	switch node := node.(type) {
+	case *Program:
+		return "Program", statements(node.Statements)
+	case *LetStatement:
+		label := "LetStatement " + node.Name.Value
+		if node.Exported {
+			label = "export " + label
+		}
+		return label, []Node{node.Value}
+	case *ImportStatement:
+		return fmt.Sprintf("ImportStatement %q as %s", node.Path, node.Name.Value), nil
+	case *ReturnStatement:
+		return "ReturnStatement", []Node{node.ReturnValue}
+	case *ExpressionStatement:
+		return "ExpressionStatement", []Node{node.Expression}
+	case *BlockStatment:
+		return "BlockStatement", statements(node.Statements)
+	case *Identifier:
+		return "Identifier " + node.Value, nil
+	case *IntegerLiteral:
+		return fmt.Sprintf("IntegerLiteral %d", node.Value), nil
+	case *Boolean:
+		return fmt.Sprintf("Boolean %t", node.Value), nil
+	case *StringLiteral:
+		return fmt.Sprintf("StringLiteral %q", node.Value), nil
+	case *PrefixExpression:
+		return "PrefixExpression " + node.Operator, []Node{node.Right}
+	case *InfixExpression:
+		return "InfixExpression " + node.Operator, []Node{node.Left, node.Right}
+	case *InExpression:
+		return "InExpression", []Node{node.Element, node.Iterable}
+	case *AssignExpression:
+		return "AssignExpression " + node.Identifier.Value, []Node{node.Value}
+	case *IfExpression:
+		children := []Node{node.Condition, node.Consequence}
+		if node.Alternative != nil {
+			children = append(children, node.Alternative)
+		}
+		return "IfExpression", children
+	case *ForExpression:
+		return "ForExpression", []Node{node.Condition, node.Body}
+	case *FunctionLiteral:
+		params := make([]string, len(node.Parameters))
+		for i, p := range node.Parameters {
+			params[i] = p.Value
+		}
+		label := fmt.Sprintf("FunctionLiteral(%s)", strings.Join(params, ", "))
+		if node.Name != "" {
+			label = fmt.Sprintf("FunctionLiteral %s(%s)", node.Name, strings.Join(params, ", "))
+		}
+		return label, []Node{node.Body}
+	case *CallExpression:
+		return "CallExpression", append([]Node{node.Function}, expressions(node.Arguments)...)
+	case *IndexExpression:
+		return "IndexExpression", []Node{node.Left, node.Index}
+	case *ArrayLiteral:
+		return "ArrayLiteral", expressions(node.Elements)
+	case *HashLiteral:
+		keys := make([]Expression, 0, len(node.Pairs))
+		for key := range node.Pairs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := keys[i].Pos(), keys[j].Pos()
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+
+		children := []Node{}
+		for _, key := range keys {
+			children = append(children, key, node.Pairs[key])
+		}
+		return "HashLiteral", children
+	default:
+		return fmt.Sprintf("%T", node), nil
+	}
+}
+
+func statements(stmts []Statement) []Node {
+	nodes := make([]Node, len(stmts))
+	for i, s := range stmts {
+		nodes[i] = s
+	}
+	return nodes
+}
+
+func expressions(exprs []Expression) []Node {
+	nodes := make([]Node, len(exprs))
+	for i, e := range exprs {
+		nodes[i] = e
+	}
+	return nodes
+}
+
+// isNil reports whether node is a nil pointer of a node type
+func isNil(node Node) bool {
+	switch node := node.(type) {
+	case *LetStatement:
+		return node == nil
+	case *ImportStatement:
+		return node == nil
+	case *ReturnStatement:
+		return node == nil
+	case *ExpressionStatement:
+		return node == nil
+	case *BlockStatment:
+		return node == nil
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/disasm"
+	"protiumx.dev/simia/lint"
+	"protiumx.dev/simia/lsp"
+	"protiumx.dev/simia/prelude"
+	"protiumx.dev/simia/repl"
+)
+
+// historyFile keeps the REPL inputs, in the home directory
+const historyFile = ".simia_history"
+
+func (c *cli) repl(args []string) error {
+	fs := c.flags("repl")
+	engine := fs.String("engine", engineVM, "execution engine, vm or eval")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *engine != engineVM && *engine != engineEval {
+		return &usageError{fmt.Sprintf("unknown engine %q", *engine)}
+	}
+
+	opts := []repl.Option{repl.WithEngine(*engine)}
+	if home, err := os.UserHomeDir(); err == nil {
+		opts = append(opts, repl.WithHistory(filepath.Join(home, historyFile)))
+	}
+
+	fmt.Fprintf(c.stdout, "simia %s\n", Version)
+	repl.Start(c.stdin, c.stdout, opts...)
+	return nil
+}
+
+func (c *cli) check(args []string) error {
+	fs := c.flags("check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return &usageError{"missing script files"}
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		if _, err := c.compileFile(path); err != nil {
+			if err != errScript {
+				fmt.Fprintln(c.stderr, err)
+			}
+			failed = true
+		}
+	}
+
+	if failed {
+		return errScript
+	}
+
+	return nil
+}
+
+func (c *cli) lint(args []string) error {
+	fs := c.flags("lint")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return &usageError{"missing script files"}
+	}
+
+	paths, err := sourceFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, path := range paths {
+		program, comments, err := c.parseFile(path)
+		if err != nil {
+			if err != errScript {
+				return err
+			}
+			failed = true
+			continue
+		}
+
+		for _, d := range lint.Program(program, comments, lint.Options{Globals: []string{argsGlobal}}) {
+			fmt.Fprintf(c.stdout, "%s:%s\n", path, d)
+			failed = true
+		}
+	}
+
+	if failed {
+		return errScript
+	}
+
+	return nil
+}
+
+func (c *cli) lsp(args []string) error {
+	fs := c.flags("lsp")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return lsp.Serve(c.stdin, c.stdout, lsp.Options{Globals: []string{argsGlobal}})
+}
+
+func (c *cli) disasm(args []string) error {
+	fs := c.flags("disasm")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return &usageError{"expected one script file"}
+	}
+
+	path := fs.Arg(0)
+	bytecode, _, err := c.loadBytecode(path)
+	if err != nil {
+		return err
+	}
+
+	opts := disasm.Options{Exclude: []string{prelude.File}}
+	prefix := prelude.Bytecode().Instructions
+	switch {
+	case filepath.Ext(path) != compiler.FileExt:
+		if opts.Source, err = readSource(path); err != nil {
+			return err
+		}
+	case bytes.HasPrefix(bytecode.Instructions, prefix):
+		// compiled files define the prelude globals first, see prelude.Standalone
+		opts.FirstInstruction = len(prefix)
+	}
+
+	return disasm.Disassemble(c.stdout, bytecode, opts)
+}
+
+func (c *cli) compile(args []string) error {
+	fs := c.flags("compile")
+	output := fs.String("o", "", "output file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return &usageError{"expected one script file"}
+	}
+
+	path := fs.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + compiler.FileExt
+	}
+
+	bytecode, err := c.compileFile(path)
+	if err != nil {
+		return err
+	}
+
+	// the file includes the prelude, which may differ from the one that runs it
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, prelude.Standalone(bytecode)); err != nil {
+		return err
+	}
+
+	return os.WriteFile(*output, buf.Bytes(), 0o644)
+}
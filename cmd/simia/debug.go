@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/debugger"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/prelude"
+	"protiumx.dev/simia/value"
+	"protiumx.dev/simia/vm"
+)
+
+// debug runs a script on the VM and reads debugger commands from stdin, so the script
+// gets every permission but stdin
+func (c *cli) debug(args []string) error {
+	fs := c.flags("debug")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return &usageError{"missing script file"}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	path := fs.Arg(0)
+	bytecode, opts, err := c.loadBytecode(path)
+	if err != nil {
+		return err
+	}
+
+	// bytecode files are debugged without their source lines
+	source := ""
+	if filepath.Ext(path) != compiler.FileExt {
+		if source, err = readSource(path); err != nil {
+			return err
+		}
+	}
+
+	d := debugger.New(bytecode, c.stdin, c.stdout, debugger.Options{
+		Path:      path,
+		Source:    source,
+		Resolver:  module.NewDirResolver(filepath.Dir(path)),
+		Libraries: []string{prelude.File},
+		Hidden:    prelude.Names(),
+	})
+
+	machine := vm.New(bytecode, append(opts,
+		vm.WithPermissions(value.PermAll&^value.PermStdin),
+		vm.WithFatalErrors(),
+		vm.WithStdout(c.stdout),
+		vm.WithStderr(c.stderr),
+		vm.WithLineHook(d.Hook),
+	)...)
+	machine.SetGlobal(argsGlobal, scriptArguments(fs.Args()[1:]))
+
+	err = machine.RunContext(ctx)
+	if errors.Is(err, debugger.ErrQuit) {
+		return nil
+	}
+	if err != nil {
+		return c.scriptFailed(path, err.Error())
+	}
+
+	return c.checkResult(path, machine.LastPoppedStackElement())
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"protiumx.dev/simia/format"
+)
+
+// sourceExt is the extension of the scripts found in directories
+const sourceExt = ".sm"
+
+func (c *cli) fmt(args []string) error {
+	flags := c.flags("fmt")
+	check := flags.Bool("check", false, "list the files that are not formatted and fail if there are any")
+	write := flags.Bool("w", false, "write the result to the files instead of printing it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		return &usageError{"missing script files"}
+	}
+
+	if *check && *write {
+		return &usageError{"-check and -w cannot be used together"}
+	}
+
+	paths, err := sourceFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		src := string(data)
+		out, err := formatSource(src)
+		var parseErr *format.ParseError
+		if errors.As(err, &parseErr) {
+			for _, msg := range parseErr.Errors {
+				fmt.Fprintf(c.stderr, "%s: %s\n", path, msg)
+			}
+			failed = true
+			continue
+		}
+
+		switch {
+		case *check:
+			if out != src {
+				fmt.Fprintln(c.stdout, path)
+				failed = true
+			}
+		case *write:
+			if out != src {
+				if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+					return err
+				}
+			}
+		default:
+			fmt.Fprint(c.stdout, out)
+		}
+	}
+
+	if failed {
+		return errScript
+	}
+
+	return nil
+}
+
+// formatSource formats a script and keeps its shebang line
+func formatSource(src string) (string, error) {
+	shebang := ""
+	if strings.HasPrefix(src, "#!") {
+		end := strings.IndexByte(src, '\n') + 1
+		if end == 0 {
+			return src + "\n", nil
+		}
+		shebang, src = src[:end], src[end:]
+	}
+
+	out, err := format.Source(src)
+	return shebang + out, err
+}
+
+// sourceFiles replaces the directories with the scripts they contain
+func sourceFiles(args []string) ([]string, error) {
+	paths := []string{}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && filepath.Ext(path) == sourceExt {
+				paths = append(paths, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
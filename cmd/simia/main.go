@@ -0,0 +1,270 @@
+// Command simia runs, checks and inspects simia scripts
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/prelude"
+	"protiumx.dev/simia/token"
+	"protiumx.dev/simia/vm"
+)
+
+var Version = ""
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// cli holds the streams used by the commands, so they can be replaced in tests
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	usage   string
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+// commands is set in init because the commands read it to print their usage
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"run": {
+			usage:   "run [-engine vm|eval] <file|file.smc> [args...]",
+			summary: "run a script, args are available in the `args` global",
+			run:     (*cli).run,
+		},
+		"repl": {
+			usage:   "repl [-engine vm|eval]",
+			summary: "start an interactive session",
+			run:     (*cli).repl,
+		},
+		"check": {
+			usage:   "check <file>...",
+			summary: "report parse and compilation errors without running",
+			run:     (*cli).check,
+		},
+		"compile": {
+			usage:   "compile [-o output] <file>",
+			summary: "compile a script to a bytecode file, by default <file>.smc",
+			run:     (*cli).compile,
+		},
+		"fmt": {
+			usage:   "fmt [-check] [-w] <file|dir>...",
+			summary: "format scripts, directories include their .sm files",
+			run:     (*cli).fmt,
+		},
+		"lint": {
+			usage:   "lint <file|dir>...",
+			summary: "report unused bindings, shadowed names and other likely mistakes",
+			run:     (*cli).lint,
+		},
+		"lsp": {
+			usage:   "lsp",
+			summary: "start a language server on stdin and stdout",
+			run:     (*cli).lsp,
+		},
+		"test": {
+			usage:   "test [-format text|tap|junit] [-run substring] [file|dir...]",
+			summary: "run the test_ functions of the *_test.sm files, by default in the current directory",
+			run:     (*cli).test,
+		},
+		"debug": {
+			usage:   "debug <file|file.smc> [args...]",
+			summary: "run a script in the debugger, stopping at its first line",
+			run:     (*cli).debug,
+		},
+		"disasm": {
+			usage:   "disasm <file|file.smc>",
+			summary: "print the bytecode of a script",
+			run:     (*cli).disasm,
+		},
+		"version": {
+			usage:   "version",
+			summary: "print the version",
+			run:     (*cli).version,
+		},
+	}
+}
+
+// usageError is reported with the usage of the command and exit code 2
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// errScript is returned when a script fails after its errors were printed
+var errScript = errors.New("script failed")
+
+func main() {
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	os.Exit(c.main(os.Args[1:]))
+}
+
+func (c *cli) main(args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return exitUsage
+	}
+
+	name, cmd := args[0], commands[args[0]]
+	if cmd == nil {
+		// `simia script.sm` runs the script, which allows `#!/usr/bin/env simia`
+		if _, err := os.Stat(name); err != nil {
+			fmt.Fprintf(c.stderr, "simia: unknown command %q\n", name)
+			c.usage()
+			return exitUsage
+		}
+		name, cmd = "run", commands["run"]
+	} else {
+		args = args[1:]
+	}
+
+	err := cmd.run(c, args)
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitUsage
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(c.stderr, "simia %s: %s\nusage: simia %s\n", name, err, cmd.usage)
+		return exitUsage
+	case errors.Is(err, errScript):
+		return exitError
+	default:
+		fmt.Fprintf(c.stderr, "simia %s: %s\n", name, err)
+		return exitError
+	}
+}
+
+func (c *cli) usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(c.stderr, "usage: simia <command> [arguments]\n\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(c.stderr, "  %-40s %s\n", commands[name].usage, commands[name].summary)
+	}
+}
+
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: simia %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func (c *cli) version(args []string) error {
+	fmt.Fprintf(c.stdout, "simia %s\n", Version)
+	return nil
+}
+
+// readSource reads a script. A shebang line is blanked so line numbers are kept
+func readSource(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	src := string(data)
+	if strings.HasPrefix(src, "#!") {
+		if end := strings.IndexByte(src, '\n'); end >= 0 {
+			src = src[end:]
+		} else {
+			src = ""
+		}
+	}
+
+	return src, nil
+}
+
+// parseFile reads and parses a script and returns its comments. Parse errors are
+// printed prefixed with the path
+func (c *cli) parseFile(path string) (*ast.Program, []token.Token, error) {
+	src, err := readSource(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(c.stderr, "%s: %s\n", path, msg)
+		}
+		return nil, nil, errScript
+	}
+
+	return program, l.Comments(), nil
+}
+
+// compileFile compiles a script with the prelude and the `args` global. Imports are
+// resolved relative to the script directory
+func (c *cli) compileFile(path string) (*compiler.Bytecode, error) {
+	program, _, err := c.parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := prelude.SymbolTable()
+	symbols.Define(argsGlobal)
+
+	resolver := module.NewDirResolver(filepath.Dir(path))
+	comp := compiler.NewWithState(symbols, prelude.Constants(), compiler.WithResolver(resolver))
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(c.stderr, "%s: compilation error: %s\n", path, err)
+		return nil, errScript
+	}
+
+	return comp.Bytecode(), nil
+}
+
+// loadBytecode compiles a script or reads a bytecode file. opts set up the VM globals
+func (c *cli) loadBytecode(path string) (*compiler.Bytecode, []vm.Option, error) {
+	if filepath.Ext(path) != compiler.FileExt {
+		bytecode, err := c.compileFile(path)
+		return bytecode, []vm.Option{vm.WithInitialGlobals(prelude.Globals())}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	bytecode, err := compiler.Decode(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return bytecode, nil, nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeScript(t *testing.T, dir, name, src string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdin: strings.NewReader(""), stdout: &stdout, stderr: &stderr}
+	code := c.main(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "util.sm", `export let double = fn(x) { x * 2 };`)
+	script := writeScript(t, dir, "main.sm", "#!/usr/bin/env simia\n"+
+		`import "util"; log(len(args), args[0], util["double"](sum([1, 2])));`)
+	failing := writeScript(t, dir, "fail.sm", "let x = 1;\nlen(x)")
+	broken := writeScript(t, dir, "broken.sm", "let = 1;")
+	// the error is not the value of the script
+	dropped := writeScript(t, dir, "dropped.sm", "len(1);\nlog(\"after\")")
+	recursive := writeScript(t, dir, "recursive.sm", "let f = fn() { f() };\nf()")
+	// the compiler does not support assignments in loops yet, the VM panics on them
+	panicking := writeScript(t, dir, "panic.sm", "let t = 0;\nfor (x in [1, 2]) { t = 1 }")
+
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{"run", script, "a", "-b"}, exitOK, "2\na\n6\n", ""},
+		{[]string{"run", "-engine", "eval", script, "a", "-b"}, exitOK, "2\na\n6\n", ""},
+		{[]string{script, "x"}, exitOK, "1\nx\n6\n", ""},
+		{[]string{"run", failing}, exitError, "", failing + ": runtime error: argument to `len` must be STRING or ARRAY or HASH, got INTEGER\n"},
+		{[]string{"run", "-engine", "eval", failing}, exitError, "", failing + ": runtime error: argument to `len` must be STRING or ARRAY or HASH, got INTEGER\n"},
+		{[]string{"run", dropped}, exitError, "", dropped + ": runtime error: argument to `len` must be STRING or ARRAY or HASH, got INTEGER\n"},
+		{[]string{"run", "-engine", "eval", dropped}, exitError, "", dropped + ": runtime error: argument to `len` must be STRING or ARRAY or HASH, got INTEGER\n"},
+		{[]string{"run", recursive}, exitError, "", recursive + ": runtime error: call depth limit of 1023 exceeded\n"},
+		{[]string{"run", "-engine", "eval", recursive}, exitError, "", recursive + ": runtime error: call depth limit of 1023 exceeded\n"},
+		{[]string{"run", panicking}, exitError, "", panicking + ": runtime error: index out of range [-1]\n"},
+		{[]string{"run", broken}, exitError, "", broken + ": expected next token to be IDENT, got =\n" + broken + ": no prefix parse function for = found\n"},
+		{[]string{"run", "-engine", "js", script}, exitUsage, "", "simia run: unknown engine \"js\"\nusage: simia run [-engine vm|eval] <file|file.smc> [args...]\n"},
+		{[]string{"run"}, exitUsage, "", "simia run: missing script file\nusage: simia run [-engine vm|eval] <file|file.smc> [args...]\n"},
+		{[]string{"repl", "-engine", "eval"}, exitOK, "simia \n>> ", ""},
+		{[]string{"repl", "-engine", "js"}, exitUsage, "", "simia repl: unknown engine \"js\"\nusage: simia repl [-engine vm|eval]\n"},
+		{[]string{"check", script, failing}, exitOK, "", ""},
+		{[]string{"check", broken}, exitError, "", broken + ": expected next token to be IDENT, got =\n" + broken + ": no prefix parse function for = found\n"},
+	}
+
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(tt.args...)
+		if code != tt.code || stdout != tt.stdout || stderr != tt.stderr {
+			t.Errorf("simia %v: expected (%d, %q, %q), got (%d, %q, %q)",
+				tt.args, tt.code, tt.stdout, tt.stderr, code, stdout, stderr)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	code, _, stderr := runCLI("frobnicate")
+	if code != exitUsage {
+		t.Errorf("expected exit code %d, got %d", exitUsage, code)
+	}
+
+	if !strings.HasPrefix(stderr, "simia: unknown command \"frobnicate\"\nusage: simia <command>") {
+		t.Errorf("unexpected usage output %q", stderr)
+	}
+}
+
+func TestDisasm(t *testing.T) {
+	script := writeScript(t, t.TempDir(), "main.sm", "1 + 2")
+	code, stdout, _ := runCLI("disasm", script)
+	if code != exitOK {
+		t.Fatalf("expected exit code %d, got %d", exitOK, code)
+	}
+
+	if !strings.HasPrefix(stdout, "main:\n   1 | 1 + 2\n") || !strings.Contains(stdout, "OpAdd") {
+		t.Errorf("expected the source line and OpAdd in the output, got %q", stdout)
+	}
+
+	if strings.Contains(stdout, "fn#") {
+		t.Errorf("expected no prelude functions in the output, got %q", stdout)
+	}
+
+	if code, _, stderr := runCLI("compile", script); code != exitOK {
+		t.Fatalf("compile failed with %d: %s", code, stderr)
+	}
+
+	// the prelude definitions at the start of a compiled file are skipped too
+	code, stdout, _ = runCLI("disasm", strings.TrimSuffix(script, ".sm")+".smc")
+	if code != exitOK || !strings.HasPrefix(stdout, "main:\n   1 |\n") || strings.Contains(stdout, "identity") {
+		t.Errorf("expected only the script instructions, got (%d, %q)", code, stdout)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "util.sm", `export let double = fn(x) { x * 2 };`)
+	script := writeScript(t, dir, "main.sm", `import "util"; log(args[0], util["double"](sum([1, 2])));`)
+
+	if code, _, stderr := runCLI("compile", script); code != exitOK {
+		t.Fatalf("compile failed with %d: %s", code, stderr)
+	}
+
+	compiled := filepath.Join(dir, "main.smc")
+	code, stdout, stderr := runCLI("run", compiled, "bin")
+	if code != exitOK || stdout != "bin\n6\n" {
+		t.Fatalf("expected bin and 6, got (%d, %q, %q)", code, stdout, stderr)
+	}
+
+	out := filepath.Join(dir, "out.smc")
+	if code, _, stderr := runCLI("compile", "-o", out, script); code != exitOK {
+		t.Fatalf("compile -o failed with %d: %s", code, stderr)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	tampered := writeScript(t, dir, "tampered.smc", string(data))
+
+	code, _, stderr = runCLI("run", tampered)
+	expected := "simia run: " + tampered + ": corrupted bytecode: checksum mismatch\n"
+	if code != exitError || stderr != expected {
+		t.Errorf("expected (%d, %q), got (%d, %q)", exitError, expected, code, stderr)
+	}
+
+	code, _, stderr = runCLI("run", "-engine", "eval", compiled)
+	if code != exitUsage || !strings.HasPrefix(stderr, "simia run: bytecode files can only be run by the vm engine\n") {
+		t.Errorf("expected usage error, got (%d, %q)", code, stderr)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	dir := t.TempDir()
+	messy := writeScript(t, dir, "messy.sm", "#!/usr/bin/env simia\nlet x=(1+2)*3 // nine\nlog(x)")
+	formatted := "#!/usr/bin/env simia\nlet x = (1 + 2) * 3; // nine\nlog(x);\n"
+	clean := writeScript(t, dir, "clean.sm", "log(1);\n")
+	writeScript(t, dir, "notes.txt", "not a script")
+
+	code, stdout, _ := runCLI("fmt", messy)
+	if code != exitOK || stdout != formatted {
+		t.Errorf("expected formatted output, got (%d, %q)", code, stdout)
+	}
+
+	code, stdout, _ = runCLI("fmt", "-check", dir)
+	if code != exitError || stdout != messy+"\n" {
+		t.Errorf("expected %s to be listed, got (%d, %q)", messy, code, stdout)
+	}
+
+	if code, _, stderr := runCLI("fmt", "-w", dir); code != exitOK {
+		t.Fatalf("fmt -w failed with %d: %s", code, stderr)
+	}
+
+	if data, _ := os.ReadFile(messy); string(data) != formatted {
+		t.Errorf("expected the file to be rewritten, got %q", data)
+	}
+
+	if code, stdout, _ := runCLI("fmt", "--check", messy, clean); code != exitOK || stdout != "" {
+		t.Errorf("expected formatted files to pass the check, got (%d, %q)", code, stdout)
+	}
+
+	broken := writeScript(t, dir, "broken.sm", "let = 1;")
+	code, _, stderr := runCLI("fmt", broken)
+	if code != exitError || !strings.HasPrefix(stderr, broken+": expected next token to be IDENT, got =\n") {
+		t.Errorf("expected parse errors, got (%d, %q)", code, stderr)
+	}
+}
+
+func TestLSP(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	input := `{"jsonrpc":"2.0","id":1,"method":"shutdown"}`
+	exit := `{"jsonrpc":"2.0","method":"exit"}`
+	stdin := fmt.Sprintf("Content-Length: %d\r\n\r\n%sContent-Length: %d\r\n\r\n%s", len(input), input, len(exit), exit)
+
+	c := &cli{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}
+	if code := c.main([]string{"lsp"}); code != exitOK {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr.String())
+	}
+
+	expected := `{"jsonrpc":"2.0","id":1,"result":null}`
+	if !strings.HasSuffix(stdout.String(), "\r\n\r\n"+expected) {
+		t.Errorf("expected the shutdown response, got %q", stdout.String())
+	}
+}
+
+func TestTest(t *testing.T) {
+	dir := t.TempDir()
+	passing := writeScript(t, dir, "ok_test.sm", "let test_sum = fn() { assert_eq(sum([1, 2]), 3) };")
+	failing := writeScript(t, dir, "fail_test.sm", "let test_len = fn() { assert_eq(len([]), 1) };\nlet test_ok = fn() { assert(true) };")
+	writeScript(t, dir, "helper.sm", "let test_ignored = fn() { assert(false) };")
+
+	code, stdout, _ := runCLI("test", "-format", "tap", "-run", "sum", dir)
+	expected := "TAP version 13\nok 1 - " + passing + ": test_sum # time="
+	if code != exitOK || !strings.HasPrefix(stdout, expected) || !strings.HasSuffix(stdout, "1..1\n") {
+		t.Errorf("expected the passing test, got (%d, %q)", code, stdout)
+	}
+
+	code, stdout, _ = runCLI("test", dir)
+	if code != exitError || !strings.Contains(stdout, "FAIL  "+failing+": test_len") || !strings.Contains(stdout, "2 passed, 1 failed, 0 errors") {
+		t.Errorf("expected a failing test, got (%d, %q)", code, stdout)
+	}
+
+	if code, _, stderr := runCLI("test", "-format", "xml", dir); code != exitUsage || !strings.Contains(stderr, `unknown format "xml"`) {
+		t.Errorf("expected a usage error, got (%d, %q)", code, stderr)
+	}
+}
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	script := writeScript(t, dir, "main.sm", "let x = 1;\nlet len = fn() { 2 }; // lint:ignore shadow\nlog(args, len())")
+	writeScript(t, dir, "clean.sm", "log(1);")
+
+	code, stdout, _ := runCLI("lint", dir)
+	expected := script + ":1:5: x is declared and not used (unused)\n"
+	if code != exitError || stdout != expected {
+		t.Errorf("expected (%d, %q), got (%d, %q)", exitError, expected, code, stdout)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	dir := t.TempDir()
+	script := writeScript(t, dir, "main.sm", "#!/usr/bin/env simia\nlet double = fn(x) {\n  x * 2\n};\nlog(double(len(args)));")
+
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdin: strings.NewReader("b 3\nc\nlocals\nc\n"), stdout: &stdout, stderr: &stderr}
+	if code := c.main([]string{"debug", script, "a"}); code != exitOK {
+		t.Fatalf("unexpected exit code %d: %s", code, stderr.String())
+	}
+
+	expected := "breakpoint at " + script + ":3 in double\n     3 |   x * 2\n(debug)   x = 1\n(debug) 2\n"
+	if !strings.HasSuffix(stdout.String(), expected) {
+		t.Errorf("expected %q at the end of the output, got %q", expected, stdout.String())
+	}
+
+	failing := writeScript(t, dir, "fail.sm", "len(1);\nlog(\"after\")")
+	stdout.Reset()
+	stderr.Reset()
+	c = &cli{stdin: strings.NewReader("c\n"), stdout: &stdout, stderr: &stderr}
+	expected = failing + ": runtime error: argument to `len` must be STRING or ARRAY or HASH, got INTEGER\n"
+	if code := c.main([]string{"debug", failing}); code != exitError || stderr.String() != expected {
+		t.Errorf("expected (%d, %q), got (%d, %q)", exitError, expected, code, stderr.String())
+	}
+
+	if code, _, _ := runCLI("debug", script); code != exitOK {
+		t.Errorf("expected the end of the commands to stop the script, got %d", code)
+	}
+	if code, _, stderr := runCLI("debug"); code != exitUsage || !strings.Contains(stderr, "missing script file") {
+		t.Errorf("expected a usage error, got (%d, %q)", code, stderr)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/evaluator"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/prelude"
+	"protiumx.dev/simia/value"
+	"protiumx.dev/simia/vm"
+)
+
+const (
+	engineVM   = "vm"
+	engineEval = "eval"
+)
+
+// argsGlobal holds the arguments passed to the script after its path
+const argsGlobal = "args"
+
+func (c *cli) run(args []string) error {
+	fs := c.flags("run")
+	engine := fs.String("engine", engineVM, "execution engine, vm or eval")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return &usageError{"missing script file"}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	path, scriptArgs := fs.Arg(0), scriptArguments(fs.Args()[1:])
+	switch *engine {
+	case engineVM:
+		return c.runVM(ctx, path, scriptArgs)
+	case engineEval:
+		return c.runEval(ctx, path, scriptArgs)
+	default:
+		return &usageError{fmt.Sprintf("unknown engine %q", *engine)}
+	}
+}
+
+func (c *cli) runVM(ctx context.Context, path string, args value.Value) (err error) {
+	bytecode, opts, err := c.loadBytecode(path)
+	if err != nil {
+		return err
+	}
+
+	machine := vm.New(bytecode, append(opts,
+		vm.WithPermissions(value.PermAll),
+		vm.WithFatalErrors(),
+		vm.WithStdin(c.stdin),
+		vm.WithStdout(c.stdout),
+		vm.WithStderr(c.stderr),
+	)...)
+	machine.SetGlobal(argsGlobal, args)
+
+	defer c.recoverScript(path, &err)
+	if err := machine.RunContext(ctx); err != nil {
+		return c.scriptFailed(path, err.Error())
+	}
+
+	return c.checkResult(path, machine.LastPoppedStackElement())
+}
+
+func (c *cli) runEval(ctx context.Context, path string, args value.Value) (err error) {
+	if filepath.Ext(path) == compiler.FileExt {
+		return &usageError{"bytecode files can only be run by the vm engine"}
+	}
+
+	program, _, err := c.parseFile(path)
+	if err != nil {
+		return err
+	}
+
+	env := prelude.NewEnvironment()
+	env.Set(argsGlobal, args)
+
+	e := evaluator.New(
+		evaluator.WithPermissions(value.PermAll),
+		evaluator.WithStdin(c.stdin),
+		evaluator.WithStdout(c.stdout),
+		evaluator.WithStderr(c.stderr),
+		evaluator.WithResolver(module.NewDirResolver(filepath.Dir(path))),
+	)
+	defer c.recoverScript(path, &err)
+	result, err := e.EvalContext(ctx, program, env)
+	if err != nil {
+		return c.scriptFailed(path, err.Error())
+	}
+
+	return c.checkResult(path, result)
+}
+
+// checkResult fails when the script evaluated to an error value
+func (c *cli) checkResult(path string, result value.Value) error {
+	if errVal, ok := result.(*value.Error); ok {
+		return c.scriptFailed(path, errVal.Message)
+	}
+
+	return nil
+}
+
+// recoverScript reports a panic of an engine as a runtime error of the script instead
+// of crashing with a goroutine trace
+func (c *cli) recoverScript(path string, err *error) {
+	if r := recover(); r != nil {
+		*err = c.scriptFailed(path, strings.TrimPrefix(fmt.Sprint(r), "runtime error: "))
+	}
+}
+
+func (c *cli) scriptFailed(path, msg string) error {
+	fmt.Fprintf(c.stderr, "%s: runtime error: %s\n", path, msg)
+	return errScript
+}
+
+func scriptArguments(args []string) value.Value {
+	elements := make([]value.Value, len(args))
+	for i, arg := range args {
+		elements[i] = &value.String{Value: arg}
+	}
+
+	return &value.Array{Elements: elements}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"protiumx.dev/simia/testrunner"
+)
+
+// reporters write the test results in the formats of `simia test -format`
+var reporters = map[string]func(io.Writer, []*testrunner.File) error{
+	"text":  testrunner.WriteText,
+	"tap":   testrunner.WriteTAP,
+	"junit": testrunner.WriteJUnit,
+}
+
+func (c *cli) test(args []string) error {
+	fs := c.flags("test")
+	format := fs.String("format", "text", "output format, text, tap or junit")
+	filter := fs.String("run", "", "only run the tests whose name contains substring")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, ok := reporters[*format]
+	if !ok {
+		return &usageError{fmt.Sprintf("unknown format %q", *format)}
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := testrunner.Discover(paths)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results := make([]*testrunner.File, len(files))
+	failed := false
+	for i, path := range files {
+		results[i] = testrunner.Run(ctx, path, *filter)
+		failed = failed || results[i].Failed()
+	}
+
+	if err := report(c.stdout, results); err != nil {
+		return err
+	}
+
+	if failed {
+		return errScript
+	}
+
+	return nil
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"strings"
 	"syscall/js"
 
 	"protiumx.dev/simia/evaluator"
 	"protiumx.dev/simia/lexer"
 	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/prelude"
 	"protiumx.dev/simia/value"
 )
 
@@ -26,18 +28,20 @@ func wrapper(env *value.Environment) js.Func {
 			return errs[len(errs)-1]
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		var output strings.Builder
+		e := evaluator.New(evaluator.WithStdout(&output), evaluator.WithStderr(&output))
+		evaluated := e.Eval(program, env)
 		if evaluated != nil {
-			return evaluated.Inspect()
+			output.WriteString(evaluated.Inspect())
 		}
 
-		return ""
+		return output.String()
 	})
 	return jsonFunc
 }
 
 func main() {
-	env := value.NewEnvironment(nil)
+	env := prelude.NewEnvironment()
 	js.Global().Set("simia", wrapper(env))
 	js.Global().Set("simia_version", js.ValueOf(Version))
 	<-make(chan struct{})
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"sort"
 )
 
 type Instructions []byte
@@ -33,9 +34,16 @@ func (ins Instructions) String() string {
 	for i < len(ins) {
 		def, err := Lookup(ins[i])
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i++
 			continue
 		}
+
+		if i+1+def.Width() > len(ins) {
+			fmt.Fprintf(&out, "%04d ERROR: %s is truncated\n", i, def.Name)
+			break
+		}
+
 		operands, read := ReadOperands(def, ins[i+1:])
 		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstrunction(def, operands))
 		i += 1 + read
@@ -46,6 +54,10 @@ func (ins Instructions) String() string {
 
 type Opcode byte
 
+// Version identifies the opcode set. It must be increased whenever an opcode is added,
+// removed or changes its operands or semantics, so older bytecode files are rejected
+const Version = 1
+
 const (
 	OpConstant Opcode = iota
 	OpPop
@@ -89,6 +101,8 @@ const (
 	OpCurrentClosure
 
 	OpNil
+
+	OpImport
 )
 
 type Definition struct {
@@ -96,6 +110,15 @@ type Definition struct {
 	OperandWidths []int
 }
 
+// Width is the number of bytes taken by the operands
+func (d *Definition) Width() int {
+	width := 0
+	for _, w := range d.OperandWidths {
+		width += w
+	}
+	return width
+}
+
 var definitions = map[Opcode]*Definition{
 	OpConstant:       {"OpConstant", []int{2}}, // Const has size uint16 (2 bytes wide)
 	OpAdd:            {"OpAdd", []int{}},
@@ -127,6 +150,8 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
 	OpGetFree:        {"OpGetFree", []int{1}},
+	// Module function constant and global slot that caches the module exports
+	OpImport: {"OpImport", []int{2, 2}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -191,3 +216,22 @@ func ReadUint16(ins Instructions) uint16 {
 func ReadUint8(ins Instructions) uint8 {
 	return uint8(ins[0])
 }
+
+// LineEntry marks that the instructions from Offset up to the next entry were
+// compiled from Line
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+// LineTable maps instruction offsets to source lines. Entries are sorted by offset
+type LineTable []LineEntry
+
+// Line returns the source line of the instruction at offset, or 0 when it is unknown
+func (t LineTable) Line(offset int) int {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return 0
+	}
+	return t[i-1].Line
+}
@@ -55,6 +55,41 @@ func TestInstructionString(t *testing.T) {
 	}
 }
 
+func TestInvalidInstructionString(t *testing.T) {
+	ins := Instructions{byte(OpAdd), 250, byte(OpPop), byte(OpConstant), 1}
+
+	expected := `0000 OpAdd
+0001 ERROR: opcode 250 undefined
+0002 OpPop
+0003 ERROR: OpConstant is truncated
+`
+
+	if ins.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, ins.String())
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	table := LineTable{{Offset: 0, Line: 2}, {Offset: 4, Line: 3}, {Offset: 10, Line: 7}}
+
+	tests := []struct {
+		offset int
+		line   int
+	}{
+		{0, 2}, {3, 2}, {4, 3}, {9, 3}, {10, 7}, {100, 7},
+	}
+
+	for _, tt := range tests {
+		if line := table.Line(tt.offset); line != tt.line {
+			t.Errorf("offset %d: expected line %d, got %d", tt.offset, tt.line, line)
+		}
+	}
+
+	if line := (LineTable{{Offset: 3, Line: 1}}).Line(0); line != 0 {
+		t.Errorf("expected unknown line, got %d", line)
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
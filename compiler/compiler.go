@@ -1,11 +1,14 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 
 	"protiumx.dev/simia/ast"
 	"protiumx.dev/simia/code"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/token"
 	"protiumx.dev/simia/value"
 )
 
@@ -14,11 +17,55 @@ type Compiler struct {
 	symbolTable *SymbolTable
 	scopes      []Scope
 	scopeIndex  int
+	// globals is the top-level symbol table, where the import caches are defined
+	globals *SymbolTable
+	loader  *module.Loader
+	modules map[string]int // compiled module constants by path
+	// file and line are the source of the instructions being emitted
+	file string
+	line int
+}
+
+type Option func(*Compiler)
+
+// WithResolver sets where the modules loaded with `import` are read from
+func WithResolver(r module.Resolver) Option {
+	return func(c *Compiler) {
+		c.loader = module.NewLoader(r)
+	}
+}
+
+// WithFile names the source of the compiled functions, e.g. a library. It is empty for
+// the main program
+func WithFile(name string) Option {
+	return func(c *Compiler) {
+		c.file = name
+	}
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []value.Value
+	// Globals maps the names of global bindings to their index in the globals store
+	Globals map[string]int
+	// Lines maps the main instructions to source lines
+	Lines code.LineTable
+}
+
+// Error is a compilation error with the position of the node that caused it. File is
+// the module the node belongs to, empty for the main program
+type Error struct {
+	Pos  token.Position
+	File string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
 }
 
 type EmittedInstruction struct {
@@ -28,46 +75,61 @@ type EmittedInstruction struct {
 
 type Scope struct {
 	instructions    code.Instructions
+	lines           code.LineTable
 	lastInstruction EmittedInstruction
 	prevInstruction EmittedInstruction
 }
 
-func New() *Compiler {
-	scope := Scope{
-		instructions:    code.Instructions{},
-		prevInstruction: EmittedInstruction{},
-		lastInstruction: EmittedInstruction{},
-	}
-
-	symbolTable := NewSymbolTable()
-
-	for i, v := range value.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
-
-	return &Compiler{
-		constants:   []value.Value{},
-		symbolTable: symbolTable,
-		scopes:      []Scope{scope},
-		scopeIndex:  0,
-	}
+func New(opts ...Option) *Compiler {
+	return NewWithState(builtinSymbolTable(), []value.Value{}, opts...)
 }
 
-func NewWithState(s *SymbolTable, constants []value.Value) *Compiler {
+func NewWithState(s *SymbolTable, constants []value.Value, opts ...Option) *Compiler {
 	scope := Scope{
 		instructions:    code.Instructions{},
 		prevInstruction: EmittedInstruction{},
 		lastInstruction: EmittedInstruction{},
 	}
-	return &Compiler{
+	c := &Compiler{
 		constants:   constants,
 		symbolTable: s,
 		scopes:      []Scope{scope},
 		scopeIndex:  0,
+		globals:     s,
+		loader:      module.NewLoader(nil),
+		modules:     make(map[string]int),
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
-func (c *Compiler) Compile(node ast.Node) error {
+func builtinSymbolTable() *SymbolTable {
+	symbolTable := NewSymbolTable()
+	for i, b := range value.Builtins() {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
+	return symbolTable
+}
+
+func (c *Compiler) Compile(node ast.Node) (err error) {
+	defer func() {
+		// errors of imported modules are also positioned at the import
+		var compileErr *Error
+		if err != nil && (!errors.As(err, &compileErr) || compileErr.File != c.file) {
+			err = &Error{Pos: node.Pos(), File: c.file, Err: err}
+		}
+	}()
+
+	if line := node.Pos().Line; line != 0 && line != c.line {
+		outer := c.line
+		c.line = line
+		defer func() { c.line = outer }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -101,17 +163,32 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.InfixExpression:
+		if node.Operator == token.PIPELINE {
+			fnCall, ok := node.Right.(*ast.CallExpression)
+			if !ok {
+				return fmt.Errorf("expected function call in pipeline expression. got=%T", node.Right)
+			}
+
+			// compile as a call with the left node prepended to the fn arguments
+			return c.Compile(&ast.CallExpression{
+				Token:     fnCall.Token,
+				Function:  fnCall.Function,
+				Arguments: append([]ast.Expression{node.Left}, fnCall.Arguments...),
+			})
+		}
+
+		left, right := node.Left, node.Right
 		if node.Operator == "<" {
-			// invert operands
-			node.Left, node.Right = node.Right, node.Left
+			// invert operands without modifying the AST
+			left, right = right, left
 		}
 
-		err := c.Compile(node.Left)
+		err := c.Compile(left)
 		if err != nil {
 			return err
 		}
 
-		err = c.Compile(node.Right)
+		err = c.Compile(right)
 		if err != nil {
 			return err
 		}
@@ -242,6 +319,26 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(op, symbol.Index)
 
+	case *ast.ImportStatement:
+		constIndex, err := c.compileModule(node.Path)
+		if err != nil {
+			return err
+		}
+
+		// the exports are cached in a global slot that cannot be named in the language
+		cache, ok := c.globals.Resolve("import:" + node.Path)
+		if !ok {
+			cache = c.globals.Define("import:" + node.Path)
+		}
+		c.emit(code.OpImport, constIndex, cache.Index)
+
+		symbol := c.symbolTable.Define(node.Name.Value)
+		op := code.OpSetLocal
+		if symbol.Scope == GlobalScope {
+			op = code.OpSetGlobal
+		}
+		c.emit(op, symbol.Index)
+
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
@@ -288,6 +385,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		localsCount := c.symbolTable.definitions
+		locals := c.symbolTable.Names()
+		lines := c.currentLines()
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
@@ -298,6 +397,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 			Instructions:   instructions,
 			LocalsCount:    localsCount,
 			ArgumentsCount: len(node.Parameters),
+			Name:           node.Name,
+			File:           c.file,
+			Lines:          lines,
+			Locals:         locals,
 		}
 		c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
 
@@ -333,6 +436,8 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		Globals:      c.symbolTable.globalIndexes(),
+		Lines:        c.currentLines(),
 	}
 }
 
@@ -403,17 +508,88 @@ func (c *Compiler) changeOperandAt(opPos int, operand int) {
 	c.replaceInstructionAt(opPos, newInstruction)
 }
 
+func (c *Compiler) currentLines() code.LineTable {
+	return c.scopes[c.scopeIndex].lines
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
 	newPos := len(c.currentInstructions())
 	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	c.addLine(newPos)
 	return newPos
 }
 
+// addLine records the current line for the instruction at pos when it differs from
+// the line of the previous instruction
+func (c *Compiler) addLine(pos int) {
+	scope := &c.scopes[c.scopeIndex]
+	// entries of removed instructions
+	for len(scope.lines) > 0 && scope.lines[len(scope.lines)-1].Offset >= pos {
+		scope.lines = scope.lines[:len(scope.lines)-1]
+	}
+
+	if c.line == 0 || (len(scope.lines) > 0 && scope.lines[len(scope.lines)-1].Line == c.line) {
+		return
+	}
+
+	scope.lines = append(scope.lines, code.LineEntry{Offset: pos, Line: c.line})
+}
+
 func (c *Compiler) addConstant(v value.Value) int {
 	c.constants = append(c.constants, v)
 	return len(c.constants) - 1
 }
 
+// compileModule compiles the module as a function that returns a hash with its exports.
+// The module only sees the builtins and its own bindings
+func (c *Compiler) compileModule(path string) (int, error) {
+	if constIndex, ok := c.modules[path]; ok {
+		return constIndex, nil
+	}
+
+	program, err := c.loader.Enter(path)
+	if err != nil {
+		return 0, err
+	}
+	defer c.loader.Exit()
+
+	outer, outerFile, outerLine := c.symbolTable, c.file, c.line
+	c.enterScope()
+	c.symbolTable = NewEnclosedSymbolTable(builtinSymbolTable())
+	c.file, c.line = path, 0
+	defer func() { c.symbolTable, c.file, c.line = outer, outerFile, outerLine }()
+
+	if err := c.Compile(program); err != nil {
+		c.leaveScope()
+		return 0, fmt.Errorf("module %q: %w", path, err)
+	}
+
+	exports := module.Exports(program)
+	for _, name := range exports {
+		c.emit(code.OpConstant, c.addConstant(&value.String{Value: name}))
+		symbol, _ := c.symbolTable.Resolve(name)
+		c.loadSymbol(symbol)
+	}
+	c.emit(code.OpHash, len(exports)*2)
+	c.emit(code.OpReturnValue)
+
+	localsCount := c.symbolTable.definitions
+	locals := c.symbolTable.Names()
+	lines := c.currentLines()
+	instructions := c.leaveScope()
+
+	constIndex := c.addConstant(&value.CompiledFunction{
+		Instructions: instructions,
+		LocalsCount:  localsCount,
+		Name:         path,
+		File:         path,
+		Lines:        lines,
+		Locals:       locals,
+	})
+	c.modules[path] = constIndex
+	return constIndex, nil
+}
+
 func (c *Compiler) enterScope() {
 	scope := Scope{
 		instructions:    code.Instructions{},
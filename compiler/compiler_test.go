@@ -1,13 +1,17 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"protiumx.dev/simia/ast"
 	"protiumx.dev/simia/code"
 	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/module"
 	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/token"
 	"protiumx.dev/simia/value"
 )
 
@@ -810,6 +814,186 @@ func TestBuiltins(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestPipeline(t *testing.T) {
+	tests := []compilerTestcase{
+		{
+			input:             `[] |> append(1)`,
+			expectedConstants: []any{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 2),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestImport(t *testing.T) {
+	compiler := New(WithResolver(module.MapResolver{"lib/m": "export let a = 1; let b = 2;"}))
+	if err := compiler.Compile(parse(`import "lib/m"; import "lib/m" as n; m`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	expectedConstants := []any{
+		1,
+		2,
+		"a",
+		[]code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpSetLocal, 0),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpSetLocal, 1),
+			code.Make(code.OpConstant, 2),
+			code.Make(code.OpGetLocal, 0),
+			code.Make(code.OpHash, 2),
+			code.Make(code.OpReturnValue),
+		},
+	}
+	if err := testConstants(t, expectedConstants, bytecode.Constants); err != nil {
+		t.Fatalf("test constants failed: %s", err)
+	}
+
+	// the module is compiled once and both imports share the cache in global 0
+	expectedInstructions := []code.Instructions{
+		code.Make(code.OpImport, 3, 0),
+		code.Make(code.OpSetGlobal, 1),
+		code.Make(code.OpImport, 3, 0),
+		code.Make(code.OpSetGlobal, 2),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpPop),
+	}
+	if err := testInstructions(expectedInstructions, bytecode.Instructions); err != nil {
+		t.Fatalf("test instructions failed: %s", err)
+	}
+}
+
+func TestLines(t *testing.T) {
+	input := `let add = fn(a, b) {
+  let c = a +
+    b;
+  c
+};
+import "lib/m";
+add(1,
+  2)`
+	compiler := New(WithResolver(module.MapResolver{"lib/m": "\nexport let a = 1;"}))
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	// OpClosure, OpSetGlobal, OpImport, OpSetGlobal, OpGetGlobal, 2 x OpConstant, OpCall, OpPop
+	expectedLines := code.LineTable{{Offset: 0, Line: 1}, {Offset: 7, Line: 6}, {Offset: 15, Line: 7}, {Offset: 21, Line: 8}, {Offset: 24, Line: 7}}
+	if !reflect.DeepEqual(bytecode.Lines, expectedLines) {
+		t.Errorf("wrong main lines.\nwant=%v\ngot=%v", expectedLines, bytecode.Lines)
+	}
+
+	fn := bytecode.Constants[0].(*value.CompiledFunction)
+	// OpGetLocal a, OpGetLocal b, OpAdd, OpSetLocal, OpGetLocal c, OpReturnValue
+	expectedLines = code.LineTable{{Offset: 0, Line: 2}, {Offset: 2, Line: 3}, {Offset: 4, Line: 2}, {Offset: 7, Line: 4}}
+	if fn.Name != "add" || fn.File != "" || !reflect.DeepEqual(fn.Lines, expectedLines) {
+		t.Errorf("wrong function debug info. name=%q, file=%q\nwant=%v\ngot=%v", fn.Name, fn.File, expectedLines, fn.Lines)
+	}
+
+	mod := bytecode.Constants[3].(*value.CompiledFunction)
+	expectedLines = code.LineTable{{Offset: 0, Line: 2}}
+	if mod.Name != "lib/m" || mod.File != "lib/m" || !reflect.DeepEqual(mod.Lines, expectedLines) {
+		t.Errorf("wrong module debug info. name=%q, file=%q\nwant=%v\ngot=%v", mod.Name, mod.File, expectedLines, mod.Lines)
+	}
+}
+
+func TestLocals(t *testing.T) {
+	input := `let f = fn(a, b) {
+  let c = a + b;
+  let inner = fn(x) { let y = x; y + c };
+  let c = inner(c);
+  c
+};`
+	compiler := New(WithResolver(module.MapResolver{"m": "let hidden = 1; export let shown = hidden;"}))
+	if err := compiler.Compile(parse(input + `import "m";`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	constants := compiler.Bytecode().Constants
+	expected := map[string][]string{
+		"inner": {"x", "y"},
+		"f":     {"a", "b", "c", "inner", "c"},
+		"m":     {"hidden", "shown"},
+	}
+
+	for _, constant := range constants {
+		fn, ok := constant.(*value.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		if !reflect.DeepEqual(fn.Locals, expected[fn.Name]) || len(fn.Locals) != fn.LocalsCount {
+			t.Errorf("wrong locals of %q. want=%v, got=%v (count %d)", fn.Name, expected[fn.Name], fn.Locals, fn.LocalsCount)
+		}
+		delete(expected, fn.Name)
+	}
+
+	if len(expected) != 0 {
+		t.Errorf("functions not compiled: %v", expected)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Error
+	}{
+		{"let a = 1;\nlet f = fn() {\n  a + b\n};", Error{Pos: token.Position{Line: 3, Column: 7}}},
+		{"let a = 1;\n  import \"lib/m\";", Error{Pos: token.Position{Line: 2, Column: 3}}},
+	}
+
+	for _, tt := range tests {
+		compiler := New(WithResolver(module.MapResolver{"lib/m": "\nx"}))
+		err := compiler.Compile(parse(tt.input))
+
+		var compileErr *Error
+		if !errors.As(err, &compileErr) {
+			t.Fatalf("%q: expected a compiler.Error, got %v", tt.input, err)
+		}
+
+		if compileErr.Pos != tt.expected.Pos || compileErr.File != "" {
+			t.Errorf("%q: expected error at %s, got %s in %q", tt.input, tt.expected.Pos, compileErr.Pos, compileErr.File)
+		}
+	}
+
+	compiler := New(WithResolver(module.MapResolver{"lib/m": "\nx"}))
+	err := compiler.Compile(parse(`import "lib/m";`))
+	if err.Error() != `module "lib/m": undefined variable x` {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	var moduleErr *Error
+	errors.As(errors.Unwrap(errors.Unwrap(err)), &moduleErr)
+	if moduleErr == nil || moduleErr.File != "lib/m" || moduleErr.Pos != (token.Position{Line: 2, Column: 1}) {
+		t.Errorf("expected the position in the module, got %+v", moduleErr)
+	}
+}
+
+func TestCompileDoesNotModifyAST(t *testing.T) {
+	program := parse("1 < 2; [] |> append(1)")
+	before := program.String()
+
+	for i := 0; i < 2; i++ {
+		if err := New().Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		if program.String() != before {
+			t.Fatalf("AST was modified. want=%q, got=%q", before, program.String())
+		}
+	}
+}
+
 func TestClosure(t *testing.T) {
 	tests := []compilerTestcase{
 		{
@@ -0,0 +1,580 @@
+package compiler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"protiumx.dev/simia/code"
+	"protiumx.dev/simia/value"
+)
+
+// Bytecode files (.smc) start with a header followed by the payload:
+//
+//	magic    "\x00smc"
+//	format   uint16, FormatVersion
+//	opcodes  uint16, code.Version
+//	checksum [32]byte, SHA-256 of the payload
+//
+// The payload holds the builtin names used at compile time, the global names, the
+// main instructions and lines and the constant pool, with the lines and local names
+// of the functions. Integers are written as varints and strings and instructions are
+// prefixed with their length
+const (
+	FileExt       = ".smc"
+	FormatVersion = 3
+)
+
+var magic = []byte("\x00smc")
+
+const headerSize = 4 + 2 + 2 + sha256.Size
+
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagFunction
+)
+
+var (
+	// ErrNotBytecode is returned for files that do not start with the magic header
+	ErrNotBytecode = errors.New("not a simia bytecode file")
+	// ErrIncompatible is returned for files written by another version of simia
+	ErrIncompatible = errors.New("incompatible bytecode")
+	// ErrCorrupted is returned when the checksum or the contents are invalid
+	ErrCorrupted = errors.New("corrupted bytecode")
+)
+
+// Encode writes the bytecode in the .smc format. The output only depends on the bytecode
+func Encode(w io.Writer, b *Bytecode) error {
+	var payload encoder
+
+	builtins := value.Builtins()
+	payload.uvarint(uint64(len(builtins)))
+	for _, builtin := range builtins {
+		payload.string(builtin.Name)
+	}
+
+	names := make([]string, 0, len(b.Globals))
+	for name := range b.Globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	payload.uvarint(uint64(len(names)))
+	for _, name := range names {
+		payload.string(name)
+		payload.uvarint(uint64(b.Globals[name]))
+	}
+
+	payload.bytes(b.Instructions)
+	payload.lines(b.Lines)
+
+	payload.uvarint(uint64(len(b.Constants)))
+	for i, constant := range b.Constants {
+		switch constant := constant.(type) {
+		case *value.Integer:
+			payload.byte(tagInteger)
+			payload.varint(constant.Value)
+		case *value.String:
+			payload.byte(tagString)
+			payload.string(constant.Value)
+		case *value.CompiledFunction:
+			payload.byte(tagFunction)
+			payload.uvarint(uint64(constant.LocalsCount))
+			payload.uvarint(uint64(constant.ArgumentsCount))
+			payload.bytes(constant.Instructions)
+			payload.string(constant.Name)
+			payload.string(constant.File)
+			payload.lines(constant.Lines)
+			payload.uvarint(uint64(len(constant.Locals)))
+			for _, name := range constant.Locals {
+				payload.string(name)
+			}
+		default:
+			return fmt.Errorf("constant %d: cannot encode %s", i, constant.Type())
+		}
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = binary.BigEndian.AppendUint16(header, FormatVersion)
+	header = binary.BigEndian.AppendUint16(header, code.Version)
+	checksum := sha256.Sum256(payload.Bytes())
+	header = append(header, checksum[:]...)
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload.Bytes())
+	return err
+}
+
+// Decode reads bytecode written by Encode. Files with another format or opcode set
+// version, with builtins that differ from the registered ones, or whose contents do
+// not match the checksum are rejected
+func Decode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(magic) || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, ErrNotBytecode
+	}
+
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%w: truncated header", ErrCorrupted)
+	}
+
+	if format := binary.BigEndian.Uint16(data[4:]); format != FormatVersion {
+		return nil, fmt.Errorf("%w: file format version %d, expected %d", ErrIncompatible, format, FormatVersion)
+	}
+
+	if opcodes := binary.BigEndian.Uint16(data[6:]); opcodes != code.Version {
+		return nil, fmt.Errorf("%w: compiled for opcode set %d, expected %d", ErrIncompatible, opcodes, code.Version)
+	}
+
+	payload := data[headerSize:]
+	if checksum := sha256.Sum256(payload); !bytes.Equal(checksum[:], data[8:headerSize]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+	}
+
+	d := &decoder{data: payload}
+	b, err := d.bytecode()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d.data) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrCorrupted, len(d.data))
+	}
+
+	return b, nil
+}
+
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) byte(b byte) {
+	e.WriteByte(b)
+}
+
+func (e *encoder) uvarint(n uint64) {
+	e.Write(binary.AppendUvarint(nil, n))
+}
+
+func (e *encoder) varint(n int64) {
+	e.Write(binary.AppendVarint(nil, n))
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.WriteString(s)
+}
+
+func (e *encoder) lines(t code.LineTable) {
+	e.uvarint(uint64(len(t)))
+	for _, entry := range t {
+		e.uvarint(uint64(entry.Offset))
+		e.uvarint(uint64(entry.Line))
+	}
+}
+
+// decoder reads the payload. Its methods return zero values after the first error
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrCorrupted, fmt.Sprintf(format, args...))
+	}
+	d.data = nil
+}
+
+func (d *decoder) byte() byte {
+	if len(d.data) == 0 {
+		d.fail("unexpected end of file")
+		return 0
+	}
+
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	n, read := binary.Uvarint(d.data)
+	if read <= 0 {
+		d.fail("invalid integer")
+		return 0
+	}
+
+	d.data = d.data[read:]
+	return n
+}
+
+func (d *decoder) varint() int64 {
+	n, read := binary.Varint(d.data)
+	if read <= 0 {
+		d.fail("invalid integer")
+		return 0
+	}
+
+	d.data = d.data[read:]
+	return n
+}
+
+// length reads a length that must not exceed the remaining bytes
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail("length %d exceeds the file size", n)
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.length()
+	b := make([]byte, n)
+	copy(b, d.data[:n])
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
+
+func (d *decoder) strings() []string {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+
+	s := make([]string, n)
+	for i := range s {
+		s[i] = d.string()
+	}
+	return s
+}
+
+func (d *decoder) lines() code.LineTable {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+
+	t := make(code.LineTable, n)
+	for i := range t {
+		t[i] = code.LineEntry{Offset: int(d.uvarint()), Line: int(d.uvarint())}
+	}
+	return t
+}
+
+func (d *decoder) bytecode() (*Bytecode, error) {
+	builtins := value.Builtins()
+	count := d.length()
+	if d.err == nil && count > len(builtins) {
+		return nil, fmt.Errorf("%w: compiled with %d builtins, %d are registered", ErrIncompatible, count, len(builtins))
+	}
+
+	for i := 0; i < count && d.err == nil; i++ {
+		if name := d.string(); d.err == nil && name != builtins[i].Name {
+			return nil, fmt.Errorf("%w: builtin %d is %s in the file and %s in this build", ErrIncompatible, i, name, builtins[i].Name)
+		}
+	}
+
+	b := &Bytecode{Globals: map[string]int{}}
+	globals := d.length()
+	for i := 0; i < globals && d.err == nil; i++ {
+		name := d.string()
+		b.Globals[name] = int(d.uvarint())
+	}
+
+	b.Instructions = d.bytes()
+	b.Lines = d.lines()
+
+	constants := d.length()
+	b.Constants = make([]value.Value, 0, constants)
+	for i := 0; i < constants && d.err == nil; i++ {
+		switch tag := d.byte(); tag {
+		case tagInteger:
+			b.Constants = append(b.Constants, &value.Integer{Value: d.varint()})
+		case tagString:
+			b.Constants = append(b.Constants, &value.String{Value: d.string()})
+		case tagFunction:
+			fn := &value.CompiledFunction{LocalsCount: int(d.uvarint()), ArgumentsCount: int(d.uvarint())}
+			fn.Instructions = d.bytes()
+			fn.Name = d.string()
+			fn.File = d.string()
+			fn.Lines = d.lines()
+			fn.Locals = d.strings()
+			b.Constants = append(b.Constants, fn)
+		default:
+			d.fail("constant %d has unknown tag %d", i, tag)
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if err := newValidator(b, count).validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+
+	return b, nil
+}
+
+// validator checks that the instructions are well formed and only refer to existing
+// constants, builtins, globals, locals, free variables and positions, and that they
+// never pop more values than they pushed, so the VM can run them safely
+type validator struct {
+	main      code.Instructions
+	constants []value.Value
+	builtins  int
+	// globals is the size of the global store used by the program
+	globals int
+	// free are the free variables given to the function constants by OpClosure, the
+	// smallest count when a function has several closures
+	free map[int]int
+}
+
+type instruction struct {
+	offset   int
+	op       code.Opcode
+	operands []int
+}
+
+func newValidator(b *Bytecode, builtins int) *validator {
+	v := &validator{main: b.Instructions, constants: b.Constants, builtins: builtins, free: map[int]int{}}
+	for _, idx := range b.Globals {
+		if idx >= v.globals {
+			v.globals = idx + 1
+		}
+	}
+
+	return v
+}
+
+func (v *validator) validate() error {
+	main, err := v.decode(v.main)
+	if err != nil {
+		return fmt.Errorf("main: %s", err)
+	}
+
+	functions := map[int][]instruction{}
+	for i, constant := range v.constants {
+		if fn, ok := constant.(*value.CompiledFunction); ok {
+			if functions[i], err = v.decode(fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d: %s", i, err)
+			}
+		}
+	}
+
+	// the free variables of the functions are known once every closure is decoded
+	if err := v.check(main, len(v.main), 0, 0); err != nil {
+		return fmt.Errorf("main: %s", err)
+	}
+
+	for i, constant := range v.constants {
+		fn, ok := constant.(*value.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		if fn.ArgumentsCount > fn.LocalsCount || len(fn.Locals) > fn.LocalsCount {
+			return fmt.Errorf("constant %d: %d arguments and %d local names for %d locals", i, fn.ArgumentsCount, len(fn.Locals), fn.LocalsCount)
+		}
+
+		if err := v.check(functions[i], len(fn.Instructions), fn.LocalsCount, v.free[i]); err != nil {
+			return fmt.Errorf("constant %d: %s", i, err)
+		}
+	}
+
+	return nil
+}
+
+// decode reads the instructions and checks the operands that do not depend on the
+// function they belong to
+func (v *validator) decode(ins code.Instructions) ([]instruction, error) {
+	var decoded []instruction
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return nil, fmt.Errorf("%04d: %s", i, err)
+		}
+
+		if i+1+def.Width() > len(ins) {
+			return nil, fmt.Errorf("%04d: %s is truncated", i, def.Name)
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		op := code.Opcode(ins[i])
+		switch op {
+		case code.OpConstant:
+			if operands[0] >= len(v.constants) {
+				return nil, fmt.Errorf("%04d: constant %d out of range", i, operands[0])
+			}
+		case code.OpClosure, code.OpImport:
+			if operands[0] >= len(v.constants) {
+				return nil, fmt.Errorf("%04d: constant %d out of range", i, operands[0])
+			}
+			if _, ok := v.constants[operands[0]].(*value.CompiledFunction); !ok {
+				return nil, fmt.Errorf("%04d: constant %d is not a function", i, operands[0])
+			}
+
+			// modules are called without free variables
+			free := 0
+			if op == code.OpClosure {
+				free = operands[1]
+			}
+			if n, ok := v.free[operands[0]]; !ok || free < n {
+				v.free[operands[0]] = free
+			}
+
+			if op == code.OpImport && operands[1] >= v.globals {
+				return nil, fmt.Errorf("%04d: global %d out of range", i, operands[1])
+			}
+		case code.OpGetGlobal, code.OpSetGlobal:
+			if operands[0] >= v.globals {
+				return nil, fmt.Errorf("%04d: global %d out of range", i, operands[0])
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= v.builtins {
+				return nil, fmt.Errorf("%04d: builtin %d out of range", i, operands[0])
+			}
+		}
+
+		decoded = append(decoded, instruction{i, op, operands})
+		i += 1 + read
+	}
+
+	return decoded, nil
+}
+
+// check validates the jumps, the locals and free variables and the stack of a function
+// with locals slots and free variables
+func (v *validator) check(ins []instruction, size, locals, free int) error {
+	// index maps the offsets of the instructions to their position in ins
+	index := make(map[int]int, len(ins))
+	for i, in := range ins {
+		index[in.offset] = i
+	}
+
+	for _, in := range ins {
+		switch in.op {
+		case code.OpJump, code.OpJumpIfBranch:
+			// jumping to the end finishes the function
+			if _, ok := index[in.operands[0]]; !ok && in.operands[0] != size {
+				return fmt.Errorf("%04d: jump target %d is not an instruction", in.offset, in.operands[0])
+			}
+		case code.OpGetLocal, code.OpSetLocal:
+			if in.operands[0] >= locals {
+				return fmt.Errorf("%04d: local %d out of range", in.offset, in.operands[0])
+			}
+		case code.OpGetFree:
+			if in.operands[0] >= free {
+				return fmt.Errorf("%04d: free variable %d out of range", in.offset, in.operands[0])
+			}
+		}
+	}
+
+	return checkStack(ins, index)
+}
+
+// checkStack follows every path of the instructions and fails when one pops a value
+// that was not pushed. depths holds the smallest stack size seen before each instruction
+func checkStack(ins []instruction, index map[int]int) error {
+	depths := make([]int, len(ins))
+	for i := range depths {
+		depths[i] = -1
+	}
+
+	type state struct{ i, depth int }
+	pending := []state{{0, 0}}
+	for len(pending) > 0 {
+		s := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for s.i < len(ins) && (depths[s.i] < 0 || s.depth < depths[s.i]) {
+			depths[s.i] = s.depth
+			in := ins[s.i]
+
+			pops, pushes := stackEffect(in)
+			if s.depth < pops {
+				return fmt.Errorf("%04d: %s pops %d values from a stack of %d", in.offset, definitionName(in.op), pops, s.depth)
+			}
+			s.depth += pushes - pops
+
+			switch in.op {
+			case code.OpReturn, code.OpReturnValue:
+				s.i = len(ins)
+				continue
+			case code.OpJump:
+				s.i = jumpTarget(ins, index, in.operands[0])
+				continue
+			case code.OpJumpIfBranch:
+				pending = append(pending, state{jumpTarget(ins, index, in.operands[0]), s.depth})
+			}
+
+			s.i++
+		}
+	}
+
+	return nil
+}
+
+// jumpTarget returns the position of the instruction at offset, len(ins) for the end
+func jumpTarget(ins []instruction, index map[int]int, offset int) int {
+	if i, ok := index[offset]; ok {
+		return i
+	}
+	return len(ins)
+}
+
+// stackEffect returns the number of values an instruction pops and pushes
+func stackEffect(in instruction) (int, int) {
+	switch in.op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNil, code.OpGetGlobal, code.OpGetLocal,
+		code.OpGetBuiltin, code.OpGetFree, code.OpCurrentClosure, code.OpImport:
+		return 0, 1
+	case code.OpPop, code.OpSetGlobal, code.OpSetLocal, code.OpJumpIfBranch, code.OpReturnValue:
+		return 1, 0
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpIndex:
+		return 2, 1
+	case code.OpMinus, code.OpBang:
+		return 1, 1
+	case code.OpArray, code.OpHash:
+		return in.operands[0], 1
+	case code.OpCall:
+		// the function and its arguments
+		return in.operands[0] + 1, 1
+	case code.OpClosure:
+		return in.operands[1], 1
+	default:
+		return 0, 0
+	}
+}
+
+func definitionName(op code.Opcode) string {
+	def, _ := code.Lookup(byte(op))
+	return def.Name
+}
@@ -0,0 +1,225 @@
+package compiler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"testing"
+
+	"protiumx.dev/simia/code"
+	"protiumx.dev/simia/value"
+)
+
+func compileForEncoding(t *testing.T, input string) *Bytecode {
+	t.Helper()
+
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return comp.Bytecode()
+}
+
+func encode(t *testing.T, b *Bytecode) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, b); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestEncodeDecode(t *testing.T) {
+	input := `
+	let greeting = "hello";
+	let counter = fn(start) {
+		let step = fn(n) { n + start };
+		fn(x, y) { let z = step(x); z + y + -2 }
+	};
+	counter(10)(1, 2)
+	`
+	bytecode := compileForEncoding(t, input)
+	data := encode(t, bytecode)
+
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, bytecode) {
+		t.Fatalf("decoded bytecode differs.\nwant=%#v\ngot=%#v", bytecode, decoded)
+	}
+
+	if !bytes.Equal(encode(t, decoded), data) {
+		t.Fatal("encoding is not deterministic")
+	}
+}
+
+// withPayload replaces the payload of an encoded file and fixes the checksum
+func withPayload(data, payload []byte) []byte {
+	checksum := sha256.Sum256(payload)
+	out := append([]byte{}, data[:8]...)
+	out = append(out, checksum[:]...)
+	return append(out, payload...)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data := encode(t, compileForEncoding(t, `let f = fn(a) { len(a) }; f("x")`))
+
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	badFormat := append([]byte{}, data...)
+	badFormat[5] = 9
+
+	badOpcodes := append([]byte{}, data...)
+	badOpcodes[7]++
+
+	var renamed encoder
+	renamed.uvarint(1)
+	renamed.string("length")
+	renamed.uvarint(0)
+	renamed.bytes(nil)
+	renamed.uvarint(0)
+	renamed.uvarint(0)
+
+	var badConstant encoder
+	badConstant.uvarint(0)
+	badConstant.uvarint(0)
+	badConstant.bytes(code.Make(code.OpConstant, 3))
+	badConstant.uvarint(0)
+	badConstant.uvarint(0)
+
+	var badOpcode encoder
+	badOpcode.uvarint(0)
+	badOpcode.uvarint(0)
+	badOpcode.bytes([]byte{255})
+	badOpcode.uvarint(0)
+	badOpcode.uvarint(0)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		target   error
+		expected string
+	}{
+		{"empty", nil, ErrNotBytecode, "not a simia bytecode file"},
+		{"source", []byte("let x = 1;"), ErrNotBytecode, "not a simia bytecode file"},
+		{"truncated", data[:10], ErrCorrupted, "corrupted bytecode: truncated header"},
+		{"tampered", tampered, ErrCorrupted, "corrupted bytecode: checksum mismatch"},
+		{"format", badFormat, ErrIncompatible, "incompatible bytecode: file format version 9, expected 3"},
+		{"opcodes", badOpcodes, ErrIncompatible, "incompatible bytecode: compiled for opcode set 2, expected 1"},
+		{"builtins", withPayload(data, renamed.Bytes()), ErrIncompatible, "incompatible bytecode: builtin 0 is length in the file and len in this build"},
+		{"constant", withPayload(data, badConstant.Bytes()), ErrCorrupted, "corrupted bytecode: main: 0000: constant 3 out of range"},
+		{"opcode", withPayload(data, badOpcode.Bytes()), ErrCorrupted, "corrupted bytecode: main: 0000: opcode 255 undefined"},
+		{"eof", withPayload(data, []byte{0, 0, 5}), ErrCorrupted, "corrupted bytecode: length 5 exceeds the file size"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.data))
+		if !errors.Is(err, tt.target) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.target, err)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.expected, err)
+		}
+	}
+}
+
+// TestDecodeInvalidInstructions checks files with a valid checksum whose instructions
+// would crash the VM
+func TestDecodeInvalidInstructions(t *testing.T) {
+	instructions := func(ins ...[]byte) code.Instructions {
+		return code.Instructions(bytes.Join(ins, nil))
+	}
+	function := func(locals, args int, ins ...[]byte) *value.CompiledFunction {
+		return &value.CompiledFunction{Instructions: instructions(ins...), LocalsCount: locals, ArgumentsCount: args}
+	}
+	closure := instructions(code.Make(code.OpNil), code.Make(code.OpClosure, 0, 1), code.Make(code.OpPop))
+
+	tests := []struct {
+		name     string
+		bytecode *Bytecode
+		expected string
+	}{
+		{
+			"free",
+			&Bytecode{Instructions: closure, Constants: []value.Value{function(0, 0, code.Make(code.OpGetFree, 3), code.Make(code.OpReturnValue))}},
+			"constant 0: 0000: free variable 3 out of range",
+		},
+		{
+			"jump",
+			&Bytecode{Instructions: instructions(code.Make(code.OpJump, 1), code.Make(code.OpNil), code.Make(code.OpPop))},
+			"main: 0000: jump target 1 is not an instruction",
+		},
+		{
+			"branch",
+			&Bytecode{Instructions: instructions(code.Make(code.OpTrue), code.Make(code.OpJumpIfBranch, 9))},
+			"main: 0001: jump target 9 is not an instruction",
+		},
+		{
+			"stack",
+			&Bytecode{Instructions: instructions(code.Make(code.OpAdd), code.Make(code.OpPop))},
+			"main: 0000: OpAdd pops 2 values from a stack of 0",
+		},
+		{
+			// only one branch leaves a value on the stack
+			"branch stack",
+			&Bytecode{Instructions: instructions(
+				code.Make(code.OpTrue), code.Make(code.OpJumpIfBranch, 5), code.Make(code.OpNil), code.Make(code.OpPop),
+			)},
+			"main: 0005: OpPop pops 1 values from a stack of 0",
+		},
+		{
+			"local",
+			&Bytecode{Instructions: closure, Constants: []value.Value{function(1, 1, code.Make(code.OpGetLocal, 1), code.Make(code.OpReturnValue))}},
+			"constant 0: 0000: local 1 out of range",
+		},
+		{
+			"main local",
+			&Bytecode{Instructions: instructions(code.Make(code.OpGetLocal, 0), code.Make(code.OpPop))},
+			"main: 0000: local 0 out of range",
+		},
+		{
+			"arguments",
+			&Bytecode{Instructions: closure, Constants: []value.Value{function(1, 2, code.Make(code.OpReturn))}},
+			"constant 0: 2 arguments and 0 local names for 1 locals",
+		},
+		{
+			"global",
+			&Bytecode{Globals: map[string]int{"x": 0}, Instructions: instructions(code.Make(code.OpGetGlobal, 1), code.Make(code.OpPop))},
+			"main: 0000: global 1 out of range",
+		},
+		{
+			"import",
+			&Bytecode{Instructions: instructions(code.Make(code.OpImport, 0, 4), code.Make(code.OpPop)), Constants: []value.Value{function(0, 0, code.Make(code.OpReturn))}},
+			"main: 0000: global 4 out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(encode(t, tt.bytecode)))
+		if !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: expected %v, got %v", tt.name, ErrCorrupted, err)
+			continue
+		}
+
+		if expected := "corrupted bytecode: " + tt.expected; err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %q", tt.name, expected, err)
+		}
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	b := &Bytecode{Constants: []value.Value{value.TRUE}}
+	err := Encode(&bytes.Buffer{}, b)
+	if err == nil || err.Error() != "constant 0: cannot encode BOOLEAN" {
+		t.Fatalf("expected unsupported constant error, got %v", err)
+	}
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
@@ -21,6 +23,8 @@ type SymbolTable struct {
 
 	store       map[string]Symbol
 	definitions int
+	// names are the defined names by index
+	names []string
 
 	FreeSymbols []Symbol
 }
@@ -46,9 +50,16 @@ func (t *SymbolTable) Define(name string) Symbol {
 
 	t.store[name] = s
 	t.definitions++
+	t.names = append(t.names, name)
 	return s
 }
 
+// Names returns the names defined in the table by index, including the names that
+// were defined again with another index
+func (t *SymbolTable) Names() []string {
+	return t.names[:len(t.names):len(t.names)]
+}
+
 func (t *SymbolTable) Resolve(name string) (Symbol, bool) {
 	s, ok := t.store[name]
 	if !ok && t.Outer != nil {
@@ -88,3 +99,28 @@ func (t *SymbolTable) defineFree(original Symbol) Symbol {
 	t.store[original.Name] = symbol
 	return symbol
 }
+
+// Globals returns the global symbols defined in the table, in definition order. A name
+// defined again is listed once, with its last index
+func (t *SymbolTable) Globals() []Symbol {
+	globals := []Symbol{}
+	for _, s := range t.store {
+		if s.Scope == GlobalScope {
+			globals = append(globals, s)
+		}
+	}
+
+	sort.Slice(globals, func(i, j int) bool { return globals[i].Index < globals[j].Index })
+	return globals
+}
+
+// globalIndexes returns the index of every global binding defined in the table
+func (t *SymbolTable) globalIndexes() map[string]int {
+	indexes := make(map[string]int)
+	for name, s := range t.store {
+		if s.Scope == GlobalScope {
+			indexes[name] = s.Index
+		}
+	}
+	return indexes
+}
@@ -302,3 +302,33 @@ func TestShadowingFunctionName(t *testing.T) {
 	}
 
 }
+
+func TestGlobals(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("b")
+	global.Define("a")
+	global.Define("b")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("c")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 1},
+		{Name: "b", Scope: GlobalScope, Index: 2},
+	}
+
+	globals := global.Globals()
+	if len(globals) != len(expected) {
+		t.Fatalf("wrong globals. want=%+v, got=%+v", expected, globals)
+	}
+	for i, s := range expected {
+		if globals[i] != s {
+			t.Errorf("wrong global %d. want=%+v, got=%+v", i, s, globals[i])
+		}
+	}
+
+	if len(local.Globals()) != 0 {
+		t.Errorf("expected no globals in a local table, got %+v", local.Globals())
+	}
+}
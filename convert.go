@@ -0,0 +1,29 @@
+package simia
+
+import (
+	"sort"
+
+	"protiumx.dev/simia/value"
+)
+
+// ToValue converts a Go value into a simia value using reflection.
+// Integers, strings, booleans, slices, arrays, maps with string keys and structs
+// are supported. Struct fields can be renamed or skipped with the `simia` tag
+func ToValue(v any) (value.Value, error) {
+	return value.FromGo(v)
+}
+
+// ToGo converts a simia value into int64, string, bool, nil, []any or map[string]any
+func ToGo(v value.Value) (any, error) {
+	return value.ToGo(v)
+}
+
+// sortedNames is used to report globals deterministically
+func sortedNames(m map[string]any) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
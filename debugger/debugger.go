@@ -0,0 +1,475 @@
+// Package debugger stops programs running on the VM at breakpoints and steps, and
+// reads commands to inspect the call stack and the variables
+package debugger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"protiumx.dev/simia/code"
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/value"
+	"protiumx.dev/simia/vm"
+)
+
+// PROMPT is printed while the program is stopped
+const PROMPT = "(debug) "
+
+// ErrQuit is returned by the hook when the program is stopped with `quit` or the
+// commands end
+var ErrQuit = errors.New("debugging stopped")
+
+// Options configure a debugger
+type Options struct {
+	// Path names the main program in locations, e.g. main.sm:3
+	Path string
+	// Source is the main program, used to print its lines. It can be empty
+	Source string
+	// Resolver reads the sources of the imported modules, it can be nil
+	Resolver module.Resolver
+	// Libraries are the files the debugger does not stop in when stepping,
+	// e.g. prelude.File
+	Libraries []string
+	// Hidden are the globals not listed by `globals`, e.g. the prelude names
+	Hidden []string
+}
+
+type location struct {
+	file string
+	line int
+}
+
+type mode int
+
+const (
+	stepIn mode = iota
+	stepOver
+	stepOut
+	run
+)
+
+// Debugger reads commands each time the program stops. Use Hook with vm.WithLineHook,
+// the program stops at its first line
+type Debugger struct {
+	in       *bufio.Reader
+	out      io.Writer
+	opts     Options
+	bytecode *compiler.Bytecode
+
+	breakpoints map[location]bool
+	libraries   map[string]bool
+	hidden      map[string]bool
+	// sources are the lines of the files printed so far
+	sources map[string][]string
+
+	mode mode
+	// depth is the call stack depth where the last step started
+	depth int
+	// last is the command repeated by an empty line
+	last string
+	quit bool
+}
+
+// New creates a debugger for the bytecode, it reads commands from in and prints to out
+func New(bytecode *compiler.Bytecode, in io.Reader, out io.Writer, opts Options) *Debugger {
+	d := &Debugger{
+		in:          bufio.NewReader(in),
+		out:         out,
+		opts:        opts,
+		bytecode:    bytecode,
+		breakpoints: map[location]bool{},
+		libraries:   map[string]bool{},
+		hidden:      map[string]bool{},
+		// the main program is not read with the resolver
+		sources: map[string][]string{"": nil},
+	}
+
+	if opts.Source != "" {
+		d.sources[""] = strings.Split(opts.Source, "\n")
+	}
+
+	for _, file := range opts.Libraries {
+		d.libraries[file] = true
+	}
+	for _, name := range opts.Hidden {
+		d.hidden[name] = true
+	}
+
+	return d
+}
+
+// Hook stops the program at breakpoints and after steps, and reads commands until
+// the program is resumed
+func (d *Debugger) Hook(machine *vm.VM, file string, line int) error {
+	if d.quit {
+		return ErrQuit
+	}
+
+	here := location{file, line}
+	switch {
+	case d.breakpoints[here]:
+		fmt.Fprintf(d.out, "breakpoint at %s in %s\n", d.describe(here), functionName(machine.Frames(), 0))
+	case d.stops(machine, file):
+		fmt.Fprintf(d.out, "%s in %s\n", d.describe(here), functionName(machine.Frames(), 0))
+	default:
+		return nil
+	}
+
+	d.printLine(here, "")
+	return d.prompt(machine, here)
+}
+
+// stops reports whether the current step ends at a new line of file
+func (d *Debugger) stops(machine *vm.VM, file string) bool {
+	if d.libraries[file] {
+		return false
+	}
+
+	switch d.mode {
+	case stepIn:
+		return true
+	case stepOver:
+		return machine.Depth() <= d.depth
+	case stepOut:
+		return machine.Depth() < d.depth
+	default:
+		return false
+	}
+}
+
+// prompt runs commands until one resumes the program
+func (d *Debugger) prompt(machine *vm.VM, here location) error {
+	for {
+		io.WriteString(d.out, PROMPT)
+		input, err := d.in.ReadString('\n')
+		if err != nil && input == "" {
+			io.WriteString(d.out, "\n")
+			d.quit = true
+			return ErrQuit
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			input = d.last
+		}
+		d.last = input
+
+		name, arg, _ := strings.Cut(input, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch name {
+		case "":
+		case "step", "s":
+			d.mode = stepIn
+			return nil
+		case "next", "n":
+			d.mode, d.depth = stepOver, machine.Depth()
+			return nil
+		case "out", "o":
+			d.mode, d.depth = stepOut, machine.Depth()
+			return nil
+		case "continue", "c":
+			d.mode = run
+			return nil
+		case "break", "b":
+			d.setBreakpoint(arg)
+		case "delete", "d":
+			d.deleteBreakpoint(arg)
+		case "stack", "bt":
+			d.printStack(machine)
+		case "locals":
+			d.printLocals(machine, arg)
+		case "globals":
+			d.printGlobals(machine)
+		case "print", "p":
+			d.printVariable(machine, arg)
+		case "list", "l":
+			d.list(here)
+		case "help", "h":
+			d.help()
+		case "quit", "q":
+			d.quit = true
+			return ErrQuit
+		default:
+			fmt.Fprintf(d.out, "unknown command %q, type help to list the commands\n", name)
+		}
+	}
+}
+
+// parseLocation reads a breakpoint location, `line` in the main program or `file:line`
+func (d *Debugger) parseLocation(arg string) (location, error) {
+	file, lineText := "", arg
+	if i := strings.LastIndexByte(arg, ':'); i >= 0 {
+		file, lineText = arg[:i], arg[i+1:]
+		if file == d.opts.Path {
+			file = ""
+		}
+	}
+
+	line, err := strconv.Atoi(lineText)
+	if err != nil || line <= 0 {
+		return location{}, fmt.Errorf("invalid location %q, expected line or file:line", arg)
+	}
+
+	return location{file, line}, nil
+}
+
+func (d *Debugger) setBreakpoint(arg string) {
+	if arg == "" {
+		d.printBreakpoints()
+		return
+	}
+
+	loc, err := d.parseLocation(arg)
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+		return
+	}
+
+	if !d.hasCode(loc) {
+		fmt.Fprintf(d.out, "no code at %s\n", d.describe(loc))
+		return
+	}
+
+	d.breakpoints[loc] = true
+	fmt.Fprintf(d.out, "breakpoint set at %s\n", d.describe(loc))
+}
+
+func (d *Debugger) deleteBreakpoint(arg string) {
+	if arg == "" {
+		d.breakpoints = map[location]bool{}
+		fmt.Fprintln(d.out, "breakpoints deleted")
+		return
+	}
+
+	loc, err := d.parseLocation(arg)
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+		return
+	}
+
+	if !d.breakpoints[loc] {
+		fmt.Fprintf(d.out, "no breakpoint at %s\n", d.describe(loc))
+		return
+	}
+
+	delete(d.breakpoints, loc)
+	fmt.Fprintf(d.out, "breakpoint deleted at %s\n", d.describe(loc))
+}
+
+func (d *Debugger) printBreakpoints() {
+	locs := make([]location, 0, len(d.breakpoints))
+	for loc := range d.breakpoints {
+		locs = append(locs, loc)
+	}
+
+	if len(locs) == 0 {
+		fmt.Fprintln(d.out, "no breakpoints")
+		return
+	}
+
+	sort.Slice(locs, func(i, j int) bool {
+		return locs[i].file < locs[j].file || locs[i].file == locs[j].file && locs[i].line < locs[j].line
+	})
+	for _, loc := range locs {
+		fmt.Fprintf(d.out, "  %s\n", d.describe(loc))
+	}
+}
+
+// hasCode reports whether instructions were compiled from the location
+func (d *Debugger) hasCode(loc location) bool {
+	if loc.file == "" && hasLine(d.bytecode.Lines, loc.line) {
+		return true
+	}
+
+	for _, constant := range d.bytecode.Constants {
+		if fn, ok := constant.(*value.CompiledFunction); ok && fn.File == loc.file && hasLine(fn.Lines, loc.line) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasLine(lines code.LineTable, line int) bool {
+	for _, entry := range lines {
+		if entry.Line == line {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Debugger) printStack(machine *vm.VM) {
+	frames := machine.Frames()
+	for i, frame := range frames {
+		fmt.Fprintf(d.out, "#%d %s at %s\n", i, functionName(frames, i), d.describe(location{frame.File, frame.Line}))
+	}
+}
+
+// printLocals prints the locals of the frame at the index printed by `stack`
+func (d *Debugger) printLocals(machine *vm.VM, arg string) {
+	depth := 0
+	if arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 || n >= machine.Depth() {
+			fmt.Fprintf(d.out, "invalid frame %q\n", arg)
+			return
+		}
+		depth = n
+	}
+
+	if depth == machine.Depth()-1 {
+		fmt.Fprintln(d.out, "the main program has no locals, see globals")
+		return
+	}
+
+	d.printVariables(machine.Locals(depth), "no locals")
+}
+
+func (d *Debugger) printGlobals(machine *vm.VM) {
+	globals := []vm.Variable{}
+	for _, v := range machine.Globals() {
+		if !d.hidden[v.Name] {
+			globals = append(globals, v)
+		}
+	}
+
+	d.printVariables(globals, "no globals")
+}
+
+func (d *Debugger) printVariables(vars []vm.Variable, empty string) {
+	if len(vars) == 0 {
+		fmt.Fprintln(d.out, empty)
+		return
+	}
+
+	for _, v := range vars {
+		fmt.Fprintf(d.out, "  %s = %s\n", v.Name, v.Value.Inspect())
+	}
+}
+
+// printVariable prints a local of the current frame or a global. Later definitions
+// of a name shadow the earlier ones
+func (d *Debugger) printVariable(machine *vm.VM, name string) {
+	if name == "" {
+		fmt.Fprintln(d.out, "usage: print name")
+		return
+	}
+
+	var found value.Value
+	for _, v := range machine.Locals(0) {
+		if v.Name == name {
+			found = v.Value
+		}
+	}
+
+	if found == nil {
+		for _, v := range machine.Globals() {
+			if v.Name == name {
+				found = v.Value
+			}
+		}
+	}
+
+	if found == nil {
+		fmt.Fprintf(d.out, "%s is not defined\n", name)
+		return
+	}
+
+	fmt.Fprintf(d.out, "%s = %s\n", name, found.Inspect())
+}
+
+// list prints the lines around the current one
+func (d *Debugger) list(here location) {
+	lines := d.source(here.file)
+	if lines == nil {
+		fmt.Fprintf(d.out, "no source for %s\n", d.describe(here))
+		return
+	}
+
+	first := here.line - 3
+	if first < 1 {
+		first = 1
+	}
+	last := here.line + 3
+	if last > len(lines) {
+		last = len(lines)
+	}
+
+	for line := first; line <= last; line++ {
+		marker := "  "
+		if line == here.line {
+			marker = "=>"
+		}
+		d.printLine(location{here.file, line}, marker)
+	}
+}
+
+func (d *Debugger) printLine(loc location, marker string) {
+	lines := d.source(loc.file)
+	if loc.line > len(lines) {
+		return
+	}
+
+	fmt.Fprintf(d.out, "%2s%4d | %s\n", marker, loc.line, lines[loc.line-1])
+}
+
+// source returns the lines of a file, nil when it cannot be read
+func (d *Debugger) source(file string) []string {
+	if lines, ok := d.sources[file]; ok {
+		return lines
+	}
+
+	var lines []string
+	if d.opts.Resolver != nil && !d.libraries[file] {
+		if src, err := d.opts.Resolver.Resolve(file); err == nil {
+			lines = strings.Split(src, "\n")
+		}
+	}
+
+	d.sources[file] = lines
+	return lines
+}
+
+func (d *Debugger) describe(loc location) string {
+	file := loc.file
+	if file == "" {
+		file = d.opts.Path
+	}
+	return fmt.Sprintf("%s:%d", file, loc.line)
+}
+
+func functionName(frames []vm.StackFrame, i int) string {
+	switch {
+	case i == len(frames)-1:
+		return "<main>"
+	case frames[i].Function == "":
+		return "<anonymous>"
+	default:
+		return frames[i].Function
+	}
+}
+
+func (d *Debugger) help() {
+	fmt.Fprint(d.out, `  step, s            run to the next line, entering calls
+  next, n            run to the next line of the current function
+  out, o             run until the current function returns
+  continue, c        run until a breakpoint
+  break, b [loc]     set a breakpoint at line or file:line, list them without loc
+  delete, d [loc]    delete a breakpoint, or all of them
+  stack, bt          print the call stack
+  locals [frame]     print the locals of a frame of the stack, by default the current one
+  globals            print the globals
+  print, p name      print a local of the current function or a global
+  list, l            print the lines around the current one
+  quit, q            stop the program
+An empty line repeats the last command
+`)
+}
@@ -0,0 +1,165 @@
+package debugger
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/vm"
+)
+
+const source = `import "util";
+let base = 10;
+let add = fn(a, b) {
+  let sum = util["twice"](a + b);
+  sum + base
+};
+let first = add(1, 2);
+add(first, 3)`
+
+var modules = module.MapResolver{
+	"util": "export let twice = fn(x) {\n  x * 2\n};",
+}
+
+// debug runs the source with the commands and returns the output and the result
+func debug(t *testing.T, commands ...string) (string, string, error) {
+	t.Helper()
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	comp := compiler.New(compiler.WithResolver(modules))
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	in := strings.NewReader(strings.Join(commands, "\n") + "\n")
+	d := New(comp.Bytecode(), in, &out, Options{Path: "main.sm", Source: source, Resolver: modules})
+	machine := vm.New(comp.Bytecode(), vm.WithLineHook(d.Hook))
+
+	err := machine.Run()
+	result := ""
+	if err == nil {
+		result = machine.LastPoppedStackElement().Inspect()
+	}
+
+	return out.String(), result, err
+}
+
+// stops returns the locations the program stopped at
+func stops(out string) []string {
+	var locs []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimPrefix(line, PROMPT)
+		if strings.Contains(line, " in ") && !strings.Contains(line, "|") {
+			locs = append(locs, line)
+		}
+	}
+	return locs
+}
+
+func TestStepping(t *testing.T) {
+	tests := []struct {
+		commands []string
+		expected []string
+	}{
+		{
+			[]string{"n", "n", "n", "n", "n", "n"},
+			[]string{"main.sm:1 in <main>", "main.sm:2 in <main>", "main.sm:3 in <main>", "main.sm:7 in <main>", "main.sm:8 in <main>"},
+		},
+		{
+			[]string{"n", "n", "n", "s", "s", "s", "s", "c"},
+			[]string{"main.sm:1 in <main>", "main.sm:2 in <main>", "main.sm:3 in <main>", "main.sm:7 in <main>", "main.sm:4 in add", "util:2 in twice", "main.sm:5 in add", "main.sm:8 in <main>"},
+		},
+		{
+			// the empty line repeats step
+			[]string{"n", "n", "n", "s", "s", "", "o", "o"},
+			[]string{"main.sm:1 in <main>", "main.sm:2 in <main>", "main.sm:3 in <main>", "main.sm:7 in <main>", "main.sm:4 in add", "util:2 in twice", "main.sm:5 in add", "main.sm:8 in <main>"},
+		},
+		{
+			[]string{"b 5", "c", "c", "c"},
+			[]string{"main.sm:1 in <main>", "breakpoint at main.sm:5 in add", "breakpoint at main.sm:5 in add"},
+		},
+		{
+			[]string{"b util:2", "b main.sm:8", "d util:2", "c", "c"},
+			[]string{"main.sm:1 in <main>", "breakpoint at main.sm:8 in <main>"},
+		},
+	}
+
+	for _, tt := range tests {
+		out, result, err := debug(t, tt.commands...)
+		if err != nil {
+			t.Fatalf("%v: unexpected error %s", tt.commands, err)
+		}
+		if result != "48" {
+			t.Errorf("%v: expected 48, got %s", tt.commands, result)
+		}
+
+		got := stops(out)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%v: wrong stops.\nwant=%q\ngot= %q", tt.commands, tt.expected, got)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	out, _, err := debug(t,
+		"b 5", "b 99", "b x", "b util:2", "b", "d 3",
+		"c", "stack", "locals", "locals 1", "locals 2", "locals 9",
+		"p x", "p base", "p missing", "p", "o", "locals", "globals", "list",
+		"unknown", "q",
+	)
+	if !errors.Is(err, ErrQuit) {
+		t.Fatalf("expected ErrQuit, got %v", err)
+	}
+
+	expected := []string{
+		"breakpoint set at main.sm:5",
+		"no code at main.sm:99",
+		`invalid location "x", expected line or file:line`,
+		"breakpoint set at util:2",
+		"  main.sm:5\n  util:2",
+		"no breakpoint at main.sm:3",
+		"breakpoint at util:2 in twice\n     2 |   x * 2",
+		"#0 twice at util:2\n#1 add at main.sm:4\n#2 <main> at main.sm:7",
+		"  x = 3",
+		"  a = 1\n  b = 2",
+		"the main program has no locals, see globals",
+		`invalid frame "9"`,
+		"x = 3",
+		"base = 10",
+		"missing is not defined",
+		"usage: print name",
+		"breakpoint at main.sm:5 in add\n     5 |   sum + base",
+		"  a = 1\n  b = 2\n  sum = 6",
+		"  util = {twice: Closure[0x",
+		"  base = 10\n  add = Closure[0x",
+		"     2 | let base = 10;\n     3 | let add = fn(a, b) {\n     4 |   let sum = util[\"twice\"](a + b);\n=>   5 |   sum + base\n     6 | };\n     7 | let first = add(1, 2);\n     8 | add(first, 3)",
+		`unknown command "unknown"`,
+	}
+	for _, s := range expected {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %q in the output:\n%s", s, out)
+		}
+	}
+}
+
+func TestEndOfCommands(t *testing.T) {
+	out, _, err := debug(t, "s")
+	if !errors.Is(err, ErrQuit) {
+		t.Fatalf("expected ErrQuit, got %v", err)
+	}
+
+	// stepping from the import enters the module
+	if got := stops(out); len(got) != 2 || got[1] != "util:1 in util" {
+		t.Errorf("expected to stop in the module, got %q", got)
+	}
+}
@@ -0,0 +1,238 @@
+// Package disasm prints compiled bytecode with every function of the constant pool,
+// the values of the constants, labels for jump targets and the source lines
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"protiumx.dev/simia/code"
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/value"
+)
+
+type Options struct {
+	// Source is the text of the main program. When empty only line numbers are printed
+	Source string
+	// Exclude lists files whose functions are not printed, e.g. prelude.File
+	Exclude []string
+	// FirstConstant skips the functions of the constants before it, e.g. the ones
+	// compiled by previous REPL inputs
+	FirstConstant int
+	// FirstInstruction skips the main instructions before it, e.g. the prelude that a
+	// compiled file runs first
+	FirstInstruction int
+}
+
+// Disassemble writes the main instructions followed by the compiled functions in
+// the constant pool
+func Disassemble(w io.Writer, b *compiler.Bytecode, opts Options) error {
+	d := &disassembler{
+		bytecode: b,
+		lines:    strings.Split(opts.Source, "\n"),
+		globals:  make(map[int]string, len(b.Globals)),
+	}
+	if opts.Source == "" {
+		d.lines = nil
+	}
+
+	for name, index := range b.Globals {
+		d.globals[index] = name
+	}
+
+	d.function("main", "", b.Instructions, b.Lines, opts.FirstInstruction)
+	for i, constant := range b.Constants {
+		fn, ok := constant.(*value.CompiledFunction)
+		if !ok || i < opts.FirstConstant || excluded(opts.Exclude, fn.File) {
+			continue
+		}
+
+		d.out.WriteString("\n")
+		header := fmt.Sprintf("%s (args %d, locals %d)", functionName(i, fn), fn.ArgumentsCount, fn.LocalsCount)
+		if fn.File != "" {
+			header += " in " + fn.File
+		}
+		d.function(header, fn.File, fn.Instructions, fn.Lines, 0)
+	}
+
+	_, err := io.WriteString(w, d.out.String())
+	return err
+}
+
+// String returns the output of Disassemble
+func String(b *compiler.Bytecode, opts Options) string {
+	var out strings.Builder
+	Disassemble(&out, b, opts)
+	return out.String()
+}
+
+type disassembler struct {
+	bytecode *compiler.Bytecode
+	lines    []string
+	globals  map[int]string
+	out      strings.Builder
+}
+
+// function prints the instructions from the offset start
+func (d *disassembler) function(header, file string, ins code.Instructions, lines code.LineTable, start int) {
+	fmt.Fprintf(&d.out, "%s:\n", header)
+	labels := jumpLabels(ins)
+
+	line := 0
+	for i := start; i < len(ins); {
+		if l := lines.Line(i); l != 0 && l != line {
+			line = l
+			d.sourceLine(file, line)
+		}
+
+		if label, ok := labels[i]; ok {
+			fmt.Fprintf(&d.out, "%s:\n", label)
+		}
+
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&d.out, "  %04d  ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+
+		if i+1+def.Width() > len(ins) {
+			fmt.Fprintf(&d.out, "  %04d  ERROR: %s is truncated\n", i, def.Name)
+			return
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		instruction := d.instruction(code.Opcode(ins[i]), def, operands, labels)
+		if comment := d.comment(code.Opcode(ins[i]), operands); comment != "" {
+			fmt.Fprintf(&d.out, "  %04d  %-24s ; %s\n", i, instruction, comment)
+		} else {
+			fmt.Fprintf(&d.out, "  %04d  %s\n", i, instruction)
+		}
+
+		i += 1 + read
+	}
+
+	// jumps past the last instruction
+	if label, ok := labels[len(ins)]; ok {
+		fmt.Fprintf(&d.out, "%s:\n", label)
+	}
+}
+
+func (d *disassembler) sourceLine(file string, line int) {
+	if file == "" && line <= len(d.lines) {
+		fmt.Fprintf(&d.out, "%4d | %s\n", line, strings.TrimSpace(d.lines[line-1]))
+		return
+	}
+
+	if file == "" {
+		fmt.Fprintf(&d.out, "%4d |\n", line)
+		return
+	}
+
+	fmt.Fprintf(&d.out, "     %s:%d\n", file, line)
+}
+
+func (d *disassembler) instruction(op code.Opcode, def *code.Definition, operands []int, labels map[int]string) string {
+	parts := []string{def.Name}
+	for i, operand := range operands {
+		if i == 0 && (op == code.OpJump || op == code.OpJumpIfBranch) {
+			parts = append(parts, labels[operand])
+			continue
+		}
+		parts = append(parts, fmt.Sprint(operand))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// comment describes the operands of the instruction
+func (d *disassembler) comment(op code.Opcode, operands []int) string {
+	switch op {
+	case code.OpConstant:
+		return d.constant(operands[0])
+	case code.OpClosure:
+		return d.constant(operands[0])
+	case code.OpImport:
+		return fmt.Sprintf("%s, cached in %s", d.constant(operands[0]), d.global(operands[1]))
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return d.global(operands[0])
+	case code.OpGetBuiltin:
+		if builtins := value.Builtins(); operands[0] < len(builtins) {
+			return builtins[operands[0]].Name
+		}
+	}
+
+	return ""
+}
+
+func (d *disassembler) constant(index int) string {
+	if index >= len(d.bytecode.Constants) {
+		return "invalid constant"
+	}
+
+	switch constant := d.bytecode.Constants[index].(type) {
+	case *value.String:
+		return fmt.Sprintf("%q", constant.Value)
+	case *value.CompiledFunction:
+		return functionName(index, constant)
+	default:
+		return constant.Inspect()
+	}
+}
+
+func (d *disassembler) global(index int) string {
+	if name, ok := d.globals[index]; ok {
+		return name
+	}
+	return fmt.Sprintf("global %d", index)
+}
+
+func functionName(index int, fn *value.CompiledFunction) string {
+	if fn.Name == "" {
+		return fmt.Sprintf("fn#%d", index)
+	}
+	return fmt.Sprintf("fn#%d %s", index, fn.Name)
+}
+
+// jumpLabels names the jump targets in order of their offset
+func jumpLabels(ins code.Instructions) map[int]string {
+	targets := []int{}
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			i++
+			continue
+		}
+
+		if i+1+def.Width() > len(ins) {
+			break
+		}
+
+		op := code.Opcode(ins[i])
+		if op == code.OpJump || op == code.OpJumpIfBranch {
+			targets = append(targets, int(code.ReadUint16(ins[i+1:])))
+		}
+		i += 1 + def.Width()
+	}
+
+	sort.Ints(targets)
+	labels := make(map[int]string, len(targets))
+	for _, target := range targets {
+		if _, ok := labels[target]; !ok {
+			labels[target] = fmt.Sprintf("L%d", len(labels)+1)
+		}
+	}
+
+	return labels
+}
+
+func excluded(files []string, file string) bool {
+	for _, f := range files {
+		if f == file {
+			return true
+		}
+	}
+	return false
+}
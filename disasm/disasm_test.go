@@ -0,0 +1,131 @@
+package disasm
+
+import (
+	"testing"
+
+	"protiumx.dev/simia/code"
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/value"
+)
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+
+	comp := compiler.New(compiler.WithResolver(module.MapResolver{"lib/m": "export let a = 1;"}))
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return comp.Bytecode()
+}
+
+func TestDisassemble(t *testing.T) {
+	input := `import "lib/m";
+let max = fn(a, b) {
+  if (a > b) { a } else { b }
+};
+len(max(1, "two"))`
+
+	expected := `main:
+   1 | import "lib/m";
+  0000  OpImport 2 0             ; fn#2 lib/m, cached in import:lib/m
+  0005  OpSetGlobal 1            ; m
+   2 | let max = fn(a, b) {
+  0008  OpClosure 3 0            ; fn#3 max
+  0012  OpSetGlobal 2            ; max
+   5 | len(max(1, "two"))
+  0015  OpGetBuiltin 0           ; len
+  0017  OpGetGlobal 2            ; max
+  0020  OpConstant 4             ; 1
+  0023  OpConstant 5             ; "two"
+  0026  OpCall 2
+  0028  OpCall 1
+  0030  OpPop
+
+fn#2 lib/m (args 0, locals 1) in lib/m:
+     lib/m:1
+  0000  OpConstant 0             ; 1
+  0003  OpSetLocal 0
+  0005  OpConstant 1             ; "a"
+  0008  OpGetLocal 0
+  0010  OpHash 2
+  0013  OpReturnValue
+
+fn#3 max (args 2, locals 2):
+   3 | if (a > b) { a } else { b }
+  0000  OpGetLocal 0
+  0002  OpGetLocal 1
+  0004  OpGreaterThan
+  0005  OpJumpBranch L1
+  0008  OpGetLocal 0
+  0010  OpJump L2
+L1:
+  0013  OpGetLocal 1
+L2:
+  0015  OpReturnValue
+`
+
+	if result := String(compile(t, input), Options{Source: input}); result != expected {
+		t.Errorf("wrong disassembly.\nwant:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestDisassembleOptions(t *testing.T) {
+	bytecode := compile(t, "let f = fn() { 1 };\nlet g = fn() { 2 };\nif (true) { 3 }")
+
+	expected := `main:
+   1 |
+  0000  OpClosure 1 0            ; fn#1 f
+  0004  OpSetGlobal 0            ; f
+   2 |
+  0007  OpClosure 3 0            ; fn#3 g
+  0011  OpSetGlobal 1            ; g
+   3 |
+  0014  OpTrue
+  0015  OpJumpBranch L1
+  0018  OpConstant 4             ; 3
+  0021  OpJump L2
+L1:
+  0024  OpNil
+L2:
+  0025  OpPop
+
+fn#3 g (args 0, locals 0):
+   2 |
+  0000  OpConstant 2             ; 2
+  0003  OpReturnValue
+`
+
+	if result := String(bytecode, Options{FirstConstant: 2}); result != expected {
+		t.Errorf("wrong disassembly.\nwant:\n%s\ngot:\n%s", expected, result)
+	}
+}
+
+func TestDisassembleInvalidInstructions(t *testing.T) {
+	bytecode := &compiler.Bytecode{
+		Instructions: append(code.Instructions{250}, code.Make(code.OpJump, 4)...),
+		Constants:    []value.Value{&value.CompiledFunction{Instructions: code.Instructions{byte(code.OpConstant), 1}}},
+	}
+
+	expected := `main:
+  0000  ERROR: opcode 250 undefined
+  0001  OpJump L1
+L1:
+
+fn#0 (args 0, locals 0):
+  0000  ERROR: OpConstant is truncated
+`
+
+	if result := String(bytecode, Options{}); result != expected {
+		t.Errorf("wrong disassembly.\nwant:\n%s\ngot:\n%s", expected, result)
+	}
+}
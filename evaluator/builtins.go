@@ -1,11 +1,43 @@
 package evaluator
 
 import (
+	"bufio"
+	"io"
+	"math/rand"
+
 	"protiumx.dev/simia/value"
 )
 
-var builtins = map[string]*value.Builtin{
-	"len":    value.GetBuiltinByName("len"),
-	"append": value.GetBuiltinByName("append"),
-	"log":    value.GetBuiltinByName("log"),
+// Call lets builtins call back into evaluated functions
+func (e *Evaluator) Call(fn value.Value, args ...value.Value) value.Value {
+	result := e.applyFunction(fn, args)
+	if result == nil {
+		return NIL
+	}
+
+	return result
+}
+
+func (e *Evaluator) Abort(err error) value.Value {
+	return e.abort(err)
+}
+
+func (e *Evaluator) Rand() *rand.Rand {
+	return e.rand
+}
+
+func (e *Evaluator) Permissions() value.Permissions {
+	return e.permissions
+}
+
+func (e *Evaluator) Stdin() *bufio.Reader {
+	return e.stdin
+}
+
+func (e *Evaluator) Stdout() io.Writer {
+	return e.stdout
+}
+
+func (e *Evaluator) Stderr() io.Writer {
+	return e.stderr
 }
@@ -1,28 +1,145 @@
 package evaluator
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
 
 	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/module"
 	"protiumx.dev/simia/token"
 	"protiumx.dev/simia/value"
 )
 
 const loopLimit = 10000
 
+// MaxCallDepth is the number of nested function calls allowed without WithLimits, the
+// same as the frames of the VM. Deeper recursion would overflow the Go stack
+const MaxCallDepth = 1<<10 - 1
+
 var (
-	NIL   = &value.Nil{}
-	TRUE  = &value.Boolean{Value: true}
-	FALSE = &value.Boolean{Value: false}
+	NIL   = value.NIL
+	TRUE  = value.TRUE
+	FALSE = value.FALSE
 )
 
+type Evaluator struct {
+	rand        *rand.Rand
+	permissions value.Permissions
+	stdin       *bufio.Reader
+	stdout      io.Writer
+	stderr      io.Writer
+	limits      value.Limits
+	budget      *value.Budget
+	depth       int
+	err         error // limit error that stopped the evaluation
+	loader      *module.Loader
+	modules     map[string]*value.Hash // exports of the imported modules by path
+}
+
+type Option func(*Evaluator)
+
+// WithSeed makes builtins that use randomness reproducible
+func WithSeed(seed int64) Option {
+	return func(e *Evaluator) {
+		e.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithPermissions grants capabilities to the script. By default none are granted
+func WithPermissions(p value.Permissions) Option {
+	return func(e *Evaluator) {
+		e.permissions = p
+	}
+}
+
+// WithStdin sets the input read by `read_line`. Defaults to os.Stdin
+func WithStdin(r io.Reader) Option {
+	return func(e *Evaluator) {
+		e.stdin = bufio.NewReader(r)
+	}
+}
+
+// WithStdout sets the writer used by `log`. Defaults to os.Stdout
+func WithStdout(w io.Writer) Option {
+	return func(e *Evaluator) {
+		e.stdout = w
+	}
+}
+
+// WithStderr sets the writer used by `log_error`. Defaults to os.Stderr
+func WithStderr(w io.Writer) Option {
+	return func(e *Evaluator) {
+		e.stderr = w
+	}
+}
+
+// WithResolver sets where the modules loaded with `import` are read from
+func WithResolver(r module.Resolver) Option {
+	return func(e *Evaluator) {
+		e.loader = module.NewLoader(r)
+	}
+}
+
+// WithLimits bounds the steps, call depth and time used by EvalContext
+func WithLimits(l value.Limits) Option {
+	return func(e *Evaluator) {
+		e.limits = l
+	}
+}
+
+func New(opts ...Option) *Evaluator {
+	e := &Evaluator{
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		permissions: value.PermNone,
+		stdin:       bufio.NewReader(os.Stdin),
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		loader:      module.NewLoader(nil),
+		modules:     make(map[string]*value.Hash),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Eval evaluates the node with a default Evaluator
 func Eval(node ast.Node, env *value.Environment) value.Value {
+	return New().Eval(node, env)
+}
+
+// EvalContext evaluates the node until it finishes, a limit is exceeded or ctx is done.
+// Exceeding a limit returns a *value.LimitError and cancellation returns the context error
+func (e *Evaluator) EvalContext(ctx context.Context, node ast.Node, env *value.Environment) (value.Value, error) {
+	e.budget, e.depth, e.err = value.NewBudget(ctx, e.limits), 0, nil
+	defer func() { e.budget = nil }()
+
+	result := e.Eval(node, env)
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return result, nil
+}
+
+func (e *Evaluator) Eval(node ast.Node, env *value.Environment) value.Value {
+	if err := e.budget.Step(); err != nil {
+		return e.abort(err)
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 
 	case *ast.IntegerLiteral:
 		return &value.Integer{Value: node.Value}
@@ -34,7 +151,7 @@ func Eval(node ast.Node, env *value.Environment) value.Value {
 		return booleanValue(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
@@ -47,45 +164,56 @@ func Eval(node ast.Node, env *value.Environment) value.Value {
 			if !ok {
 				return newError("expected function call in pipiline expression. got=%T", node.Right)
 			}
-			// prepend the left node to the fn arguments
-			fnCall.Arguments = append([]ast.Expression{node.Left}, fnCall.Arguments...)
-			return Eval(node.Right, env)
+			// evaluate as a call with the left node prepended to the fn arguments.
+			// The AST is not modified so it can be evaluated again or concurrently
+			return e.Eval(&ast.CallExpression{
+				Token:     fnCall.Token,
+				Function:  fnCall.Function,
+				Arguments: append([]ast.Expression{node.Left}, fnCall.Arguments...),
+			}, env)
 		}
 
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
 
 	case *ast.BlockStatment:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
 
 	case *ast.ForExpression:
-		return evalForExpression(node, env)
+		return e.evalForExpression(node, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &value.Return{Value: val}
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := e.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
 
+	case *ast.ImportStatement:
+		exports := e.evalImport(node.Path)
+		if isError(exports) {
+			return exports
+		}
+		env.Set(node.Name.Value, exports)
+
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
@@ -95,18 +223,18 @@ func Eval(node ast.Node, env *value.Environment) value.Value {
 		return &value.Function{Parameters: params, Env: env, Body: body}
 
 	case *ast.CallExpression:
-		fn := Eval(node.Function, env)
+		fn := e.Eval(node.Function, env)
 		if isError(fn) {
 			return fn
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(fn, args)
+		return e.applyFunction(fn, args)
 
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
@@ -114,12 +242,12 @@ func Eval(node ast.Node, env *value.Environment) value.Value {
 		return &value.Array{Elements: elements}
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		index := Eval(node.Index, env)
+		index := e.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
@@ -127,10 +255,10 @@ func Eval(node ast.Node, env *value.Environment) value.Value {
 		return evalIndexExpression(left, index)
 
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
 
 	case *ast.AssignExpression:
-		val := Eval(node.Value, env)
+		val := e.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
@@ -153,10 +281,10 @@ func booleanValue(input bool) *value.Boolean {
 	return FALSE
 }
 
-func evalProgram(program *ast.Program, env *value.Environment) value.Value {
+func (e *Evaluator) evalProgram(program *ast.Program, env *value.Environment) value.Value {
 	var ret value.Value
 	for _, stmt := range program.Statements {
-		ret = Eval(stmt, env)
+		ret = e.Eval(stmt, env)
 
 		switch retType := ret.(type) {
 		case *value.Return:
@@ -168,10 +296,10 @@ func evalProgram(program *ast.Program, env *value.Environment) value.Value {
 	return ret
 }
 
-func evalBlockStatement(block *ast.BlockStatment, env *value.Environment) value.Value {
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatment, env *value.Environment) value.Value {
 	var ret value.Value
 	for _, stmt := range block.Statements {
-		ret = Eval(stmt, env)
+		ret = e.Eval(stmt, env)
 		if ret != nil {
 			retType := ret.Type()
 			if retType == value.RETURN_VALUE || retType == value.ERROR_VALUE {
@@ -272,22 +400,22 @@ func rangeValue(left, right int64) value.Value {
 	return &value.Range{Start: left, End: right}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *value.Environment) value.Value {
-	condition := Eval(ie.Condition, env)
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *value.Environment) value.Value {
+	condition := e.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.Eval(ie.Alternative, env)
 	} else {
 		return NIL
 	}
 }
 
-func evalForExpression(exp *ast.ForExpression, env *value.Environment) value.Value {
+func (e *Evaluator) evalForExpression(exp *ast.ForExpression, env *value.Environment) value.Value {
 	switch condition := exp.Condition.(type) {
 	case *ast.InExpression:
 		loopEnv := value.NewEnvironment(env)
@@ -296,23 +424,23 @@ func evalForExpression(exp *ast.ForExpression, env *value.Environment) value.Val
 			return newError("expected identifier on left side of in-expression. got=%T", condition.Element)
 		}
 
-		iterable := Eval(condition.Iterable, env)
+		iterable := e.Eval(condition.Iterable, env)
 		if isError(iterable) {
 			return iterable
 		}
 
 		switch iterable := iterable.(type) {
 		case *value.Range:
-			evalForLoopRange(elementIdentifier, iterable, exp.Body, loopEnv)
+			e.evalForLoopRange(elementIdentifier, iterable, exp.Body, loopEnv)
 		case *value.Array:
-			evalForLoopArray(elementIdentifier, iterable, exp.Body, loopEnv)
+			e.evalForLoopArray(elementIdentifier, iterable, exp.Body, loopEnv)
 		default:
 			return newError("for-loop not supported for type %s", iterable.Type())
 		}
 
 	case *ast.InfixExpression, *ast.Identifier, *ast.Boolean, *ast.IntegerLiteral:
 		loopEnv := value.NewEnvironment(env)
-		return evalForLoopCondition(condition, exp.Body, loopEnv)
+		return e.evalForLoopCondition(condition, exp.Body, loopEnv)
 	default:
 		return newError("invalid %T expression in for-loop", exp.Condition)
 	}
@@ -320,31 +448,57 @@ func evalForExpression(exp *ast.ForExpression, env *value.Environment) value.Val
 	return NIL
 }
 
-func evalForLoopCondition(condition ast.Expression, body *ast.BlockStatment, env *value.Environment) value.Value {
+// evalImport evaluates the module once in its own environment and returns a hash with its exports
+func (e *Evaluator) evalImport(path string) value.Value {
+	if exports, ok := e.modules[path]; ok {
+		return exports
+	}
+
+	program, err := e.loader.Enter(path)
+	if err != nil {
+		return newError("%s", err)
+	}
+	defer e.loader.Exit()
+
+	env := value.NewEnvironment(nil)
+	if result := e.Eval(program, env); isError(result) {
+		return result
+	}
+
+	exports := &value.Hash{Pairs: make(map[string]value.Value)}
+	for _, name := range module.Exports(program) {
+		exports.Pairs[name], _ = env.Get(name)
+	}
+
+	e.modules[path] = exports
+	return exports
+}
+
+func (e *Evaluator) evalForLoopCondition(condition ast.Expression, body *ast.BlockStatment, env *value.Environment) value.Value {
 	loopCounter := 0
 	for {
 		if loopCounter > loopLimit {
 			return newError("max loop call exceed")
 		}
 
-		e := Eval(condition, env)
-		if isError(e) {
-			return e
+		result := e.Eval(condition, env)
+		if isError(result) {
+			return result
 		}
 
-		if !isTruthy(e) {
+		if !isTruthy(result) {
 			return NIL
 		}
 
-		e = evalBlockStatement(body, env)
-		if isError(e) {
-			return e
+		result = e.evalBlockStatement(body, env)
+		if isError(result) {
+			return result
 		}
 		loopCounter++
 	}
 }
 
-func evalForLoopArray(
+func (e *Evaluator) evalForLoopArray(
 	elementIdentifier *ast.Identifier,
 	array *value.Array,
 	body *ast.BlockStatment,
@@ -352,7 +506,7 @@ func evalForLoopArray(
 ) value.Value {
 	for _, element := range array.Elements {
 		env.Set(elementIdentifier.Value, element)
-		r := evalBlockStatement(body, env)
+		r := e.evalBlockStatement(body, env)
 		if isError(r) {
 			return r
 		}
@@ -360,35 +514,28 @@ func evalForLoopArray(
 	return NIL
 }
 
-func evalForLoopRange(
+func (e *Evaluator) evalForLoopRange(
 	elementIdentifier *ast.Identifier,
 	rangeVal *value.Range,
 	body *ast.BlockStatment,
 	env *value.Environment,
 ) value.Value {
-	ascDirection := true
+	step := int64(1)
 	if rangeVal.End < rangeVal.Start {
-		ascDirection = false
+		step = -1
 	}
 
-	currentValue := value.Integer{Value: rangeVal.Start}
-	env.Set(elementIdentifier.Value, &currentValue)
 	loopCounter := 0
-
-	for currentValue.Value != rangeVal.End {
+	for i := rangeVal.Start; i != rangeVal.End; i += step {
 		if loopCounter > loopLimit {
 			return newError("max loop call exceed")
 		}
 
-		e := evalBlockStatement(body, env)
-		if isError(e) {
-			return e
-		}
-
-		if ascDirection {
-			currentValue.Value++
-		} else {
-			currentValue.Value--
+		// bind a new integer on every iteration since values are shared by reference
+		env.Set(elementIdentifier.Value, &value.Integer{Value: i})
+		result := e.evalBlockStatement(body, env)
+		if isError(result) {
+			return result
 		}
 		loopCounter++
 	}
@@ -400,18 +547,18 @@ func evalIdentifier(node *ast.Identifier, env *value.Environment) value.Value {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin := value.GetBuiltinByName(node.Value); builtin != nil {
 		return builtin
 	}
 
 	return newError("%s not defined", node.Value)
 }
 
-func evalExpressions(exps []ast.Expression, env *value.Environment) []value.Value {
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *value.Environment) []value.Value {
 	ret := make([]value.Value, len(exps))
 
 	for i, exp := range exps {
-		evaluated := Eval(exp, env)
+		evaluated := e.Eval(exp, env)
 		if isError(evaluated) {
 			return []value.Value{evaluated}
 		}
@@ -432,15 +579,28 @@ func evalStringInfixExpression(op string, left, right value.Value) value.Value {
 	return &value.String{Value: leftVal + rightVal}
 }
 
-func applyFunction(fnValue value.Value, args []value.Value) value.Value {
+func (e *Evaluator) applyFunction(fnValue value.Value, args []value.Value) value.Value {
 	switch fn := fnValue.(type) {
 	case *value.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+
+		e.depth++
+		defer func() { e.depth-- }()
+		if err := e.budget.CheckDepth(e.depth); err != nil {
+			return e.abort(err)
+		}
+		if e.depth > MaxCallDepth {
+			return e.abort(&value.LimitError{Kind: value.CallDepthLimit, Limit: MaxCallDepth})
+		}
+
 		fnEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, fnEnv)
+		evaluated := e.Eval(fn.Body, fnEnv)
 		return unwrapReturnValue(evaluated)
 
 	case *value.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		if result := fn.Call(e, args...); result != nil {
 			return result
 		}
 
@@ -457,6 +617,12 @@ func evalIndexExpression(left, index value.Value) value.Value {
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == value.HASH_VALUE:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == value.HOST_VALUE && index.Type() == value.STRING_VALUE:
+		member, err := left.(*value.HostObject).Member(index.(*value.String).Value)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return member
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -474,11 +640,11 @@ func evalArrayIndexExpression(arrayVal, index value.Value) value.Value {
 	return array.Elements[idx]
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *value.Environment) value.Value {
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *value.Environment) value.Value {
 	pairs := make(map[string]value.Value)
 
 	for k, v := range node.Pairs {
-		key := Eval(k, env)
+		key := e.Eval(k, env)
 		if isError(key) {
 			return key
 		}
@@ -491,7 +657,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *value.Environment) value.Value
 			return newError("key is not string: %s", key.Type())
 		}
 
-		value := Eval(v, env)
+		value := e.Eval(v, env)
 		if isError(value) {
 			return value
 		}
@@ -551,6 +717,12 @@ func isTruthy(val value.Value) bool {
 	}
 }
 
+// abort records err so EvalContext can return it and unwinds the evaluation with an error value
+func (e *Evaluator) abort(err error) value.Value {
+	e.err = err
+	return newError("%s", err)
+}
+
 func newError(format string, args ...any) *value.Error {
 	return &value.Error{Message: fmt.Sprintf(format, args...)}
 }
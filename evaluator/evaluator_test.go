@@ -1,9 +1,15 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/module"
 	"protiumx.dev/simia/parser"
 	"protiumx.dev/simia/value"
 )
@@ -424,7 +430,7 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len(1)`, "argument to `len` must be STRING or ARRAY or HASH, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 		{`len([1, 2, 3])`, 3},
 		{`len([])`, 0},
@@ -597,3 +603,478 @@ func TestAssign(t *testing.T) {
 	evaluated := testEval(input)
 	testIntegerValue(t, evaluated, 9)
 }
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", "[2, 4, 6]"},
+		{"map(1..4, fn(x) { x + 1 })", "[2, 3, 4]"},
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", "[3, 4]"},
+		{"reduce([1, 2, 3], fn(acc, x) { acc + x }, 0)", "6"},
+		{`sort_by(["ccc", "a", "bb"], fn(s) { len(s) })`, "[a, bb, ccc]"},
+		{"let sum = 0; each([1, 2], fn(x) { sum = sum + x }); sum", "3"},
+		{"[1, 2, 3] |> map(fn(x) { x * x }) |> filter(fn(x) { x > 1 })", "[4, 9]"},
+		{"map([1], len)", "ERROR: argument to `len` must be STRING or ARRAY or HASH, got INTEGER"},
+		{"map([1], 1)", "ERROR: argument to `map` must be FN, got INTEGER"},
+		{"map([1], fn(a, b) { a })", "ERROR: wrong number of arguments: want=2, got=1"},
+		{`sort_by([1, 2], fn(x) { if (x > 1) { "a" } else { 1 } })`, "ERROR: sort_by keys must have the same type, got INTEGER and STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys({"b": 1, "a": 2})`, "[a, b]"},
+		{`values({"b": 1, "a": 2})`, "[2, 1]"},
+		{`entries({"b": 1, "a": 2})`, "[[a, 2], [b, 1]]"},
+		{`has({"a": 1}, "a")`, "true"},
+		{`has({"a": 1}, "b") == false`, "true"},
+		{`get({"a": 1}, "a", 0)`, "1"},
+		{`get({"a": 1}, "b", 0)`, "0"},
+		{`delete({"a": 1, "b": 2}, "a")`, "{b: 2}"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{a: 1}"},
+		{`merge({"a": 1, "b": 1}, {"b": 2}, {"c": 3})`, "{a: 1, b: 2, c: 3}"},
+		{`len({"a": 1, "b": 2})`, "2"},
+		{`keys([])`, "ERROR: argument to `keys` must be HASH, got ARRAY"},
+		{`has({}, 1)`, "ERROR: argument to `has` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"abs(-3)", "3"},
+		{"min(3, 1, 2)", "1"},
+		{"max([3, 5, 2])", "5"},
+		{"pow(2, 10)", "1024"},
+		{"pow(7, 0)", "1"},
+		{"clamp(15, 0, 10)", "10"},
+		{"clamp(-1, 0, 10)", "0"},
+		{"sqrt(17)", "4"},
+		{"sqrt(9223372036854775807)", "3037000499"},
+		{"pow(2, -1)", "ERROR: negative exponent for `pow`: -1"},
+		{"pow(2, 62)", "4611686018427387904"},
+		{"pow(-2, 63)", "-9223372036854775808"},
+		{"pow(2, 63)", "ERROR: integer overflow in `pow`: 2 ** 63"},
+		{"pow(2, 64)", "ERROR: integer overflow in `pow`: 2 ** 64"},
+		{"pow(-3037000500, 2)", "ERROR: integer overflow in `pow`: -3037000500 ** 2"},
+		{"pow(-1, 9223372036854775807)", "-1"},
+		{"abs(-9223372036854775807)", "9223372036854775807"},
+		{"abs(-9223372036854775807 - 1)", "ERROR: integer overflow in `abs`: -9223372036854775808"},
+		{`abs("a")`, "ERROR: argument to `abs` must be INTEGER, got STRING"},
+		{"min([])", "ERROR: `min` requires at least one integer"},
+		{"rand_int(5, 5)", "ERROR: invalid bounds for `rand_int`: 5 >= 5"},
+		{"let n = rand_int(3, 4); n", "3"},
+		{"let n = rand_int(-9223372036854775807, 9223372036854775807); n < 9223372036854775807", "true"},
+		{"let n = rand_int(-9223372036854775807 - 1, 9223372036854775807); n < 9223372036854775807", "true"},
+		{"rand_int(9223372036854775806, 9223372036854775807)", "9223372036854775806"},
+		{"rand_int(-9223372036854775807 - 1, -9223372036854775807)", "-9223372036854775808"},
+		{"len(shuffle([1, 2, 3]))", "3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSeededRandom(t *testing.T) {
+	input := "[rand_int(0, 1000), rand_int(0, 1000), shuffle([1, 2, 3, 4, 5])]"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	first := New(WithSeed(42)).Eval(program, value.NewEnvironment(nil))
+	second := New(WithSeed(42)).Eval(program, value.NewEnvironment(nil))
+	if first.Inspect() != second.Inspect() {
+		t.Errorf("seeded evaluations differ. first=%q, second=%q", first.Inspect(), second.Inspect())
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		document string
+		expected string
+	}{
+		{`json_encode({"b": [1, true], "a": "x"})`, "", `{"a":"x","b":[1,true]}`},
+		{`json_encode([1, {"a": 2}], true)`, "", "[\n  1,\n  {\n    \"a\": 2\n  }\n]"},
+		{`json_encode(fn() {})`, "", "ERROR: json_encode: unsupported type FN at $"},
+		{`json_encode({"a": [1, len]})`, "", `ERROR: json_encode: unsupported type BUILTIN at $["a"][1]`},
+		{`json_decode(doc)`, `{"a": [1, -2], "b": {"c": null}}`, "{a: [1, -2], b: {c: nil}}"},
+		{`json_decode(doc)["a"]`, `{"a": "<tag>"}`, "<tag>"},
+		{`json_encode(json_decode(doc))`, `{"a": "<tag>"}`, `{"a":"<tag>"}`},
+		{`json_decode(doc)`, "{\n  \"a\": 1.5\n}", "ERROR: json_decode: number 1.5 is not an integer at line 2, column 8"},
+		{`json_decode(doc)`, "[1,\n 2,]", "ERROR: json_decode: invalid character ',' looking for beginning of value at line 2, column 4"},
+		{`json_decode(doc)`, `[1, 2`, "ERROR: json_decode: unexpected end of JSON input at line 1, column 6"},
+		{`json_decode(doc)`, `1 2`, "ERROR: json_decode: unexpected data after top-level value at line 1, column 4"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		env := value.NewEnvironment(nil)
+		env.Set("doc", &value.String{Value: tt.document})
+
+		evaluated := Eval(program, env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTypeBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`type(1)`, "int"},
+		{`type("a")`, "string"},
+		{`type([1])`, "array"},
+		{`type({})`, "hash"},
+		{`type(1..2)`, "range"},
+		{`type(fn() {})`, "fn"},
+		{`type(len)`, "fn"},
+		{`str(12) + "!"`, "12!"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`int("42") + 1`, "43"},
+		{`int("-7")`, "-7"},
+		{`int(true)`, "1"},
+		{`int("abc")`, `ERROR: cannot convert "abc" to int: invalid syntax`},
+		{`int("99999999999999999999")`, `ERROR: cannot convert "99999999999999999999" to int: out of range`},
+		{`int([])`, "ERROR: cannot convert array to int"},
+		{`bool(0)`, "false"},
+		{`bool("true")`, "true"},
+		{`bool("yes")`, `ERROR: cannot convert "yes" to bool`},
+		{`is_int(1)`, "true"},
+		{`is_string(1)`, "false"},
+		{`is_fn(fn(x) { x })`, "true"},
+		{`is_hash({})`, "true"},
+		{`is_nil([][0])`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHostBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SIMIA_TEST_ENV", "on")
+
+	tests := []struct {
+		input       string
+		permissions value.Permissions
+		expected    string
+	}{
+		{`read_file(dir + "/a.txt")`, value.PermNone, "ERROR: permission denied: `read_file` requires the read_file capability"},
+		{`write_file(dir + "/a.txt", "hi")`, value.PermReadFile, "ERROR: permission denied: `write_file` requires the write_file capability"},
+		{`write_file(dir + "/a.txt", "hi"); read_file(dir + "/a.txt")`, value.PermReadFile | value.PermWriteFile, "hi"},
+		{`list_dir(dir)`, value.PermListDir, "[a.txt]"},
+		{`read_file(dir + "/missing.txt")`, value.PermReadFile, "ERROR: read_file: open " + dir + "/missing.txt: no such file or directory"},
+		{`[read_line(), read_line(), read_line()]`, value.PermStdin, "[first, second, nil]"},
+		{`read_line()`, value.PermNone, "ERROR: permission denied: `read_line` requires the stdin capability"},
+		{`env("SIMIA_TEST_ENV")`, value.PermEnv, "on"},
+		{`is_nil(env("SIMIA_TEST_UNSET"))`, value.PermAll, "true"},
+		{`env("SIMIA_TEST_ENV")`, value.PermAll &^ value.PermEnv, "ERROR: permission denied: `env` requires the env capability"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		env := value.NewEnvironment(nil)
+		env.Set("dir", &value.String{Value: dir})
+
+		e := New(WithPermissions(tt.permissions), WithStdin(strings.NewReader("first\r\nsecond")))
+		evaluated := e.Eval(program, env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	err := value.RegisterBuiltin(&value.Builtin{
+		Name:   "eval_twice",
+		Params: []value.Param{{Name: "n", Types: []value.ValueType{value.INTEGER_VALUE}}},
+		Fn: func(_ value.Runtime, args ...value.Value) value.Value {
+			return &value.Integer{Value: args[0].(*value.Integer).Value * 2}
+		},
+	})
+	if err != nil {
+		t.Fatalf("register error: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`eval_twice(21)`, "42"},
+		{`map([1, 2], eval_twice)`, "[2, 4]"},
+		{`eval_twice("a")`, "ERROR: argument to `eval_twice` must be INTEGER, got STRING"},
+		{`eval_twice()`, "ERROR: wrong number of arguments. got=0, want=1"},
+		{`json_encode(1, true, 2)`, "ERROR: wrong number of arguments. got=3, want at most 2"},
+		{`merge()`, "ERROR: wrong number of arguments. got=0, want at least 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	err = value.RegisterBuiltin(&value.Builtin{Name: "len", Fn: func(value.Runtime, ...value.Value) value.Value { return nil }})
+	if err == nil || err.Error() != "builtin len already registered" {
+		t.Errorf("expected duplicate builtin error. got=%v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   value.Limits
+		expected value.LimitKind
+	}{
+		{"for (true) { 1 }", value.Limits{MaxSteps: 1000}, value.StepLimit},
+		{"let f = fn(x) { f(x + 1) }; f(0)", value.Limits{MaxCallDepth: 50}, value.CallDepthLimit},
+		{"map(1..100, fn(x) { x * 2 })", value.Limits{MaxSteps: 30}, value.StepLimit},
+		{"let f = fn(x) { f(x) }; map([1], f); 5", value.Limits{MaxCallDepth: 10}, value.CallDepthLimit},
+		{"let f = fn() { f() }; f()", value.Limits{}, value.CallDepthLimit},
+		{"let f = fn() { f() }; f()", value.Limits{MaxCallDepth: 5000}, value.CallDepthLimit},
+		{"for (true) { 1 }", value.Limits{Timeout: time.Nanosecond}, value.TimeLimit},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		result, err := New(WithLimits(tt.limits)).EvalContext(context.Background(), program, value.NewEnvironment(nil))
+
+		var limitErr *value.LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("expected *value.LimitError for %q, got %v (%v)", tt.input, err, result)
+			continue
+		}
+
+		if limitErr.Kind != tt.expected {
+			t.Errorf("wrong limit for %q. want=%d, got=%d (%s)", tt.input, tt.expected, limitErr.Kind, limitErr)
+		}
+	}
+
+	program := parser.New(lexer.New("let f = fn(x) { x * 2 }; f(21)")).ParseProgram()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New().EvalContext(ctx, program, value.NewEnvironment(nil)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	e := New(WithLimits(value.Limits{MaxSteps: 100, MaxCallDepth: 1}))
+	for i := 0; i < 3; i++ {
+		result, err := e.EvalContext(context.Background(), program, value.NewEnvironment(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		testIntegerValue(t, result, 42)
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input string
+		// expected is the message of the assertion error, empty when the assertions pass
+		expected string
+	}{
+		{"assert(1 == 1); assert_eq([1, {\"a\": 2}], [1, {\"a\": 2}]); 1", ""},
+		{"assert(1 > 2); 1", "assertion failed"},
+		{`assert(false, "setup"); 1`, "setup: assertion failed"},
+		{"assert_eq([1, 2, 3], [1, 5, 3]); 1", "values are not equal\nexpected: [1, 5, 3]\n  actual: [1, 2, 3]\n              ^"},
+		{`assert_eq(1, "1"); 1`, "values are not equal\nexpected: 1 (string)\n  actual: 1 (int)"},
+		{"map([1, 2], fn(x) { assert(x < 2) }); 1", "assertion failed"},
+		{`assert_eq(assert_error(fn() { len(1) }, "must be"), "argument to ` + "`len`" + ` must be STRING or ARRAY or HASH, got INTEGER"); 1`, ""},
+		{"assert_error(fn() { 1 }); 1", "expected an error, got 1"},
+		{`assert_error(fn() { len(1) }, "oops"); 1`, `expected an error containing "oops", got "argument to ` + "`len`" + ` must be STRING or ARRAY or HASH, got INTEGER"`},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		_, err := New().EvalContext(context.Background(), program, value.NewEnvironment(nil))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+
+		var assertErr *value.AssertionError
+		if !errors.As(err, &assertErr) {
+			t.Errorf("expected *value.AssertionError for %q, got %v", tt.input, err)
+			continue
+		}
+
+		if assertErr.Message != tt.expected {
+			t.Errorf("wrong message for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, assertErr.Message)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var stdout, stderr strings.Builder
+	e := New(WithStdout(&stdout), WithStderr(&stderr))
+
+	program := parser.New(lexer.New(`log("hello", 1, [true]); log_error("oops"); each([1, 2], fn(x) { log(x) })`)).ParseProgram()
+	e.Eval(program, value.NewEnvironment(nil))
+
+	if expected := "hello\n1\n[true]\n1\n2\n"; stdout.String() != expected {
+		t.Errorf("wrong stdout. want=%q, got=%q", expected, stdout.String())
+	}
+
+	if expected := "oops\n"; stderr.String() != expected {
+		t.Errorf("wrong stderr. want=%q, got=%q", expected, stderr.String())
+	}
+}
+
+func TestConcurrentEval(t *testing.T) {
+	program := parser.New(lexer.New(`
+	let double = fn(x) { x * 2 };
+	let add = fn(x, y) { x + y };
+	let values = [];
+	for i in 0..3 { values = append(values, i) };
+	[3 |> add(7) |> double(), values]
+	`)).ParseProgram()
+
+	var wg sync.WaitGroup
+	results := make(chan string, 16)
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- New().Eval(program, value.NewEnvironment(nil)).Inspect()
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	for result := range results {
+		if result != "[20, [0, 1, 2]]" {
+			t.Errorf("wrong result. got=%s", result)
+		}
+	}
+}
+
+type point struct {
+	X, Y int
+}
+
+func (p point) Add(other point) point {
+	return point{X: p.X + other.X, Y: p.Y + other.Y}
+}
+
+func (p point) Scale(n int) *value.HostObject {
+	return value.NewHostObject(point{X: p.X * n, Y: p.Y * n}, pointClass)
+}
+
+var pointClass = &value.HostClass{Name: "Point", Fields: []string{"X", "Y"}, Methods: []string{"Add", "Scale"}}
+
+func init() {
+	pointClass.Classes = map[string]*value.HostClass{"Add": pointClass}
+}
+
+func TestHostObjects(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`p["X"] + p["Y"]`, "3"},
+		{`p["Add"](p)`, "<Point>"},
+		{`p["Add"](p)["Y"]`, "4"},
+		{`p["Scale"](3)["Y"]`, "6"},
+		{`let scale = p["Scale"]; [1, 2] |> map(fn(n) { scale(n)["X"] })`, "[1, 2]"},
+		{`p["Z"]`, "ERROR: Point has no member Z"},
+		{`p["Add"](1)`, "ERROR: argument 1 to `Point.Add`: cannot use INTEGER as evaluator.point"},
+	}
+
+	for _, tt := range tests {
+		env := value.NewEnvironment(nil)
+		env.Set("p", value.NewHostObject(point{X: 1, Y: 2}, pointClass))
+
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		if result := Eval(program, env).Inspect(); result != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	resolver := module.MapResolver{
+		"lib/strings": `
+		let sep = ", ";
+		export let join = fn(items) {
+			reduce(items, fn(acc, s) { if (len(acc) == 0) { s } else { acc + sep + s } }, "")
+		};
+		export let shout = fn(s) { s + "!" };
+		`,
+		"lib/counter": `
+		import "lib/strings";
+		log("loading counter");
+		export let label = fn(n) { strings["shout"]("count " + str(n)) };
+		`,
+		"cycle/a": `import "cycle/b"; export let x = 1;`,
+		"cycle/b": `import "cycle/a"; export let y = 2;`,
+		"lib/x":   `x`,
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/strings"; strings["join"](["a", "b", "c"])`, "a, b, c"},
+		{`import "lib/strings" as s; s["shout"]("hey")`, "hey!"},
+		{`import "lib/strings"; strings["sep"]`, "nil"},
+		{`import "lib/counter"; import "lib/counter" as again; let f = fn() { again["label"](2) }; f()`, "count 2!"},
+		{`import "lib/strings"; keys(strings)`, "[join, shout]"},
+		{`import "cycle/a"`, "ERROR: import cycle: cycle/a -> cycle/b -> cycle/a"},
+		{`import "lib/missing"`, `ERROR: module "lib/missing" not found`},
+		{`import "lib/strings"; sep`, "ERROR: sep not defined"},
+		{`let x = 1; import "lib/x"`, "ERROR: x not defined"},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		e := New(WithResolver(resolver), WithStdout(&out))
+
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		if result := e.Eval(program, value.NewEnvironment(nil)).Inspect(); result != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+
+		if strings.Count(out.String(), "loading counter") > 1 {
+			t.Errorf("module evaluated more than once for %q", tt.input)
+		}
+	}
+
+	program := parser.New(lexer.New(`import "lib/strings"`)).ParseProgram()
+	if result := Eval(program, value.NewEnvironment(nil)).Inspect(); !strings.Contains(result, "no module resolver configured") {
+		t.Errorf("expected resolver error, got %s", result)
+	}
+}
@@ -0,0 +1,559 @@
+// Package format prints simia programs in the canonical style: two spaces of
+// indentation, lines within Width where possible, the minimal parentheses and the
+// comments of the source
+package format
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/token"
+)
+
+// Width is the line length after which lists and pipelines are split over several lines
+const Width = 80
+
+const indentation = "  "
+
+// atomic is the precedence of expressions that never need parentheses
+const atomic = parser.INDEX + 1
+
+// ParseError holds all the errors reported by the parser
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse errors:\n\t" + strings.Join(e.Errors, "\n\t")
+}
+
+// Source formats a program. Programs with parse errors are not formatted
+func Source(src string) (string, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", &ParseError{Errors: p.Errors()}
+	}
+
+	// comments are placed before the statement that follows them, or at the end of
+	// the line when they follow a statement
+	comments := l.Comments()
+	printer := &printer{source: strings.Split(src, "\n"), comments: comments, used: make([]bool, len(comments))}
+	out := printer.statements(program.Statements, 0, token.Position{}, token.Position{}, false)
+	if out == "" {
+		return "", nil
+	}
+
+	return out + "\n", nil
+}
+
+type printer struct {
+	source   []string
+	comments []token.Token
+	used     []bool
+	// last is the last source line printed, used to keep blank lines and to find
+	// the comments at the end of a statement
+	last int
+}
+
+type state struct {
+	used []bool
+	last int
+}
+
+// save allows printing a node again in another layout
+func (p *printer) save() state {
+	return state{used: append([]bool{}, p.used...), last: p.last}
+}
+
+func (p *printer) restore(s state) {
+	p.used = s.used
+	p.last = s.last
+}
+
+// blankBefore reports whether the source has an empty line between the last line
+// printed and line
+func (p *printer) blankBefore(line int) bool {
+	for i := p.last + 1; i < line && i <= len(p.source); i++ {
+		if strings.TrimSpace(p.source[i-1]) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *printer) see(line int) {
+	if line > p.last {
+		p.last = line
+	}
+}
+
+// context describes where an expression is printed
+type context struct {
+	// min is the precedence the operator of the expression must exceed
+	min int
+	// follow is the precedence of the operator printed after the expression
+	follow int
+}
+
+// line is a statement or comment of a statement list
+type line struct {
+	text string
+	// comment is printed at the end of the line
+	comment string
+	blank   bool
+	// open is set for `if` and `for` statements printed without a semicolon
+	open      bool
+	isComment bool
+}
+
+// statements prints a statement list with the comments between start and end, a zero
+// end includes all the remaining comments. block is set for the body of blocks,
+// where the last expression is the value and has no semicolon
+func (p *printer) statements(stmts []ast.Statement, depth int, start, end token.Position, block bool) string {
+	lines := []line{}
+	comments := func(end token.Position) {
+		for _, c := range p.take(start, end) {
+			lines = append(lines, line{text: c.Literal, blank: len(lines) > 0 && p.blankBefore(c.Pos.Line), isComment: true})
+			p.see(c.Pos.Line)
+		}
+	}
+
+	for i, stmt := range stmts {
+		comments(stmt.Pos())
+
+		l := line{blank: len(lines) > 0 && p.blankBefore(stmt.Pos().Line)}
+		l.text, l.open = p.statement(stmt, depth, block && i == len(stmts)-1)
+
+		next := end
+		if i+1 < len(stmts) {
+			next = stmts[i+1].Pos()
+		}
+		if c, ok := p.trailing(stmt.Pos(), next); ok {
+			l.comment = c.Literal
+		}
+		lines = append(lines, l)
+	}
+	comments(end)
+
+	prefix := strings.Repeat(indentation, depth)
+	var out strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		if l.blank {
+			out.WriteString("\n")
+		}
+
+		out.WriteString(prefix)
+		out.WriteString(l.text)
+		if l.open && continues(lines[i+1:]) {
+			out.WriteString(";")
+		}
+		if l.comment != "" {
+			out.WriteString(" " + l.comment)
+		}
+	}
+
+	return out.String()
+}
+
+// continues reports whether the next statement starts with a `(`, `[` or an operator,
+// which would continue an expression that does not end with a semicolon
+func continues(lines []line) bool {
+	for _, l := range lines {
+		if !l.isComment {
+			return strings.ContainsAny(l.text[:1], "([-+*/<>=!|.")
+		}
+	}
+	return false
+}
+
+// take marks as printed the comments between start and end
+func (p *printer) take(start, end token.Position) []token.Token {
+	taken := []token.Token{}
+	for i, c := range p.comments {
+		if !p.used[i] && before(start, c.Pos) && (end == token.Position{} || before(c.Pos, end)) {
+			p.used[i] = true
+			taken = append(taken, c)
+		}
+	}
+
+	return taken
+}
+
+// trailing takes the comment on the last line of the statement that starts at start,
+// unless the next statement starts on the same line
+func (p *printer) trailing(start, next token.Position) (token.Token, bool) {
+	if next.Line == p.last {
+		return token.Token{}, false
+	}
+
+	for i, c := range p.comments {
+		if !p.used[i] && c.Pos.Line == p.last && before(start, c.Pos) {
+			p.used[i] = true
+			return c, true
+		}
+	}
+
+	return token.Token{}, false
+}
+
+// hasComments reports whether there are comments left between start and end
+func (p *printer) hasComments(start, end token.Position) bool {
+	for i, c := range p.comments {
+		if !p.used[i] && before(start, c.Pos) && before(c.Pos, end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// statement prints a statement without indentation. open is set for `if` and `for`
+// expressions, which do not end with a semicolon
+func (p *printer) statement(stmt ast.Statement, depth int, value bool) (text string, open bool) {
+	p.see(stmt.Pos().Line)
+	col := len(indentation) * depth
+
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		head := "let " + stmt.Name.Value + " = "
+		if stmt.Exported {
+			head = "export " + head
+		}
+		return head + p.expr(stmt.Value, depth, col+len(head), context{}) + ";", false
+
+	case *ast.ReturnStatement:
+		head := "return "
+		return head + p.expr(stmt.ReturnValue, depth, col+len(head), context{}) + ";", false
+
+	case *ast.ImportStatement:
+		text := `import "` + stmt.Path + `"`
+		if stmt.Name.Value != path.Base(stmt.Path) {
+			text += " as " + stmt.Name.Value
+		}
+		return text + ";", false
+
+	case *ast.ExpressionStatement:
+		text := p.expr(stmt.Expression, depth, col, context{})
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.ForExpression:
+			return text, !value
+		}
+		if value {
+			return text, false
+		}
+		return text + ";", false
+
+	case *ast.BlockStatment:
+		return p.block(stmt, depth, col), false
+	}
+
+	return stmt.String(), false
+}
+
+// shape returns the precedence of the operator of an expression and the precedence
+// an operator printed after it must not exceed, or it would become part of its right
+// operand
+func shape(e ast.Expression) (top, open int) {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		precedence := parser.Precedence(e.Token.Type)
+		return precedence, precedence
+	case *ast.PrefixExpression:
+		return atomic, parser.PREFIX
+	case *ast.InExpression:
+		return parser.IN, parser.LOWEST
+	case *ast.AssignExpression:
+		return parser.ASSIGN, parser.LOWEST
+	}
+
+	return atomic, atomic
+}
+
+// expr prints an expression whose first line starts at column col
+func (p *printer) expr(e ast.Expression, depth, col int, ctx context) string {
+	p.see(e.Pos().Line)
+
+	if top, open := shape(e); top <= ctx.min || ctx.follow > open {
+		return "(" + p.expr(e, depth, col+1, context{}) + ")"
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		return e.Value
+	case *ast.IntegerLiteral:
+		return e.Token.Literal
+	case *ast.Boolean:
+		return e.Token.Literal
+	case *ast.StringLiteral:
+		p.see(e.Pos().Line + strings.Count(e.Value, "\n"))
+		return `"` + e.Value + `"`
+
+	case *ast.PrefixExpression:
+		return e.Operator + p.expr(e.Right, depth, col+len(e.Operator), context{min: parser.PREFIX, follow: ctx.follow})
+
+	case *ast.InfixExpression:
+		return p.infix(e, depth, col, ctx)
+
+	case *ast.InExpression:
+		element := p.expr(e.Element, depth, col, context{follow: parser.IN}) + " in "
+		return element + p.expr(e.Iterable, depth, column(col, element), context{min: parser.LOWEST, follow: ctx.follow})
+
+	case *ast.AssignExpression:
+		head := e.Identifier.Value + " = "
+		return head + p.expr(e.Value, depth, col+len(head), context{min: parser.LOWEST, follow: ctx.follow})
+
+	case *ast.CallExpression:
+		function := p.expr(e.Function, depth, col, context{follow: parser.CALL})
+		l := list{open: "(", close: ")", start: e.Token.Pos, end: e.End, items: positions(e.Arguments)}
+		return function + p.list(l, depth, column(col, function), func(i, depth, col int) string {
+			return p.expr(e.Arguments[i], depth, col, context{})
+		})
+
+	case *ast.IndexExpression:
+		left := p.expr(e.Left, depth, col, context{follow: parser.INDEX}) + "["
+		return left + p.expr(e.Index, depth, column(col, left), context{}) + "]"
+
+	case *ast.ArrayLiteral:
+		l := list{open: "[", close: "]", start: e.Token.Pos, end: e.End, items: positions(e.Elements)}
+		return p.list(l, depth, col, func(i, depth, col int) string {
+			return p.expr(e.Elements[i], depth, col, context{})
+		})
+
+	case *ast.HashLiteral:
+		keys := make([]ast.Expression, 0, len(e.Pairs))
+		for key := range e.Pairs {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return before(keys[i].Pos(), keys[j].Pos()) })
+
+		l := list{open: "{", close: "}", start: e.Token.Pos, end: e.End, items: positions(keys)}
+		return p.list(l, depth, col, func(i, depth, col int) string {
+			key := p.expr(keys[i], depth, col, context{}) + ": "
+			return key + p.expr(e.Pairs[keys[i]], depth, column(col, key), context{})
+		})
+
+	case *ast.FunctionLiteral:
+		params := make([]string, len(e.Parameters))
+		for i, param := range e.Parameters {
+			params[i] = param.Value
+		}
+		head := "fn(" + strings.Join(params, ", ") + ") "
+		return head + p.block(e.Body, depth, col+len(head))
+
+	case *ast.IfExpression:
+		head := "if (" + p.expr(e.Condition, depth, col+4, context{}) + ") "
+		text := head + p.block(e.Consequence, depth, column(col, head))
+		if e.Alternative != nil {
+			text += " else "
+			text += p.blockAfter(e.Alternative, e.Consequence.End, depth, column(col, text))
+		}
+		return text
+
+	case *ast.ForExpression:
+		condition := p.expr(e.Condition, depth, col+4, context{})
+		if strings.HasPrefix(condition, "(") {
+			// the parser would read the parentheses as the ones of the loop
+			condition = "(" + condition + ")"
+		}
+		head := "for " + condition + " "
+		return head + p.block(e.Body, depth, column(col, head))
+	}
+
+	return e.String()
+}
+
+func (p *printer) infix(e *ast.InfixExpression, depth, col int, ctx context) string {
+	precedence := parser.Precedence(e.Token.Type)
+	operator := " " + e.Operator + " "
+	if e.Token.Type == token.RANGE {
+		operator = e.Operator
+	}
+
+	s := p.save()
+	left := p.expr(e.Left, depth, col, context{follow: precedence}) + operator
+	if comments := p.take(e.Left.Pos(), e.Right.Pos()); len(comments) > 0 {
+		// the right operand continues on the line after the comments
+		left = strings.TrimRight(left, " ") + p.breakAfter(comments, depth+1)
+	}
+	text := left + p.expr(e.Right, depth, column(col, left), context{min: precedence, follow: ctx.follow})
+	if e.Token.Type != token.PIPELINE || fits(col, text) && (!strings.Contains(text, "\n") || !isPipeline(e.Left)) {
+		return text
+	}
+
+	// one stage per line
+	p.restore(s)
+	stages := []ast.Expression{}
+	var head ast.Expression = e
+	for isPipeline(head) {
+		infix := head.(*ast.InfixExpression)
+		stages = append([]ast.Expression{infix.Right}, stages...)
+		head = infix.Left
+	}
+
+	prefix := "\n" + strings.Repeat(indentation, depth+1) + e.Operator + " "
+	text = p.expr(head, depth, col, context{follow: precedence})
+	previous := head
+	for i, stage := range stages {
+		follow := precedence
+		if i == len(stages)-1 {
+			follow = ctx.follow
+		}
+		if comments := p.take(previous.Pos(), stage.Pos()); len(comments) > 0 {
+			text += strings.TrimSuffix(p.breakAfter(comments, depth+1), "\n"+strings.Repeat(indentation, depth+1))
+		}
+		text += prefix + p.expr(stage, depth+1, len(prefix)-1, context{min: precedence, follow: follow})
+		previous = stage
+	}
+
+	return text
+}
+
+func isPipeline(e ast.Expression) bool {
+	infix, ok := e.(*ast.InfixExpression)
+	return ok && infix.Token.Type == token.PIPELINE
+}
+
+// list is a bracketed list of items, e.g. the arguments of a call
+type list struct {
+	open, close string
+	// start and end are the positions of the brackets
+	start, end token.Position
+	// items are the positions where the items start
+	items []token.Position
+}
+
+func positions(exprs []ast.Expression) []token.Position {
+	pos := make([]token.Position, len(exprs))
+	for i, e := range exprs {
+		pos[i] = e.Pos()
+	}
+	return pos
+}
+
+// list prints the items on one line when they fit, or one per line. Lists with
+// comments are printed one item per line with the comments next to their items
+func (p *printer) list(l list, depth, col int, item func(i, depth, col int) string) string {
+	n := len(l.items)
+	if !p.hasComments(l.start, l.end) {
+		s := p.save()
+		items := make([]string, n)
+		c := col + len(l.open)
+		for i := range items {
+			items[i] = item(i, depth, c)
+			c = column(c, items[i]) + len(", ")
+		}
+
+		text := l.open + strings.Join(items, ", ") + l.close
+		// only the last item may span several lines, e.g. a function
+		if n == 0 || fits(col, text) && !strings.Contains(strings.Join(items[:n-1], ""), "\n") {
+			return text
+		}
+		p.restore(s)
+	}
+
+	prefix := strings.Repeat(indentation, depth+1)
+	var out strings.Builder
+	out.WriteString(l.open)
+	for i := range l.items {
+		// comments on their own lines are printed before the item that follows them
+		for _, c := range p.take(l.start, l.items[i]) {
+			out.WriteString("\n" + prefix + c.Literal)
+		}
+
+		out.WriteString("\n" + prefix + item(i, depth+1, len(prefix)))
+		if i < n-1 {
+			out.WriteString(",")
+		}
+
+		next := l.end
+		if i < n-1 {
+			next = l.items[i+1]
+		}
+		if c, ok := p.trailing(l.items[i], next); ok {
+			out.WriteString(" " + c.Literal)
+		}
+	}
+
+	for _, c := range p.take(l.start, l.end) {
+		out.WriteString("\n" + prefix + c.Literal)
+	}
+
+	return out.String() + "\n" + strings.Repeat(indentation, depth) + l.close
+}
+
+// breakAfter prints comments that interrupt an expression and starts the next line.
+// A comment that follows the expression on its last line stays at the end of the line,
+// the others are printed on their own lines
+func (p *printer) breakAfter(comments []token.Token, depth int) string {
+	prefix := "\n" + strings.Repeat(indentation, depth)
+	var out strings.Builder
+	for i, c := range comments {
+		if i == 0 && c.Pos.Line == p.last {
+			out.WriteString(" ")
+		} else {
+			out.WriteString(prefix)
+		}
+		out.WriteString(c.Literal)
+		p.see(c.Pos.Line)
+	}
+
+	return out.String() + prefix
+}
+
+// block prints a block on one line when it only holds an expression that fits
+func (p *printer) block(b *ast.BlockStatment, depth, col int) string {
+	return p.blockAfter(b, b.Token.Pos, depth, col)
+}
+
+// blockAfter prints a block with the comments after start at its beginning, e.g. the
+// comments between the `}` of an if and its `else`
+func (p *printer) blockAfter(b *ast.BlockStatment, start token.Position, depth, col int) string {
+	defer p.see(b.End.Line)
+
+	if !p.hasComments(start, b.End) {
+		if len(b.Statements) == 0 {
+			return "{}"
+		}
+
+		if stmt, ok := b.Statements[0].(*ast.ExpressionStatement); ok && len(b.Statements) == 1 {
+			s := p.save()
+			text := "{ " + p.expr(stmt.Expression, depth, col+2, context{}) + " }"
+			if !strings.Contains(text, "\n") && fits(col, text) {
+				return text
+			}
+			p.restore(s)
+		}
+	}
+
+	body := p.statements(b.Statements, depth+1, start, b.End, true)
+	return "{\n" + body + "\n" + strings.Repeat(indentation, depth) + "}"
+}
+
+// column returns the column after printing text at col
+func column(col int, text string) int {
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		return len(text) - i - 1
+	}
+	return col + len(text)
+}
+
+// fits reports whether the first line of text starting at col is within Width
+func fits(col int, text string) bool {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return col+len(text) <= Width
+}
@@ -0,0 +1,177 @@
+package format
+
+import (
+	"errors"
+	"testing"
+
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"empty", "", ""},
+		{"spacing", "let x=1+2*3;x", "let x = 1 + 2 * 3;\nx;\n"},
+		{
+			"parentheses",
+			"(1 + 2) * 3; 1 + (2 * 3); (1 - 2) - (3 - 4); -(a + b); -(1..3); (-1)..3; (!a)(b); f(x)[0]",
+			"(1 + 2) * 3;\n1 + 2 * 3;\n1 - 2 - (3 - 4);\n-(a + b);\n-1..3;\n(-1)..3;\n(!a)(b);\nf(x)[0];\n",
+		},
+		{
+			"in and assignment",
+			"(x in [1, 2]) == true; a + (x in b); (b = 1) + 1; for (i in 1..3) { x = x + i }",
+			"(x in [1, 2]) == true;\na + x in b;\n(b = 1) + 1;\nfor i in 1..3 { x = x + i }\n",
+		},
+		{"for with parentheses", "for ((a + b) * 2 > 1) { a }", "for ((a + b) * 2 > 1) { a }\n"},
+		{
+			"blocks",
+			"let f = fn(a,b){let c = a+b; c}; if (a) {return 1;} else {2}",
+			"let f = fn(a, b) {\n  let c = a + b;\n  c\n};\nif (a) {\n  return 1;\n} else { 2 }\n",
+		},
+		{
+			"hash order",
+			`{"b": 1, "a": {}, "c": []}`,
+			`{"b": 1, "a": {}, "c": []};` + "\n",
+		},
+		{
+			"statements",
+			"import \"lib/strings\"\nimport \"lib/x\" as y\nexport let k = \"a\\\"b\"",
+			"import \"lib/strings\";\nimport \"lib/x\" as y;\nexport let k = \"a\\\"b\";\n",
+		},
+		{
+			"if followed by a grouped expression",
+			"if (a) { 1 }; (-1); if (a) { 1 }; [1]; if (a) { 1 } b",
+			"if (a) { 1 };\n-1;\nif (a) { 1 };\n[1];\nif (a) { 1 }\nb;\n",
+		},
+		{
+			"long list",
+			"let numbers = [1000000, 2000000, 3000000, 4000000, 5000000, 6000000, 7000000, 8000000];",
+			"let numbers = [\n  1000000,\n  2000000,\n  3000000,\n  4000000,\n  5000000,\n  6000000,\n  7000000,\n  8000000\n];\n",
+		},
+		{
+			"last argument spans lines",
+			"map(items, fn(x) { let y = x * 2; y })",
+			"map(items, fn(x) {\n  let y = x * 2;\n  y\n});\n",
+		},
+		{
+			"long pipeline",
+			"let total = items |> map(fn(x) { x * 2 }) |> filter(fn(x) { x > 2 }) |> reduce(fn(a, b) { a + b }, 0);",
+			"let total = items\n  |> map(fn(x) { x * 2 })\n  |> filter(fn(x) { x > 2 })\n  |> reduce(fn(a, b) { a + b }, 0);\n",
+		},
+		{
+			"comments",
+			"// header\n\n\nlet x = 1;   // one\nlet f = fn() {\n  // body\n  x\n  // end\n};\n\n// footer",
+			"// header\n\nlet x = 1; // one\nlet f = fn() {\n  // body\n  x\n  // end\n};\n\n// footer\n",
+		},
+		{
+			"comment inside an expression",
+			"let a = [1, // one\n  2];\nlet b = 2;",
+			"let a = [\n  1, // one\n  2\n];\nlet b = 2;\n",
+		},
+		{
+			"comment before a hash pair",
+			"let h = {\n  // lead\n  \"a\": 1, \"b\": 2};",
+			"let h = {\n  // lead\n  \"a\": 1,\n  \"b\": 2\n};\n",
+		},
+		{
+			"comments between arguments",
+			"log(1, // one\n  // two\n  2, [3, // three\n  4])",
+			"log(\n  1, // one\n  // two\n  2,\n  [\n    3, // three\n    4\n  ]\n);\n",
+		},
+		{
+			"comments before else",
+			"let x = if (a) {\n  1\n} // after then\nelse {\n  2\n};\nif (a) { 1 }\n// own line\nelse {}",
+			"let x = if (a) { 1 } else {\n  // after then\n  2\n};\nif (a) { 1 } else {\n  // own line\n}\n",
+		},
+		{
+			"comment after an operator",
+			"let x = 1 + // one\n  2;",
+			"let x = 1 + // one\n  2;\n",
+		},
+		{
+			"directive before an operand",
+			"let x = 1 +\n  // lint:ignore shadow\n  2;",
+			"let x = 1 +\n  // lint:ignore shadow\n  2;\n",
+		},
+		{
+			"comments between pipeline stages",
+			"let y = items\n  // double\n  |> map(fn(x) { x * 2 }) |> len();",
+			"let y = items\n  // double\n  |> map(fn(x) { x * 2 })\n  |> len();\n",
+		},
+	}
+
+	for _, tt := range tests {
+		out, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+
+		if out != tt.expected {
+			t.Errorf("%s: wrong output.\nexpected:\n%s\ngot:\n%s", tt.name, tt.expected, out)
+			continue
+		}
+
+		if again, _ := Source(out); again != out {
+			t.Errorf("%s: formatting is not idempotent.\nfirst:\n%s\nsecond:\n%s", tt.name, out, again)
+		}
+	}
+}
+
+// TestSameProgram checks that the output parses to the same program, the String
+// methods of the ast print every parenthesis
+func TestSameProgram(t *testing.T) {
+	inputs := []string{
+		"a - (b - c) - d * (e / f) / g",
+		"!-a + -(b * c) - !(d == e)",
+		"a |> f(b = 1) |> g(x in y)",
+		"(a |> f()) + 1",
+		"x = y = 1 + 2",
+		"((a + b) in c) < d",
+		"-(a..b)..(c..d)",
+		"fn(x) { x }(1)[2](3)",
+		"a < b == (c > d) != (e == f)",
+		"x in (y in z)",
+	}
+
+	for _, input := range inputs {
+		out, err := Source(input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", input, err)
+			continue
+		}
+
+		if got, expected := parse(t, out), parse(t, input); got != expected {
+			t.Errorf("%q: formatted as %q, which parses as %s instead of %s", input, out, got, expected)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: parse errors: %v", input, p.Errors())
+	}
+
+	return program.String()
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Source("let = 1;")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+
+	if len(parseErr.Errors) == 0 {
+		t.Fatal("expected the parser errors")
+	}
+}
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"fmt"
+	"strings"
 
 	"protiumx.dev/simia/token"
 )
@@ -13,16 +14,31 @@ type Lexer struct {
 	// Value of 0 represents the NULL char
 	currentChar  byte
 	readPotition int
+	line         int
+	lineStart    int
+	comments     []token.Token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// Comments returns the `//` comments skipped so far, in source order
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
 func (l *Lexer) NextToken() token.Token {
 	l.consumeWhiteSpace()
+	pos := token.Position{Line: l.line, Column: l.currentPostion - l.lineStart + 1}
+	ret := l.nextToken()
+	ret.Pos = pos
+	return ret
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var ret token.Token
 	switch l.currentChar {
 	case '=':
@@ -91,6 +107,11 @@ func newToken(tokenType token.TokenType, char byte) token.Token {
 }
 
 func (l *Lexer) readChar() {
+	if l.currentChar == '\n' {
+		l.line++
+		l.lineStart = l.readPotition
+	}
+
 	if l.readPotition >= len(l.input) {
 		l.currentChar = 0
 	} else {
@@ -134,9 +155,28 @@ func (l *Lexer) readString() string {
 }
 
 func (l *Lexer) consumeWhiteSpace() {
-	for l.currentChar == ' ' || l.currentChar == '\t' || l.currentChar == '\n' || l.currentChar == '\r' {
+	for {
+		switch {
+		case l.currentChar == ' ' || l.currentChar == '\t' || l.currentChar == '\n' || l.currentChar == '\r':
+			l.readChar()
+		case l.currentChar == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+// readComment reads a comment until the end of the line
+func (l *Lexer) readComment() {
+	pos := token.Position{Line: l.line, Column: l.currentPostion - l.lineStart + 1}
+	position := l.currentPostion
+	for l.currentChar != '\n' && l.currentChar != 0 {
 		l.readChar()
 	}
+
+	literal := strings.TrimRight(l.input[position:l.currentPostion], " \t\r")
+	l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: literal, Pos: pos})
 }
 
 func (l *Lexer) peekChar() byte {
@@ -166,3 +166,68 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestPositions(t *testing.T) {
+	input := "let x = 10;\n  x == \"a\nb\";\n\tfoo"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"let", token.Position{Line: 1, Column: 1}},
+		{"x", token.Position{Line: 1, Column: 5}},
+		{"=", token.Position{Line: 1, Column: 7}},
+		{"10", token.Position{Line: 1, Column: 9}},
+		{";", token.Position{Line: 1, Column: 11}},
+		{"x", token.Position{Line: 2, Column: 3}},
+		{"==", token.Position{Line: 2, Column: 5}},
+		{"a\nb", token.Position{Line: 2, Column: 8}},
+		{";", token.Position{Line: 3, Column: 3}},
+		{"foo", token.Position{Line: 4, Column: 2}},
+		{"", token.Position{Line: 4, Column: 5}},
+	}
+
+	lex := New(input)
+	for i, tt := range tests {
+		tok := lex.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong literal. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - wrong position for %q. expected=%s, got=%s", i, tok.Literal, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// header\nlet x = 10 / 2; // half  \n\"// not a comment\"\n//"
+
+	expectedTypes := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SLASH, token.INT,
+		token.SEMICOLON, token.STRING, token.EOF,
+	}
+
+	lex := New(input)
+	for i, expected := range expectedTypes {
+		if tok := lex.NextToken(); tok.Type != expected {
+			t.Fatalf("tests[%d] - wrong token type. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+
+	expected := []token.Token{
+		{Type: token.COMMENT, Literal: "// header", Pos: token.Position{Line: 1, Column: 1}},
+		{Type: token.COMMENT, Literal: "// half", Pos: token.Position{Line: 2, Column: 17}},
+		{Type: token.COMMENT, Literal: "//", Pos: token.Position{Line: 4, Column: 1}},
+	}
+
+	comments := lex.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d (%v)", len(expected), len(comments), comments)
+	}
+
+	for i, c := range comments {
+		if c != expected[i] {
+			t.Errorf("comments[%d] - expected=%+v, got=%+v", i, expected[i], c)
+		}
+	}
+}
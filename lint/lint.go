@@ -0,0 +1,362 @@
+// Package lint reports likely mistakes in simia programs: unused bindings, shadowed
+// names, code after return, builtins called with the wrong number of arguments and
+// assignments to undeclared variables. Names are resolved with the symbol tables of
+// the compiler, so the scopes are the ones of compiled programs
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/prelude"
+	"protiumx.dev/simia/token"
+	"protiumx.dev/simia/value"
+)
+
+// Rule IDs, used in the diagnostics and in suppression comments
+const (
+	// Unused reports let bindings and imports that are never read
+	Unused = "unused"
+	// Shadow reports bindings that hide a binding of an outer scope or a predeclared name
+	Shadow = "shadow"
+	// Unreachable reports statements after a return
+	Unreachable = "unreachable"
+	// Arity reports builtin calls with the wrong number of arguments
+	Arity = "arity"
+	// Undeclared reports assignments to variables that were not declared
+	Undeclared = "undeclared"
+)
+
+// ignoreDirective suppresses diagnostics on the line of the comment and the next one,
+// e.g. `// lint:ignore unused, shadow`. Without rules it suppresses every rule
+const ignoreDirective = "lint:ignore"
+
+// Diagnostic is a problem found at a position of the program
+type Diagnostic struct {
+	Pos     token.Position
+	Rule    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Rule)
+}
+
+type Options struct {
+	// Globals are the names defined by the host, e.g. `args` for the scripts run by simia
+	Globals []string
+}
+
+// Program checks a program with the builtins and the prelude defined. comments are
+// the ones returned by the lexer, used for suppression. Diagnostics are sorted by position
+func Program(program *ast.Program, comments []token.Token, opts Options) []Diagnostic {
+	l := &linter{
+		scope:       &scope{symbols: prelude.SymbolTable(), bindings: map[string]*binding{}},
+		predeclared: map[string]string{},
+	}
+
+	for _, b := range value.Builtins() {
+		l.predeclared[b.Name] = "builtin"
+	}
+	for _, name := range prelude.Names() {
+		l.predeclared[name] = "prelude function"
+	}
+	for _, name := range opts.Globals {
+		l.predeclared[name] = "global"
+		l.scope.symbols.Define(name)
+	}
+
+	l.statements(program.Statements)
+	l.closeScope()
+
+	diagnostics := suppress(l.diagnostics, comments)
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Pos, diagnostics[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+
+	return diagnostics
+}
+
+type linter struct {
+	scope *scope
+	// predeclared describes the names defined before the program
+	predeclared map[string]string
+	diagnostics []Diagnostic
+}
+
+// scope is a function body, a loop body or the program
+type scope struct {
+	symbols  *compiler.SymbolTable
+	outer    *scope
+	bindings map[string]*binding
+	// function is the name of the function the scope belongs to, calls to it are recursive
+	function string
+}
+
+type binding struct {
+	name string
+	pos  token.Position
+	// kind is let, import, parameter or loop variable
+	kind     string
+	used     bool
+	exported bool
+}
+
+func (l *linter) report(pos token.Position, rule, format string, args ...any) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{Pos: pos, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) openScope(function string) {
+	l.scope = &scope{
+		symbols:  compiler.NewEnclosedSymbolTable(l.scope.symbols),
+		outer:    l.scope,
+		bindings: map[string]*binding{},
+		function: function,
+	}
+}
+
+func (l *linter) closeScope() {
+	for _, b := range l.scope.bindings {
+		l.checkUsed(b)
+	}
+	l.scope = l.scope.outer
+}
+
+func (l *linter) checkUsed(b *binding) {
+	if b.used || b.exported || strings.HasPrefix(b.name, "_") {
+		return
+	}
+
+	switch b.kind {
+	case "let":
+		l.report(b.pos, Unused, "%s is declared and not used", b.name)
+	case "import":
+		l.report(b.pos, Unused, "module %s is imported and not used", b.name)
+	}
+}
+
+// declare defines a binding in the current scope
+func (l *linter) declare(name *ast.Identifier, kind string, exported bool) {
+	if outer := l.lookup(l.scope.outer, name.Value); outer != nil {
+		l.report(name.Pos(), Shadow, "%s shadows the %s declared at %s", name.Value, outer.kind, outer.pos)
+	} else if predeclared, ok := l.predeclared[name.Value]; ok {
+		l.report(name.Pos(), Shadow, "%s shadows the %s %s", name.Value, predeclared, name.Value)
+	}
+
+	// the previous binding can only be read before this one
+	if previous, ok := l.scope.bindings[name.Value]; ok {
+		l.checkUsed(previous)
+	}
+
+	l.scope.symbols.Define(name.Value)
+	l.scope.bindings[name.Value] = &binding{name: name.Value, pos: name.Pos(), kind: kind, exported: exported}
+}
+
+// lookup finds the binding of a name in s or its outer scopes, a recursive call of
+// the function of a scope does not refer to a binding
+func (l *linter) lookup(s *scope, name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b
+		}
+		if s.function == name {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (l *linter) use(name string) {
+	if b := l.lookup(l.scope, name); b != nil {
+		b.used = true
+	}
+}
+
+func (l *linter) statements(stmts []ast.Statement) {
+	returned := false
+	for _, stmt := range stmts {
+		if returned {
+			l.report(stmt.Pos(), Unreachable, "unreachable code after return")
+			returned = false
+		}
+
+		l.statement(stmt)
+		if _, ok := stmt.(*ast.ReturnStatement); ok {
+			returned = true
+		}
+	}
+}
+
+func (l *linter) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		l.expression(stmt.Value)
+		l.declare(stmt.Name, "let", stmt.Exported)
+	case *ast.ImportStatement:
+		l.declare(stmt.Name, "import", false)
+	case *ast.ReturnStatement:
+		l.expression(stmt.ReturnValue)
+	case *ast.ExpressionStatement:
+		l.expression(stmt.Expression)
+	case *ast.BlockStatment:
+		l.statements(stmt.Statements)
+	}
+}
+
+func (l *linter) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		l.use(e.Value)
+
+	case *ast.PrefixExpression:
+		l.expression(e.Right)
+
+	case *ast.InfixExpression:
+		l.expression(e.Left)
+		// `a |> f(b)` calls f(a, b)
+		if call, ok := e.Right.(*ast.CallExpression); ok && e.Token.Type == token.PIPELINE {
+			l.call(call, 1)
+			return
+		}
+		l.expression(e.Right)
+
+	case *ast.InExpression:
+		l.expression(e.Element)
+		l.expression(e.Iterable)
+
+	case *ast.AssignExpression:
+		l.expression(e.Value)
+		if _, ok := l.scope.symbols.Resolve(e.Identifier.Value); !ok {
+			l.report(e.Identifier.Pos(), Undeclared, "assignment to undeclared variable %s", e.Identifier.Value)
+		}
+
+	case *ast.CallExpression:
+		l.call(e, 0)
+
+	case *ast.IndexExpression:
+		l.expression(e.Left)
+		l.expression(e.Index)
+
+	case *ast.ArrayLiteral:
+		for _, element := range e.Elements {
+			l.expression(element)
+		}
+
+	case *ast.HashLiteral:
+		for key, value := range e.Pairs {
+			l.expression(key)
+			l.expression(value)
+		}
+
+	case *ast.IfExpression:
+		l.expression(e.Condition)
+		l.statements(e.Consequence.Statements)
+		if e.Alternative != nil {
+			l.statements(e.Alternative.Statements)
+		}
+
+	case *ast.ForExpression:
+		l.forExpression(e)
+
+	case *ast.FunctionLiteral:
+		l.openScope(e.Name)
+		if e.Name != "" {
+			l.scope.symbols.DefineFunctionName(e.Name)
+		}
+		for _, param := range e.Parameters {
+			l.declare(param, "parameter", false)
+		}
+		l.statements(e.Body.Statements)
+		l.closeScope()
+	}
+}
+
+// forExpression checks a loop, its body and the variable of `for x in items` are in a new scope
+func (l *linter) forExpression(e *ast.ForExpression) {
+	in, ok := e.Condition.(*ast.InExpression)
+	if !ok {
+		l.expression(e.Condition)
+		l.openScope("")
+	} else if element, ok := in.Element.(*ast.Identifier); ok {
+		l.expression(in.Iterable)
+		l.openScope("")
+		l.declare(element, "loop variable", false)
+	} else {
+		l.expression(in)
+		l.openScope("")
+	}
+
+	l.statements(e.Body.Statements)
+	l.closeScope()
+}
+
+// call checks the arguments of builtin calls, extra counts the argument passed by a pipeline
+func (l *linter) call(call *ast.CallExpression, extra int) {
+	l.expression(call.Function)
+	for _, arg := range call.Arguments {
+		l.expression(arg)
+	}
+
+	name, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return
+	}
+
+	symbol, ok := l.scope.symbols.Resolve(name.Value)
+	if !ok || symbol.Scope != compiler.BuiltinScope {
+		return
+	}
+
+	builtin := value.GetBuiltinByName(name.Value)
+	min, max := builtin.MinArgs(), builtin.MaxArgs()
+	switch got := len(call.Arguments) + extra; {
+	case min == max && got != min:
+		l.report(name.Pos(), Arity, "wrong number of arguments to %s. got=%d, want=%d", builtin.Signature(), got, min)
+	case got < min:
+		l.report(name.Pos(), Arity, "wrong number of arguments to %s. got=%d, want at least %d", builtin.Signature(), got, min)
+	case max != -1 && got > max:
+		l.report(name.Pos(), Arity, "wrong number of arguments to %s. got=%d, want at most %d", builtin.Signature(), got, max)
+	}
+}
+
+// suppress drops the diagnostics silenced by `lint:ignore` comments
+func suppress(diagnostics []Diagnostic, comments []token.Token) []Diagnostic {
+	// ignored maps lines to the rules ignored in them, an empty rule ignores all
+	ignored := map[int][]string{}
+	for _, c := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Literal, "//"))
+		if !strings.HasPrefix(text, ignoreDirective) {
+			continue
+		}
+
+		rules := []string{""}
+		if list := strings.TrimSpace(strings.TrimPrefix(text, ignoreDirective)); list != "" {
+			rules = strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' })
+		}
+		ignored[c.Pos.Line] = append(ignored[c.Pos.Line], rules...)
+		ignored[c.Pos.Line+1] = append(ignored[c.Pos.Line+1], rules...)
+	}
+
+	kept := []Diagnostic{}
+	for _, d := range diagnostics {
+		if !isIgnored(ignored[d.Pos.Line], d.Rule) {
+			kept = append(kept, d)
+		}
+	}
+
+	return kept
+}
+
+func isIgnored(rules []string, rule string) bool {
+	for _, r := range rules {
+		if r == "" || r == rule {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/parser"
+)
+
+func lint(t *testing.T, input string, opts Options) []string {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+
+	diagnostics := []string{}
+	for _, d := range Program(program, l.Comments(), opts) {
+		diagnostics = append(diagnostics, d.String())
+	}
+	return diagnostics
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"clean", "let x = 1; let f = fn(a) { a + x }; f(2)", nil},
+		{"unused let", "let x = 1;\nlet y = 2;\ny", []string{"1:5: x is declared and not used (unused)"}},
+		{"unused local", "let f = fn() { let a = 1; 2 }; f()", []string{"1:20: a is declared and not used (unused)"}},
+		{
+			"unused import",
+			"import \"lib/strings\" as s;\nimport \"lib/http\";",
+			[]string{
+				"1:25: module s is imported and not used (unused)",
+				"2:8: module http is imported and not used (unused)",
+			},
+		},
+		{"exported and underscore", "export let x = 1; let _y = 2;", nil},
+		{"parameters and recursion", "let f = fn(n, unused) { if (n > 0) { f(n - 1, 0) } };", []string{"1:5: f is declared and not used (unused)"}},
+		{"used by a closure", "let x = 1; let f = fn() { fn() { x } }; f()", nil},
+		{"redeclared before use", "let x = 1; let x = 2; x", []string{"1:5: x is declared and not used (unused)"}},
+		{
+			"shadow",
+			"let x = 1;\nlet f = fn(x) { let len = 2; len + x };\nf(x)",
+			[]string{
+				"2:12: x shadows the let declared at 1:5 (shadow)",
+				"2:21: len shadows the builtin len (shadow)",
+			},
+		},
+		{"shadow prelude", "let sum = 1; sum", []string{"1:5: sum shadows the prelude function sum (shadow)"}},
+		{"shadow host global", "let args = 1; args", []string{"1:5: args shadows the global args (shadow)"}},
+		{"loop variable", "let i = 0; for i in 1..3 { log(i) }; i", []string{"1:16: i shadows the let declared at 1:5 (shadow)"}},
+		{
+			"unreachable",
+			"let f = fn() { return 1; log(2); log(3) }; f()",
+			[]string{"1:26: unreachable code after return (unreachable)"},
+		},
+		{
+			"arity",
+			`len(); len("a", "b"); get({}); [1] |> map(fn(x) { x }); [1] |> len(2); merge(); merge({}, {})`,
+			[]string{
+				"1:1: wrong number of arguments to len(value: STRING or ARRAY or HASH). got=0, want=1 (arity)",
+				"1:8: wrong number of arguments to len(value: STRING or ARRAY or HASH). got=2, want=1 (arity)",
+				"1:23: wrong number of arguments to get(hash: HASH, key: STRING, default). got=1, want=3 (arity)",
+				"1:64: wrong number of arguments to len(value: STRING or ARRAY or HASH). got=2, want=1 (arity)",
+				"1:72: wrong number of arguments to merge(...hashes: HASH). got=0, want at least 1 (arity)",
+			},
+		},
+		{"shadowed builtin", "let len = fn() { 1 }; len(1, 2)", []string{"1:5: len shadows the builtin len (shadow)"}},
+		{
+			"undeclared",
+			"let x = 1; x = 2; y = 3; let f = fn() { z = 1; x = 3 }; f(); x",
+			[]string{
+				"1:19: assignment to undeclared variable y (undeclared)",
+				"1:41: assignment to undeclared variable z (undeclared)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		diagnostics := lint(t, tt.input, Options{Globals: []string{"args"}})
+		if strings.Join(diagnostics, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: expected\n\t%s\ngot\n\t%s", tt.name, strings.Join(tt.expected, "\n\t"), strings.Join(diagnostics, "\n\t"))
+		}
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	input := `let a = 1; // lint:ignore unused
+// lint:ignore
+let len = 2;
+// lint:ignore shadow
+let b = 3;
+let c = 4; // lint:ignore arity, shadow`
+
+	expected := []string{
+		"5:5: b is declared and not used (unused)",
+		"6:5: c is declared and not used (unused)",
+	}
+
+	diagnostics := lint(t, input, Options{})
+	if strings.Join(diagnostics, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n\t%s\ngot\n\t%s", strings.Join(expected, "\n\t"), strings.Join(diagnostics, "\n\t"))
+	}
+}
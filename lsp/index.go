@@ -0,0 +1,345 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/prelude"
+	"protiumx.dev/simia/token"
+	"protiumx.dev/simia/value"
+)
+
+// Symbol kinds
+const (
+	kindBuiltin   = "builtin"
+	kindPrelude   = "prelude function"
+	kindGlobal    = "global"
+	kindLet       = "let"
+	kindImport    = "import"
+	kindParameter = "parameter"
+	kindLoop      = "loop variable"
+)
+
+// symbol is a binding of the document or a predeclared name
+type symbol struct {
+	name string
+	kind string
+	// pos is where the binding is declared, zero for predeclared names
+	pos token.Position
+	// detail describes the binding, e.g. the signature of a function
+	detail string
+	// refs are the identifiers that refer to the symbol, including the declaration
+	refs []token.Position
+	// scope is where the symbol is visible
+	scope *scope
+}
+
+// scope is a function body, a loop body or the program. Only functions define compiler
+// scopes, loops are tracked to match the scoping of the evaluator
+type scope struct {
+	symbols  *compiler.SymbolTable
+	outer    *scope
+	bindings map[string]*symbol
+	// start and end delimit the scope in the source, the program has no end
+	start, end token.Position
+	// function is the let binding of the function the scope belongs to, calls to it are recursive
+	function *symbol
+}
+
+func (s *scope) contains(pos token.Position) bool {
+	return !before(pos, s.start) && (s.end.Line == 0 || !before(s.end, pos))
+}
+
+// index resolves the identifiers of a program to their symbols
+type index struct {
+	scope  *scope
+	scopes []*scope
+	// symbols are all the symbols, in declaration order
+	symbols []*symbol
+	// occurrences maps the position of each identifier to its symbol
+	occurrences map[token.Position]*symbol
+	predeclared map[string]*symbol
+}
+
+func newIndex(program *ast.Program, globals []string) *index {
+	idx := &index{occurrences: map[token.Position]*symbol{}, predeclared: map[string]*symbol{}}
+	idx.scope = &scope{symbols: prelude.SymbolTable(), bindings: map[string]*symbol{}, start: token.Position{Line: 1, Column: 1}}
+	idx.scopes = append(idx.scopes, idx.scope)
+
+	for _, b := range value.Builtins() {
+		idx.predeclare(b.Name, kindBuiltin, b.Signature())
+	}
+	for _, stmt := range prelude.Program().Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			idx.predeclare(let.Name.Value, kindPrelude, describeLet(let))
+		}
+	}
+	for _, name := range globals {
+		idx.predeclare(name, kindGlobal, "")
+		idx.scope.symbols.Define(name)
+	}
+
+	idx.statements(program.Statements)
+	return idx
+}
+
+func (idx *index) predeclare(name, kind, detail string) {
+	idx.predeclared[name] = &symbol{name: name, kind: kind, detail: detail, scope: idx.scope}
+}
+
+// at returns the symbol of the identifier at pos and where the identifier starts
+func (idx *index) at(pos token.Position) (*symbol, token.Position) {
+	for p, s := range idx.occurrences {
+		if p.Line == pos.Line && p.Column <= pos.Column && pos.Column <= p.Column+len(s.name) {
+			return s, p
+		}
+	}
+
+	return nil, token.Position{}
+}
+
+// visible returns the symbols that can be referred to at pos, the innermost ones
+// first. Predeclared names are included unless they are shadowed
+func (idx *index) visible(pos token.Position) []*symbol {
+	seen := map[string]bool{}
+	var visible []*symbol
+
+	scopes := append([]*scope{}, idx.scopes...)
+	sort.SliceStable(scopes, func(i, j int) bool { return before(scopes[j].start, scopes[i].start) })
+
+	for _, s := range scopes {
+		if !s.contains(pos) {
+			continue
+		}
+
+		var names []string
+		for name, sym := range s.bindings {
+			if before(sym.pos, pos) && !seen[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			seen[name] = true
+			visible = append(visible, s.bindings[name])
+		}
+	}
+
+	var names []string
+	for name := range idx.predeclared {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		visible = append(visible, idx.predeclared[name])
+	}
+
+	return visible
+}
+
+func (idx *index) openScope(start, end token.Position, function *symbol) {
+	idx.scope = &scope{
+		symbols:  compiler.NewEnclosedSymbolTable(idx.scope.symbols),
+		outer:    idx.scope,
+		bindings: map[string]*symbol{},
+		start:    start,
+		end:      end,
+		function: function,
+	}
+	idx.scopes = append(idx.scopes, idx.scope)
+}
+
+func (idx *index) closeScope() {
+	idx.scope = idx.scope.outer
+}
+
+// declare adds a binding to the current scope. Bindings with the same name in
+// the same scope are different symbols, the new one hides the previous one
+func (idx *index) declare(sym *symbol, name *ast.Identifier) {
+	sym.name, sym.pos, sym.scope = name.Value, name.Pos(), idx.scope
+	idx.scope.symbols.Define(name.Value)
+	idx.scope.bindings[name.Value] = sym
+	idx.symbols = append(idx.symbols, sym)
+	idx.refer(sym, name.Pos())
+}
+
+func (idx *index) refer(sym *symbol, pos token.Position) {
+	sym.refs = append(sym.refs, pos)
+	idx.occurrences[pos] = sym
+}
+
+// resolve finds the symbol an identifier refers to
+func (idx *index) resolve(ident *ast.Identifier) {
+	if _, ok := idx.scope.symbols.Resolve(ident.Value); !ok {
+		return
+	}
+
+	for s := idx.scope; s != nil; s = s.outer {
+		if sym, ok := s.bindings[ident.Value]; ok {
+			idx.refer(sym, ident.Pos())
+			return
+		}
+		if s.function != nil && s.function.name == ident.Value {
+			idx.refer(s.function, ident.Pos())
+			return
+		}
+	}
+
+	if sym, ok := idx.predeclared[ident.Value]; ok {
+		idx.refer(sym, ident.Pos())
+	}
+}
+
+func (idx *index) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		idx.statement(stmt)
+	}
+}
+
+// statement indexes a statement. Statements that failed to parse are nil
+func (idx *index) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt == nil {
+			return
+		}
+		sym := &symbol{kind: kindLet, detail: describeLet(stmt)}
+		if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && fn.Name != "" {
+			// the name is pending until the function is compiled, calls in the body are recursive
+			sym.name = fn.Name
+			idx.function(fn, sym)
+		} else {
+			idx.expression(stmt.Value)
+		}
+		idx.declare(sym, stmt.Name)
+	case *ast.ImportStatement:
+		if stmt == nil {
+			return
+		}
+		idx.declare(&symbol{kind: kindImport, detail: fmt.Sprintf("import %q as %s", stmt.Path, stmt.Name.Value)}, stmt.Name)
+	case *ast.ReturnStatement:
+		if stmt != nil {
+			idx.expression(stmt.ReturnValue)
+		}
+	case *ast.ExpressionStatement:
+		if stmt != nil {
+			idx.expression(stmt.Expression)
+		}
+	case *ast.BlockStatment:
+		if stmt != nil {
+			idx.statements(stmt.Statements)
+		}
+	}
+}
+
+func (idx *index) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		idx.resolve(e)
+
+	case *ast.PrefixExpression:
+		idx.expression(e.Right)
+
+	case *ast.InfixExpression:
+		idx.expression(e.Left)
+		idx.expression(e.Right)
+
+	case *ast.InExpression:
+		idx.expression(e.Element)
+		idx.expression(e.Iterable)
+
+	case *ast.AssignExpression:
+		idx.expression(e.Value)
+		idx.resolve(e.Identifier)
+
+	case *ast.CallExpression:
+		idx.expression(e.Function)
+		for _, arg := range e.Arguments {
+			idx.expression(arg)
+		}
+
+	case *ast.IndexExpression:
+		idx.expression(e.Left)
+		idx.expression(e.Index)
+
+	case *ast.ArrayLiteral:
+		for _, element := range e.Elements {
+			idx.expression(element)
+		}
+
+	case *ast.HashLiteral:
+		for key, value := range e.Pairs {
+			idx.expression(key)
+			idx.expression(value)
+		}
+
+	case *ast.IfExpression:
+		idx.expression(e.Condition)
+		idx.statements(e.Consequence.Statements)
+		if e.Alternative != nil {
+			idx.statements(e.Alternative.Statements)
+		}
+
+	case *ast.ForExpression:
+		idx.forExpression(e)
+
+	case *ast.FunctionLiteral:
+		idx.function(e, nil)
+	}
+}
+
+// function indexes a function literal, self is the let binding of a named function
+func (idx *index) function(fn *ast.FunctionLiteral, self *symbol) {
+	idx.openScope(fn.Pos(), fn.Body.End, self)
+	if self != nil {
+		idx.scope.symbols.DefineFunctionName(fn.Name)
+	}
+	for _, param := range fn.Parameters {
+		idx.declare(&symbol{kind: kindParameter}, param)
+	}
+	idx.statements(fn.Body.Statements)
+	idx.closeScope()
+}
+
+// forExpression indexes a loop, its body and the variable of `for x in items` are in a new scope
+func (idx *index) forExpression(e *ast.ForExpression) {
+	in, ok := e.Condition.(*ast.InExpression)
+	if !ok {
+		idx.expression(e.Condition)
+		idx.openScope(e.Pos(), e.Body.End, nil)
+	} else if element, ok := in.Element.(*ast.Identifier); ok {
+		idx.expression(in.Iterable)
+		idx.openScope(e.Pos(), e.Body.End, nil)
+		idx.declare(&symbol{kind: kindLoop}, element)
+	} else {
+		idx.expression(in)
+		idx.openScope(e.Pos(), e.Body.End, nil)
+	}
+
+	idx.statements(e.Body.Statements)
+	idx.closeScope()
+}
+
+// describeLet returns `let name` or the signature of a let-bound function
+func describeLet(let *ast.LetStatement) string {
+	fn, ok := let.Value.(*ast.FunctionLiteral)
+	if !ok {
+		return "let " + let.Name.Value
+	}
+
+	params := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		params[i] = p.Value
+	}
+	return fmt.Sprintf("let %s = fn(%s)", let.Name.Value, strings.Join(params, ", "))
+}
+
+// before reports whether a is before b
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
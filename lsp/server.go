@@ -0,0 +1,542 @@
+// Package lsp implements a Language Server Protocol server for simia. It publishes
+// parse, compilation and lint diagnostics and answers hover, definition, references,
+// completion and formatting requests for the open documents
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/format"
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/lint"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/prelude"
+	"protiumx.dev/simia/token"
+)
+
+const source = "simia"
+
+type Options struct {
+	// Globals are the names defined by the host, e.g. `args` for the scripts run by simia
+	Globals []string
+}
+
+// Serve reads requests from r and writes responses and notifications to w until the
+// client sends `exit` or r is closed. Messages use the base protocol framing
+func Serve(r io.Reader, w io.Writer, opts Options) error {
+	s := &server{
+		in:        bufio.NewReader(r),
+		out:       w,
+		opts:      opts,
+		documents: map[string]*document{},
+	}
+
+	for {
+		data, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			// the ID of the request is unknown, the error is reported and the next message read
+			code := codeParseError
+			if json.Valid(data) {
+				code = codeInvalidRequest
+			}
+			respErr := &responseError{Code: code, Message: fmt.Sprintf("invalid message: %s", err)}
+			if err := s.write(errorResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: respErr}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			return nil
+		}
+
+		if err := s.handle(&req); err != nil {
+			return err
+		}
+	}
+}
+
+type server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	opts      Options
+	documents map[string]*document
+	shutdown  bool
+	// utf8 is set when the client counts characters in bytes instead of UTF-16 code units
+	utf8 bool
+}
+
+// document is an open file, it is analyzed on every change
+type document struct {
+	uri     string
+	text    string
+	lines   []string
+	utf8    bool
+	program *ast.Program
+	index   *index
+}
+
+// read returns the content of the next message
+func (s *server) read() ([]byte, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length == -1 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("lsp: reading header: %w", err)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("lsp: invalid Content-Length %q", value)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, errors.New("lsp: missing Content-Length header")
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.in, data); err != nil {
+		return nil, fmt.Errorf("lsp: reading content: %w", err)
+	}
+
+	return data, nil
+}
+
+func (s *server) write(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+func (s *server) notify(method string, params any) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle dispatches a request or a notification. Notifications have no ID and get no response
+func (s *server) handle(req *request) error {
+	result, err := s.dispatch(req)
+	if req.ID == nil {
+		return nil
+	}
+
+	if err != nil {
+		var respErr *responseError
+		if !errors.As(err, &respErr) {
+			return err
+		}
+		return s.write(errorResponse{JSONRPC: "2.0", ID: *req.ID, Error: respErr})
+	}
+
+	return s.write(response{JSONRPC: "2.0", ID: *req.ID, Result: result})
+}
+
+func (s *server) dispatch(req *request) (any, error) {
+	if s.shutdown {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "the server is shut down"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		var params initializeParams
+		if len(req.Params) > 0 {
+			if err := decode(req.Params, &params); err != nil {
+				return nil, err
+			}
+		}
+		encoding := encodingUTF16
+		for _, e := range params.Capabilities.General.PositionEncodings {
+			if e == encodingUTF8 {
+				encoding, s.utf8 = encodingUTF8, true
+			}
+		}
+
+		return map[string]any{
+			"capabilities": map[string]any{
+				"positionEncoding":           encoding,
+				"textDocumentSync":           1, // full documents
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"referencesProvider":         true,
+				"completionProvider":         map[string]any{},
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]any{"name": source},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.open(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			return nil, s.open(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+
+	case "textDocument/hover":
+		var params positionParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params)
+	case "textDocument/definition":
+		var params positionParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params)
+	case "textDocument/references":
+		var params referenceParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.references(params)
+	case "textDocument/completion":
+		var params positionParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(params)
+	case "textDocument/formatting":
+		var params formattingParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.formatting(params)
+	}
+
+	if strings.HasPrefix(req.Method, "$/") {
+		// optional notifications, e.g. $/cancelRequest
+		return nil, nil
+	}
+
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+}
+
+func decode(data json.RawMessage, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// open analyzes a new version of a document and publishes its diagnostics
+func (s *server) open(uri, text string) error {
+	// the shebang line is blanked so line numbers are kept, as when running the script
+	_, src := splitShebang(text)
+	src = strings.Repeat("\n", strings.Count(text, "\n")-strings.Count(src, "\n")) + src
+
+	doc := &document{uri: uri, text: text, lines: strings.Split(text, "\n"), utf8: s.utf8}
+	s.documents[uri] = doc
+
+	l := lexer.New(src)
+	p := parser.New(l)
+	doc.program = p.ParseProgram()
+	doc.index = newIndex(doc.program, s.opts.Globals)
+
+	diagnostics := []Diagnostic{}
+	for _, err := range p.PositionedErrors() {
+		diagnostics = append(diagnostics, doc.diagnostic(err.Pos, severityError, "", err.Message))
+	}
+
+	if len(diagnostics) == 0 {
+		if err := s.compile(doc); err != nil {
+			var compileErr *compiler.Error
+			pos := token.Position{Line: 1, Column: 1}
+			if errors.As(err, &compileErr) {
+				pos = compileErr.Pos
+			}
+			diagnostics = append(diagnostics, doc.diagnostic(pos, severityError, "", err.Error()))
+		}
+
+		for _, d := range lint.Program(doc.program, l.Comments(), lint.Options{Globals: s.opts.Globals}) {
+			diagnostics = append(diagnostics, doc.diagnostic(d.Pos, severityWarning, d.Rule, d.Message))
+		}
+	}
+
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+// compile compiles a document as simia runs it, with the prelude and the host globals.
+// Imports are resolved relative to the document directory
+func (s *server) compile(doc *document) error {
+	symbols := prelude.SymbolTable()
+	for _, name := range s.opts.Globals {
+		symbols.Define(name)
+	}
+
+	var opts []compiler.Option
+	if path, ok := filePath(doc.uri); ok {
+		opts = append(opts, compiler.WithResolver(module.NewDirResolver(filepath.Dir(path))))
+	}
+
+	return compiler.NewWithState(symbols, prelude.Constants(), opts...).Compile(doc.program)
+}
+
+// filePath returns the path of a file URI
+func filePath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
+}
+
+func (s *server) document(uri string) (*document, error) {
+	doc, ok := s.documents[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: fmt.Sprintf("document not open: %s", uri)}
+	}
+	return doc, nil
+}
+
+func (s *server) hover(params positionParams) (any, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	sym, start := doc.index.at(doc.offset(params.Position))
+	if sym == nil {
+		return nil, nil
+	}
+
+	var text string
+	switch sym.kind {
+	case kindBuiltin, kindPrelude:
+		text = fmt.Sprintf("```simia\n%s\n```\n%s", sym.detail, sym.kind)
+	case kindLet, kindImport:
+		text = fmt.Sprintf("```simia\n%s\n```", sym.detail)
+	default:
+		text = fmt.Sprintf("```simia\n%s\n```\n%s", sym.name, sym.kind)
+	}
+
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: text},
+		Range:    doc.span(start, sym.name),
+	}, nil
+}
+
+func (s *server) definition(params positionParams) (any, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	sym, _ := doc.index.at(doc.offset(params.Position))
+	if sym == nil || sym.pos.Line == 0 {
+		return nil, nil
+	}
+
+	return Location{URI: doc.uri, Range: doc.span(sym.pos, sym.name)}, nil
+}
+
+func (s *server) references(params referenceParams) (any, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	locations := []Location{}
+	sym, _ := doc.index.at(doc.offset(params.Position))
+	if sym == nil {
+		return locations, nil
+	}
+
+	for _, pos := range sym.refs {
+		if pos == sym.pos && !params.Context.IncludeDeclaration {
+			continue
+		}
+		locations = append(locations, Location{URI: doc.uri, Range: doc.span(pos, sym.name)})
+	}
+
+	return locations, nil
+}
+
+func (s *server) completion(params positionParams) (any, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []CompletionItem{}
+	for _, sym := range doc.index.visible(doc.offset(params.Position)) {
+		item := CompletionItem{Label: sym.name, Kind: completionVariable, Detail: sym.detail}
+		switch {
+		case sym.kind == kindBuiltin || sym.kind == kindPrelude:
+			item.Kind = completionFunction
+		case sym.kind == kindImport:
+			item.Kind = completionModule
+		case strings.Contains(sym.detail, "= fn("):
+			item.Kind = completionFunction
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// formatting replaces the whole document, there are no edits for documents with parse errors
+func (s *server) formatting(params formattingParams) (any, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	shebang, src := splitShebang(doc.text)
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, nil
+	}
+
+	last := len(doc.lines) - 1
+	whole := Range{End: doc.position(token.Position{Line: last + 1, Column: len(doc.lines[last]) + 1})}
+	return []TextEdit{{Range: whole, NewText: shebang + formatted}}, nil
+}
+
+// splitShebang separates the shebang line of a script, including its newline
+func splitShebang(text string) (string, string) {
+	if !strings.HasPrefix(text, "#!") {
+		return "", text
+	}
+
+	end := strings.IndexByte(text, '\n') + 1
+	if end == 0 {
+		return text, ""
+	}
+	return text[:end], text[end:]
+}
+
+// diagnostic spans the word at pos
+func (doc *document) diagnostic(pos token.Position, severity int, code, msg string) Diagnostic {
+	word := ""
+	if pos.Line >= 1 && pos.Line <= len(doc.lines) && pos.Column >= 1 {
+		line := doc.lines[pos.Line-1]
+		start := pos.Column - 1
+		end := start
+		for end < len(line) && isWordByte(line[end]) {
+			end++
+		}
+		if end == start && start < len(line) {
+			end++
+		}
+		if start < len(line) {
+			word = line[start:end]
+		}
+	}
+
+	return Diagnostic{Range: doc.span(pos, word), Severity: severity, Code: code, Source: source, Message: msg}
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// span returns the range of text starting at pos
+func (doc *document) span(pos token.Position, text string) Range {
+	end := token.Position{Line: pos.Line, Column: pos.Column + len(text)}
+	return Range{Start: doc.position(pos), End: doc.position(end)}
+}
+
+// position converts a source position, whose columns count bytes, to the encoding of the client
+func (doc *document) position(pos token.Position) Position {
+	if pos.Line == 0 {
+		return Position{}
+	}
+
+	character := pos.Column - 1
+	if !doc.utf8 && pos.Line <= len(doc.lines) && character >= 0 {
+		line := doc.lines[pos.Line-1]
+		if character > len(line) {
+			character = utf16Len(line) + character - len(line)
+		} else {
+			character = utf16Len(line[:character])
+		}
+	}
+
+	return Position{Line: pos.Line - 1, Character: character}
+}
+
+// offset converts a position of the client to a source position
+func (doc *document) offset(pos Position) token.Position {
+	column := pos.Character
+	if !doc.utf8 && pos.Line < len(doc.lines) {
+		line := doc.lines[pos.Line]
+		column = 0
+		units := 0
+		for column < len(line) && units < pos.Character {
+			r, size := utf8.DecodeRuneInString(line[column:])
+			units += utf16.RuneLen(r)
+			column += size
+		}
+		// positions past the end of the line are kept
+		if units < pos.Character {
+			column += pos.Character - units
+		}
+	}
+
+	return token.Position{Line: pos.Line + 1, Column: column + 1}
+}
+
+// utf16Len returns the number of UTF-16 code units of s
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
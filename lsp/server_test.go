@@ -0,0 +1,441 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const uri = "file:///tmp/main.sm"
+
+// session sends requests to a server and returns the messages it wrote
+type session struct {
+	t   *testing.T
+	in  bytes.Buffer
+	ids int
+}
+
+func (s *session) send(method string, params any) {
+	s.t.Helper()
+	s.ids++
+	s.write(map[string]any{"jsonrpc": "2.0", "id": s.ids, "method": method, "params": params})
+}
+
+func (s *session) notify(method string, params any) {
+	s.t.Helper()
+	s.write(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (s *session) write(msg any) {
+	s.t.Helper()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// message is a response or a notification written by the server
+type message struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// run serves the requests and returns the responses by ID and the notifications
+func (s *session) run() (map[int]message, []message) {
+	s.t.Helper()
+	s.notify("exit", nil)
+
+	var out bytes.Buffer
+	if err := Serve(&s.in, &out, Options{Globals: []string{"args"}}); err != nil {
+		s.t.Fatalf("unexpected error: %s", err)
+	}
+
+	responses := map[int]message{}
+	var notifications []message
+	r := bufio.NewReader(&out)
+	for {
+		header, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+		if err != nil {
+			s.t.Fatalf("invalid header %q", header)
+		}
+		r.ReadString('\n')
+
+		data := make([]byte, length)
+		io.ReadFull(r, data)
+
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.t.Fatal(err)
+		}
+		if msg.Method != "" {
+			notifications = append(notifications, msg)
+		} else {
+			responses[msg.ID] = msg
+		}
+	}
+
+	return responses, notifications
+}
+
+func open(s *session, text string) {
+	s.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "simia", "version": 1, "text": text},
+	})
+}
+
+func at(line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+func decodeResult(t *testing.T, msg message, v any) {
+	t.Helper()
+	if msg.Error != nil {
+		t.Fatalf("unexpected error: %s", msg.Error.Message)
+	}
+	if err := json.Unmarshal(msg.Result, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	s := &session{t: t}
+	s.send("initialize", map[string]any{"capabilities": map[string]any{}})
+	s.notify("initialized", map[string]any{})
+	s.send("workspace/symbol", map[string]any{"query": ""})
+	s.send("shutdown", nil)
+	s.send("textDocument/hover", at(0, 0))
+
+	responses, _ := s.run()
+
+	var result struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	decodeResult(t, responses[1], &result)
+	for _, capability := range []string{"hoverProvider", "definitionProvider", "referencesProvider", "completionProvider", "documentFormattingProvider"} {
+		if _, ok := result.Capabilities[capability]; !ok {
+			t.Errorf("missing capability %s", capability)
+		}
+	}
+
+	if err := responses[2].Error; err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", err)
+	}
+	if err := responses[3].Error; err != nil {
+		t.Errorf("unexpected shutdown error: %s", err.Message)
+	}
+	if err := responses[4].Error; err == nil || err.Code != codeInvalidRequest {
+		t.Errorf("expected an invalid request after shutdown, got %+v", err)
+	}
+}
+
+func TestInvalidMessages(t *testing.T) {
+	s := &session{t: t}
+	for _, body := range []string{"{", "[1]"} {
+		fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	s.send("shutdown", nil)
+
+	var out bytes.Buffer
+	s.notify("exit", nil)
+	if err := Serve(&s.in, &out, Options{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the error responses have a null ID, the server keeps reading after them
+	output := out.String()
+	for _, expected := range []string{`"id":null,"error":{"code":-32700`, `"id":null,"error":{"code":-32600`, `"id":1,"result":null`} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %s in the output, got %s", expected, output)
+		}
+	}
+}
+
+func TestPositionEncoding(t *testing.T) {
+	// é is one UTF-16 code unit and two bytes, the emoji two code units and four bytes
+	text := "let s = \"é😀\"; log(s, y);"
+	tests := []struct {
+		encodings []string
+		encoding  string
+		// character is the column of `y`, s is three characters before it
+		character int
+	}{
+		{nil, encodingUTF16, 22},
+		{[]string{encodingUTF16}, encodingUTF16, 22},
+		{[]string{encodingUTF8, encodingUTF16}, encodingUTF8, 25},
+	}
+
+	for _, tt := range tests {
+		s := &session{t: t}
+		s.send("initialize", map[string]any{"capabilities": map[string]any{"general": map[string]any{"positionEncodings": tt.encodings}}})
+		open(s, text)
+		s.send("textDocument/hover", at(0, tt.character-3))
+		s.send("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}})
+		responses, notifications := s.run()
+
+		var result struct {
+			Capabilities struct {
+				PositionEncoding string `json:"positionEncoding"`
+			} `json:"capabilities"`
+		}
+		decodeResult(t, responses[1], &result)
+		if result.Capabilities.PositionEncoding != tt.encoding {
+			t.Errorf("%v: expected %s, got %s", tt.encodings, tt.encoding, result.Capabilities.PositionEncoding)
+		}
+
+		var params publishDiagnosticsParams
+		json.Unmarshal(notifications[0].Params, &params)
+		expected := Range{Start: Position{0, tt.character}, End: Position{0, tt.character + 1}}
+		if len(params.Diagnostics) != 1 || params.Diagnostics[0].Range != expected {
+			t.Errorf("%v: expected a diagnostic at %+v, got %+v", tt.encodings, expected, params.Diagnostics)
+		}
+
+		var hover Hover
+		decodeResult(t, responses[2], &hover)
+		if hover.Contents.Value != "```simia\nlet s\n```" {
+			t.Errorf("%v: wrong hover %q", tt.encodings, hover.Contents.Value)
+		}
+
+		var edits []TextEdit
+		decodeResult(t, responses[3], &edits)
+		if end := (Position{0, tt.character + 3}); len(edits) != 1 || edits[0].Range.End != end {
+			t.Errorf("%v: expected the edit to end at %+v, got %+v", tt.encodings, end, edits)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Diagnostic
+	}{
+		{"let x = 1;\nx", nil},
+		{
+			"let x = 1;\nlet = 2;",
+			[]Diagnostic{
+				{Range: Range{Start: Position{1, 4}, End: Position{1, 5}}, Severity: severityError, Source: source, Message: "expected next token to be IDENT, got ="},
+				{Range: Range{Start: Position{1, 4}, End: Position{1, 5}}, Severity: severityError, Source: source, Message: "no prefix parse function for = found"},
+			},
+		},
+		{
+			"let x = 1;\nlog(x + y);",
+			[]Diagnostic{
+				{Range: Range{Start: Position{1, 8}, End: Position{1, 9}}, Severity: severityError, Source: source, Message: "undefined variable y"},
+			},
+		},
+		{
+			"let unused = 1;\nlog(len(1, 2), args);",
+			[]Diagnostic{
+				{Range: Range{Start: Position{0, 4}, End: Position{0, 10}}, Severity: severityWarning, Code: "unused", Source: source, Message: "unused is declared and not used"},
+				{Range: Range{Start: Position{1, 4}, End: Position{1, 7}}, Severity: severityWarning, Code: "arity", Source: source, Message: "wrong number of arguments to len(value: STRING or ARRAY or HASH). got=2, want=1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		s := &session{t: t}
+		open(s, tt.input)
+		_, notifications := s.run()
+
+		if len(notifications) != 1 || notifications[0].Method != "textDocument/publishDiagnostics" {
+			t.Fatalf("%q: expected one diagnostics notification, got %+v", tt.input, notifications)
+		}
+
+		var params publishDiagnosticsParams
+		json.Unmarshal(notifications[0].Params, &params)
+		if params.URI != uri {
+			t.Errorf("%q: wrong uri %q", tt.input, params.URI)
+		}
+		if len(params.Diagnostics) != len(tt.expected) {
+			t.Errorf("%q: expected %d diagnostics, got %+v", tt.input, len(tt.expected), params.Diagnostics)
+			continue
+		}
+		for i, d := range tt.expected {
+			if params.Diagnostics[i] != d {
+				t.Errorf("%q: wrong diagnostic %d.\nexpected %+v\ngot      %+v", tt.input, i, d, params.Diagnostics[i])
+			}
+		}
+	}
+}
+
+func TestCloseClearsDiagnostics(t *testing.T) {
+	s := &session{t: t}
+	open(s, "log(y)")
+	s.notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	s.send("textDocument/hover", at(0, 0))
+	responses, notifications := s.run()
+
+	var params publishDiagnosticsParams
+	json.Unmarshal(notifications[len(notifications)-1].Params, &params)
+	if len(notifications) != 2 || len(params.Diagnostics) != 0 {
+		t.Errorf("expected the diagnostics to be cleared, got %+v", notifications)
+	}
+	if err := responses[1].Error; err == nil || err.Code != codeInvalidParams {
+		t.Errorf("expected an error for a closed document, got %+v", err)
+	}
+}
+
+const program = `let total = 0;
+let add = fn(a, b) { a + b };
+let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+for (i in 1..3) {
+  total = add(total, i);
+}
+log(len(args), total);`
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{6, 5, "```simia\nlen(value: STRING or ARRAY or HASH)\n```\nbuiltin"},
+		{4, 12, "```simia\nlet add = fn(a, b)\n```"},
+		{1, 22, "```simia\na\n```\nparameter"},
+		{2, 48, "```simia\nlet fact = fn(n)\n```"},
+		{6, 9, "```simia\nargs\n```\nglobal"},
+	}
+
+	s := &session{t: t}
+	open(s, program)
+	for _, tt := range tests {
+		s.send("textDocument/hover", at(tt.line, tt.character))
+	}
+	s.send("textDocument/hover", at(1, 0))
+	responses, _ := s.run()
+
+	for i, tt := range tests {
+		var hover Hover
+		decodeResult(t, responses[i+1], &hover)
+		if hover.Contents.Value != tt.expected {
+			t.Errorf("%d:%d: wrong hover. expected %q, got %q", tt.line, tt.character, tt.expected, hover.Contents.Value)
+		}
+	}
+
+	if result := string(responses[len(tests)+1].Result); result != "null" {
+		t.Errorf("expected no hover on a keyword, got %s", result)
+	}
+}
+
+func TestDefinitionAndReferences(t *testing.T) {
+	s := &session{t: t}
+	open(s, program)
+	s.send("textDocument/definition", at(4, 12))
+	s.send("textDocument/definition", at(2, 48))
+	s.send("textDocument/definition", at(6, 5))
+
+	refs := at(0, 5)
+	refs["context"] = map[string]any{"includeDeclaration": true}
+	s.send("textDocument/references", refs)
+	refs = at(4, 16)
+	refs["context"] = map[string]any{"includeDeclaration": false}
+	s.send("textDocument/references", refs)
+	responses, _ := s.run()
+
+	definitions := []Range{
+		{Start: Position{1, 4}, End: Position{1, 7}},
+		{Start: Position{2, 4}, End: Position{2, 8}},
+	}
+	for i, expected := range definitions {
+		var location Location
+		decodeResult(t, responses[i+1], &location)
+		if location.URI != uri || location.Range != expected {
+			t.Errorf("definition %d: expected %+v, got %+v", i, expected, location)
+		}
+	}
+	if result := string(responses[3].Result); result != "null" {
+		t.Errorf("expected no definition for a builtin, got %s", result)
+	}
+
+	tests := []struct {
+		id       int
+		expected []Position
+	}{
+		{4, []Position{{0, 4}, {4, 14}, {4, 2}, {6, 15}}},
+		{5, []Position{{4, 14}, {4, 2}, {6, 15}}},
+	}
+	for _, tt := range tests {
+		var locations []Location
+		decodeResult(t, responses[tt.id], &locations)
+		var got []Position
+		for _, l := range locations {
+			got = append(got, l.Range.Start)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("references %d: expected %v, got %v", tt.id, tt.expected, got)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	s := &session{t: t}
+	open(s, program)
+	s.send("textDocument/completion", at(1, 21))
+	s.send("textDocument/completion", at(0, 0))
+	responses, _ := s.run()
+
+	var items []CompletionItem
+	decodeResult(t, responses[1], &items)
+	labels := map[string]CompletionItem{}
+	for _, item := range items {
+		labels[item.Label] = item
+	}
+
+	for _, name := range []string{"a", "b", "total", "len", "args"} {
+		if _, ok := labels[name]; !ok {
+			t.Errorf("missing completion %s", name)
+		}
+	}
+	for _, name := range []string{"fact", "i"} {
+		if _, ok := labels[name]; ok {
+			t.Errorf("unexpected completion %s", name)
+		}
+	}
+	if item := labels["len"]; item.Kind != completionFunction || item.Detail != "len(value: STRING or ARRAY or HASH)" {
+		t.Errorf("wrong builtin completion %+v", item)
+	}
+	if items[0].Label != "a" {
+		t.Errorf("expected the innermost names first, got %s", items[0].Label)
+	}
+
+	decodeResult(t, responses[2], &items)
+	for _, item := range items {
+		if item.Label == "total" {
+			t.Error("unexpected completion of a later declaration")
+		}
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	s := &session{t: t}
+	open(s, "#!/usr/bin/env simia\nlet x=1\nx")
+	s.send("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	open(s, "let = 1")
+	s.send("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	responses, _ := s.run()
+
+	var edits []TextEdit
+	decodeResult(t, responses[1], &edits)
+	expected := TextEdit{Range: Range{End: Position{2, 1}}, NewText: "#!/usr/bin/env simia\nlet x = 1;\nx;\n"}
+	if len(edits) != 1 || edits[0] != expected {
+		t.Errorf("wrong edits. expected %+v, got %+v", expected, edits)
+	}
+
+	if result := string(responses[2].Result); result != "null" {
+		t.Errorf("expected no edits with parse errors, got %s", result)
+	}
+}
@@ -0,0 +1,122 @@
+// Package module resolves and parses the modules loaded with `import`
+package module
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/parser"
+)
+
+// Ext is the extension of module files
+const Ext = ".sm"
+
+// Resolver loads the source of a module from its import path
+type Resolver interface {
+	Resolve(path string) (string, error)
+}
+
+// MapResolver resolves modules from memory, mapping import paths to sources
+type MapResolver map[string]string
+
+func (m MapResolver) Resolve(path string) (string, error) {
+	src, ok := m[path]
+	if !ok {
+		return "", fmt.Errorf("module %q not found", path)
+	}
+
+	return src, nil
+}
+
+// FSResolver resolves `import "lib/strings"` to the file lib/strings.sm of the file system,
+// which can be an embed.FS or os.DirFS
+type FSResolver struct {
+	FS fs.FS
+}
+
+func NewFSResolver(fsys fs.FS) *FSResolver {
+	return &FSResolver{FS: fsys}
+}
+
+// NewDirResolver resolves modules relative to a directory of the OS file system
+func NewDirResolver(dir string) *FSResolver {
+	return NewFSResolver(os.DirFS(dir))
+}
+
+func (r *FSResolver) Resolve(importPath string) (string, error) {
+	name := importPath + Ext
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid module path %q", importPath)
+	}
+
+	src, err := fs.ReadFile(r.FS, name)
+	if err != nil {
+		return "", fmt.Errorf("module %q not found: %w", importPath, err)
+	}
+
+	return string(src), nil
+}
+
+// Loader parses each module once and detects import cycles.
+// Enter and Exit must be called around the compilation or evaluation of a module
+type Loader struct {
+	resolver Resolver
+	programs map[string]*ast.Program
+	loading  []string
+}
+
+func NewLoader(r Resolver) *Loader {
+	return &Loader{resolver: r, programs: make(map[string]*ast.Program)}
+}
+
+// Enter returns the parsed module and marks it as being loaded
+func (l *Loader) Enter(importPath string) (*ast.Program, error) {
+	if l.resolver == nil {
+		return nil, fmt.Errorf("cannot import %q: no module resolver configured", importPath)
+	}
+
+	for i, p := range l.loading {
+		if p == importPath {
+			cycle := append(l.loading[i:len(l.loading):len(l.loading)], importPath)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	program, ok := l.programs[importPath]
+	if !ok {
+		src, err := l.resolver.Resolve(importPath)
+		if err != nil {
+			return nil, err
+		}
+
+		p := parser.New(lexer.New(src))
+		program = p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return nil, fmt.Errorf("module %q has parse errors:\n\t%s", importPath, strings.Join(p.Errors(), "\n\t"))
+		}
+		l.programs[importPath] = program
+	}
+
+	l.loading = append(l.loading, importPath)
+	return program, nil
+}
+
+// Exit marks the last entered module as loaded
+func (l *Loader) Exit() {
+	l.loading = l.loading[:len(l.loading)-1]
+}
+
+// Exports returns the names of the `export let` statements of the module in order
+func Exports(program *ast.Program) []string {
+	names := []string{}
+	for _, s := range program.Statements {
+		if let, ok := s.(*ast.LetStatement); ok && let.Exported {
+			names = append(names, let.Name.Value)
+		}
+	}
+	return names
+}
@@ -0,0 +1,80 @@
+package module
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestResolvers(t *testing.T) {
+	fsys := fstest.MapFS{"lib/strings.sm": {Data: []byte(`export let x = 1`)}}
+	resolvers := map[string]Resolver{
+		"map": MapResolver{"lib/strings": `export let x = 1`},
+		"fs":  NewFSResolver(fsys),
+	}
+
+	for name, r := range resolvers {
+		src, err := r.Resolve("lib/strings")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+
+		if src != `export let x = 1` {
+			t.Errorf("%s: wrong source. got=%q", name, src)
+		}
+
+		if _, err := r.Resolve("lib/missing"); err == nil || !strings.Contains(err.Error(), `module "lib/missing" not found`) {
+			t.Errorf("%s: expected not found error, got %v", name, err)
+		}
+	}
+
+	if _, err := NewFSResolver(fsys).Resolve("../secret"); err == nil || !strings.Contains(err.Error(), "invalid module path") {
+		t.Errorf("expected invalid path error, got %v", err)
+	}
+}
+
+func TestLoader(t *testing.T) {
+	l := NewLoader(MapResolver{
+		"a":   `import "b"; export let x = 1; let y = 2; export let z = fn() { y }`,
+		"b":   `1`,
+		"bad": `let = 1`,
+	})
+
+	program, err := l.Enter("a")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if exports := strings.Join(Exports(program), ","); exports != "x,z" {
+		t.Errorf("wrong exports. got=%s", exports)
+	}
+
+	if _, err := l.Enter("b"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = l.Enter("a")
+	if err == nil || err.Error() != "import cycle: a -> b -> a" {
+		t.Errorf("expected import cycle error, got %v", err)
+	}
+
+	l.Exit()
+	l.Exit()
+
+	again, err := l.Enter("a")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if again != program {
+		t.Error("expected the module to be parsed once")
+	}
+
+	if _, err := l.Enter("bad"); err == nil || !strings.Contains(err.Error(), `module "bad" has parse errors`) {
+		t.Errorf("expected parse error, got %v", err)
+	}
+
+	if _, err := NewLoader(nil).Enter("a"); err == nil {
+		t.Error("expected error without resolver")
+	}
+}
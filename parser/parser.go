@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"path"
 	"strconv"
 
 	"protiumx.dev/simia/ast"
@@ -42,11 +43,21 @@ var precedences = map[token.TokenType]int{
 	token.IN:       IN,
 }
 
+// Precedence returns how tightly an infix operator binds, LOWEST for other tokens
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+
+	return LOWEST
+}
+
 type Parser struct {
 	lexer          *lexer.Lexer
 	currentToken   token.Token
 	peekToken      token.Token
 	errors         []string
+	errorPositions []token.Position
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -105,6 +116,26 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Error is a parse error with the position of the token that caused it
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+// PositionedErrors returns the messages of Errors with their positions
+func (p *Parser) PositionedErrors() []Error {
+	errors := make([]Error, len(p.errors))
+	for i, msg := range p.errors {
+		errors[i] = Error{Pos: p.errorPositions[i], Message: msg}
+	}
+	return errors
+}
+
+func (p *Parser) addError(pos token.Position, msg string) {
+	p.errors = append(p.errors, msg)
+	p.errorPositions = append(p.errorPositions, pos)
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := ast.NewProgram()
 
@@ -132,6 +163,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -161,6 +196,51 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseExportStatement() ast.Statement {
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+
+	stmt := p.parseLetStatement()
+	if stmt == nil {
+		return nil
+	}
+
+	stmt.Exported = true
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.currentToken}
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	stmt.Path = p.currentToken.Literal
+	name, pos := path.Base(stmt.Path), p.currentToken.Pos
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "as" {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		name, pos = p.currentToken.Literal, p.currentToken.Pos
+	} else if !isIdentifier(name) {
+		p.addError(p.currentToken.Pos, fmt.Sprintf("cannot bind module %q to a name, use `as`", stmt.Path))
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Pos: pos}, Value: name}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func isIdentifier(name string) bool {
+	tok := lexer.New(name).NextToken()
+	return tok.Type == token.IDENT && tok.Literal == name
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.currentToken}
 	p.nextToken()
@@ -185,7 +265,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	if p.currentToken.Type == token.ILLEGAL {
-		p.errors = append(p.errors, fmt.Sprintf("illegal token `%s`", p.currentToken.Literal))
+		p.addError(p.currentToken.Pos, fmt.Sprintf("illegal token `%s`", p.currentToken.Literal))
 		return nil
 	}
 
@@ -216,7 +296,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	literal := &ast.IntegerLiteral{Token: p.currentToken}
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
-		p.errors = append(p.errors, fmt.Sprintf("could not parse %q as integer", p.currentToken))
+		p.addError(p.currentToken.Pos, fmt.Sprintf("could not parse %q as integer", p.currentToken))
 		return nil
 	}
 	literal.Value = value
@@ -329,6 +409,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatment {
 		}
 		p.nextToken()
 	}
+	block.End = p.currentToken.Pos
 	return block
 }
 
@@ -377,6 +458,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(functionIdentifier ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.currentToken, Function: functionIdentifier}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.End = p.currentToken.Pos
 	return exp
 }
 
@@ -410,6 +492,7 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.currentToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.End = p.currentToken.Pos
 	return array
 }
 
@@ -447,6 +530,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		return nil
 	}
 
+	hash.End = p.currentToken.Pos
 	return hash
 }
 
@@ -460,7 +544,7 @@ func (p *Parser) parseInExpression(element ast.Expression) ast.Expression {
 func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
 	identifier, ok := left.(*ast.Identifier)
 	if !ok {
-		p.errors = append(p.errors, fmt.Sprintf("expected identifier, got=%T %+v", left, left))
+		p.addError(p.currentToken.Pos, fmt.Sprintf("expected identifier, got=%T %+v", left, left))
 		return nil
 	}
 
@@ -483,19 +567,11 @@ func (p *Parser) peekTokenIs(t token.TokenType) bool {
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
-	}
-
-	return LOWEST
+	return Precedence(p.peekToken.Type)
 }
 
 func (p *Parser) currentPrecedence() int {
-	if p, ok := precedences[p.currentToken.Type]; ok {
-		return p
-	}
-
-	return LOWEST
+	return Precedence(p.currentToken.Type)
 }
 
 // expectPeek checks next token and advances if matches, else appends an error
@@ -510,9 +586,9 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) peekError(expectedToken token.TokenType) {
-	p.errors = append(p.errors, fmt.Sprintf("expected next token to be %s, got %s", expectedToken, p.peekToken.Type))
+	p.addError(p.peekToken.Pos, fmt.Sprintf("expected next token to be %s, got %s", expectedToken, p.peekToken.Type))
 }
 
 func (p *Parser) missingPrefixParseFn(t token.TokenType) {
-	p.errors = append(p.errors, fmt.Sprintf("no prefix parse function for %s found", t))
+	p.addError(p.currentToken.Pos, fmt.Sprintf("no prefix parse function for %s found", t))
 }
@@ -6,6 +6,7 @@ import (
 
 	"protiumx.dev/simia/ast"
 	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -42,6 +43,69 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestExportStatement(t *testing.T) {
+	p := New(lexer.New("export let x = 5;"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok || !stmt.Exported {
+		t.Fatalf("expected exported *ast.LetStatement. got=%#v", program.Statements[0])
+	}
+
+	if stmt.String() != "export let x = 5;" {
+		t.Errorf("wrong string. got=%q", stmt.String())
+	}
+}
+
+func TestImportStatements(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedPath string
+		expectedName string
+		expectedStr  string
+	}{
+		{`import "lib/strings"`, "lib/strings", "strings", `import "lib/strings";`},
+		{`import "lib/strings" as str;`, "lib/strings", "str", `import "lib/strings" as str;`},
+		{`import "my-lib" as lib`, "my-lib", "lib", `import "my-lib" as lib;`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("expected *ast.ImportStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Path != tt.expectedPath || stmt.Name.Value != tt.expectedName {
+			t.Errorf("wrong import. want=%s as %s, got=%s as %s", tt.expectedPath, tt.expectedName, stmt.Path, stmt.Name.Value)
+		}
+
+		if stmt.String() != tt.expectedStr {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expectedStr, stmt.String())
+		}
+	}
+
+	for _, input := range []string{`import "my-lib"`, `import strings`, `import "lib" as`} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parse errors for %q", input)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -1100,3 +1164,68 @@ func TestFunctionLiteralWithName(t *testing.T) {
 	}
 
 }
+
+func TestNodePositions(t *testing.T) {
+	input := "let x = 1;\nfoo(x,\n  bar + 2)"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	infix := call.Arguments[1].(*ast.InfixExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected token.Position
+	}{
+		{program, token.Position{Line: 1, Column: 1}},
+		{let, token.Position{Line: 1, Column: 1}},
+		{let.Name, token.Position{Line: 1, Column: 5}},
+		{let.Value, token.Position{Line: 1, Column: 9}},
+		{call.Function, token.Position{Line: 2, Column: 1}},
+		{call.Arguments[0], token.Position{Line: 2, Column: 5}},
+		{infix, token.Position{Line: 3, Column: 7}},
+		{infix.Left, token.Position{Line: 3, Column: 3}},
+	}
+
+	for _, tt := range tests {
+		if pos := tt.node.Pos(); pos != tt.expected {
+			t.Errorf("%s: expected position %s, got %s", tt.node, tt.expected, pos)
+		}
+	}
+}
+
+func TestBlockEnd(t *testing.T) {
+	input := "fn(x) {\n  x\n  }"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if expected := (token.Position{Line: 3, Column: 3}); fn.Body.End != expected {
+		t.Fatalf("expected block end at %s, got %s", expected, fn.Body.End)
+	}
+}
+
+func TestPositionedErrors(t *testing.T) {
+	p := New(lexer.New("let x = 1;\nlet = 2;\nfoo(@)"))
+	p.ParseProgram()
+
+	expected := []Error{
+		{Pos: token.Position{Line: 2, Column: 5}, Message: "expected next token to be IDENT, got ="},
+		{Pos: token.Position{Line: 2, Column: 5}, Message: "no prefix parse function for = found"},
+		{Pos: token.Position{Line: 3, Column: 5}, Message: "illegal token `@`"},
+	}
+
+	errors := p.PositionedErrors()
+	if len(errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errors)
+	}
+
+	for i, err := range errors {
+		if err != expected[i] {
+			t.Errorf("errors[%d]: expected %+v, got %+v", i, expected[i], err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build ignore
+
+// gen writes prelude.smc from the prelude sources
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/prelude"
+)
+
+func main() {
+	bytecode, err := prelude.Compile()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := compiler.Encode(&out, bytecode); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile("prelude.smc", out.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
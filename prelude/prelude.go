@@ -0,0 +1,227 @@
+// Package prelude is the standard library written in simia. The sources are embedded
+// in the binary and their top-level bindings are available to every script run by
+// the REPL, the embedding package and the hosts that load it
+package prelude
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/code"
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/evaluator"
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/value"
+	"protiumx.dev/simia/vm"
+)
+
+//go:generate go run gen.go
+
+// File is the source name of the functions compiled from the prelude
+const File = "prelude"
+
+//go:embed *.sm
+var sources embed.FS
+
+// precompiled is the prelude in the .smc format, generated from the sources
+//
+//go:embed prelude.smc
+var precompiled []byte
+
+var (
+	parseOnce sync.Once
+	program   *ast.Program
+	names     []string
+
+	compileOnce sync.Once
+	bytecode    *compiler.Bytecode
+	values      []value.Value
+)
+
+// Program returns the statements of all the prelude files, in file name order.
+// The sources are parsed once
+func Program() *ast.Program {
+	parseOnce.Do(func() {
+		p, err := parse(sources)
+		if err != nil {
+			panic(err)
+		}
+
+		program = p
+		for _, stmt := range p.Statements {
+			if let, ok := stmt.(*ast.LetStatement); ok {
+				names = append(names, let.Name.Value)
+			}
+		}
+	})
+
+	return program
+}
+
+// Names returns the globals defined by the prelude in definition order
+func Names() []string {
+	Program()
+	return names
+}
+
+// Compile compiles the prelude sources against the builtins
+func Compile() (*compiler.Bytecode, error) {
+	comp := compiler.New(compiler.WithFile(File))
+	if err := comp.Compile(Program()); err != nil {
+		return nil, fmt.Errorf("prelude: %w", err)
+	}
+
+	return comp.Bytecode(), nil
+}
+
+// Bytecode returns the precompiled prelude. The sources are compiled instead when
+// the embedded bytecode is not compatible with this build. It is loaded once
+func Bytecode() *compiler.Bytecode {
+	compileOnce.Do(func() {
+		var err error
+		bytecode, err = compiler.Decode(bytes.NewReader(precompiled))
+		if err != nil {
+			if bytecode, err = Compile(); err != nil {
+				panic(err)
+			}
+		}
+
+		machine := vm.New(bytecode)
+		if err := machine.Run(); err != nil {
+			panic(fmt.Sprintf("prelude: %s", err))
+		}
+
+		values = make([]value.Value, len(Names()))
+		for i, name := range Names() {
+			values[i], _ = machine.Global(name)
+		}
+	})
+
+	return bytecode
+}
+
+// Constants returns the prelude constant pool. The prelude functions refer
+// to their constants by index, so programs that use them must be compiled with a pool
+// starting with these constants
+func Constants() []value.Value {
+	constants := Bytecode().Constants
+	return constants[:len(constants):len(constants)]
+}
+
+// SymbolTable returns a new symbol table with the builtins and the prelude globals.
+// Programs compiled with it and with Constants must run with the values returned by Globals
+func SymbolTable() *compiler.SymbolTable {
+	symbols := compiler.NewSymbolTable()
+	for i, b := range value.Builtins() {
+		symbols.DefineBuiltin(i, b.Name)
+	}
+
+	for _, name := range Names() {
+		symbols.Define(name)
+	}
+
+	return symbols
+}
+
+// Globals returns a new global store holding the prelude values at the indexes
+// defined by SymbolTable
+func Globals() []value.Value {
+	Bytecode()
+	globals := make([]value.Value, vm.GlobalsSize)
+	copy(globals, values)
+	return globals
+}
+
+// Standalone returns a copy of b that defines the prelude globals before running, so
+// it does not need the Globals store. b must be compiled with SymbolTable and Constants
+func Standalone(b *compiler.Bytecode) *compiler.Bytecode {
+	prefix := Bytecode().Instructions
+	offset := len(prefix)
+
+	instructions := make(code.Instructions, 0, offset+len(b.Instructions))
+	instructions = append(instructions, prefix...)
+	instructions = append(instructions, b.Instructions...)
+
+	// jump targets are absolute
+	main := instructions[offset:]
+	for i := 0; i < len(main); {
+		def, err := code.Lookup(main[i])
+		if err != nil {
+			break
+		}
+
+		op := code.Opcode(main[i])
+		if op == code.OpJump || op == code.OpJumpIfBranch {
+			operands, _ := code.ReadOperands(def, main[i+1:])
+			copy(main[i:], code.Make(op, operands[0]+offset))
+		}
+		i += 1 + def.Width()
+	}
+
+	lines := make(code.LineTable, len(b.Lines))
+	for i, entry := range b.Lines {
+		lines[i] = code.LineEntry{Offset: entry.Offset + offset, Line: entry.Line}
+	}
+
+	return &compiler.Bytecode{
+		Instructions: instructions,
+		Constants:    b.Constants,
+		Globals:      b.Globals,
+		Lines:        lines,
+	}
+}
+
+// NewEnvironment returns a new evaluator environment with the prelude loaded
+func NewEnvironment() *value.Environment {
+	env := value.NewEnvironment(nil)
+	result := evaluator.New().Eval(Program(), env)
+	if err, ok := result.(*value.Error); ok {
+		panic(fmt.Sprintf("prelude: %s", err.Message))
+	}
+
+	return env
+}
+
+func parse(fsys fs.FS) (*ast.Program, error) {
+	files, err := fs.Glob(fsys, "*.sm")
+	if err != nil {
+		return nil, err
+	}
+
+	program := &ast.Program{}
+	defined := map[string]string{}
+	for _, file := range files {
+		src, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		p := parser.New(lexer.New(string(src)))
+		parsed := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return nil, fmt.Errorf("prelude %s has parse errors:\n\t%s", file, strings.Join(p.Errors(), "\n\t"))
+		}
+
+		for _, stmt := range parsed.Statements {
+			let, ok := stmt.(*ast.LetStatement)
+			if !ok {
+				return nil, fmt.Errorf("prelude %s: only let statements are allowed, got %s", file, stmt.String())
+			}
+
+			if other, ok := defined[let.Name.Value]; ok {
+				return nil, fmt.Errorf("prelude %s: %s is already defined in %s", file, let.Name.Value, other)
+			}
+			defined[let.Name.Value] = file
+		}
+
+		program.Statements = append(program.Statements, parsed.Statements...)
+	}
+
+	return program, nil
+}
@@ -0,0 +1,170 @@
+package prelude
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/evaluator"
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/vm"
+)
+
+var preludeTests = []struct {
+	input    string
+	expected string
+}{
+	{`identity(5)`, "5"},
+	{`compose(fn(x) { x * 2 }, fn(x) { x + 1 })(3)`, "8"},
+	{`partial(fn(a, b) { a - b }, 10)(4)`, "6"},
+	{`sum([1, 2, 3])`, "6"},
+	{`sum([])`, "0"},
+	{`product([2, 3, 4])`, "24"},
+	{`count([1, 2, 3, 4], fn(x) { x > 2 })`, "2"},
+	{`any([1, 2, 3], fn(x) { x > 2 })`, "true"},
+	{`any([], fn(x) { true })`, "false"},
+	{`all([1, 2, 3], fn(x) { x > 0 })`, "true"},
+	{`all([1, 2, 3], fn(x) { x > 1 })`, "false"},
+	{`find([1, 2, 3], fn(x) { x > 1 })`, "2"},
+	{`find([1, 2, 3], fn(x) { x > 5 })`, "nil"},
+	{`first([7, 8])`, "7"},
+	{`last([7, 8])`, "8"},
+	{`last([])`, "nil"},
+	{`flat_map([1, 2], fn(x) { [x, x * 10] })`, "[1, 10, 2, 20]"},
+	{`pick({"a": 1, "b": 2, "c": 3}, ["a", "c", "d"])`, "{a: 1, c: 3}"},
+	{`omit({"a": 1, "b": 2}, ["a"])`, "{b: 2}"},
+	{`map_values({"a": 1, "b": 2}, fn(x) { x * 3 })`, "{a: 3, b: 6}"},
+	{`group_by([1, 2, 3, 4], fn(x) { if (x > 2) { "big" } else { "small" } })`, "{big: [3, 4], small: [1, 2]}"},
+	{`let sum = 1; sum`, "1"},
+}
+
+func TestPreludeEvaluator(t *testing.T) {
+	for _, tt := range preludeTests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parse errors for %q: %v", tt.input, p.Errors())
+		}
+
+		result := evaluator.New().Eval(program, NewEnvironment())
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestPreludeVM(t *testing.T) {
+	for _, tt := range preludeTests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parse errors for %q: %v", tt.input, p.Errors())
+		}
+
+		comp := compiler.NewWithState(SymbolTable(), Constants())
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("%s: compilation error: %s", tt.input, err)
+		}
+
+		machine := vm.NewWithGlobalStore(comp.Bytecode(), Globals())
+		if err := machine.Run(); err != nil {
+			t.Fatalf("%s: vm error: %s", tt.input, err)
+		}
+
+		result := machine.LastPoppedStackElement()
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestPreludeBytecode(t *testing.T) {
+	code := Bytecode()
+	if code != Bytecode() {
+		t.Fatal("prelude was compiled twice")
+	}
+
+	for i, name := range Names() {
+		if code.Globals[name] != i {
+			t.Errorf("%s: expected global index %d, got %d", name, i, code.Globals[name])
+		}
+	}
+
+	globals := Globals()
+	for i := range Names() {
+		if globals[i] == nil {
+			t.Errorf("global %s has no value", Names()[i])
+		}
+	}
+}
+
+func TestPrecompiledIsUpToDate(t *testing.T) {
+	code, err := Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, code); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), precompiled) {
+		t.Fatal("prelude.smc is out of date, run `go generate ./prelude`")
+	}
+}
+
+func TestStandalone(t *testing.T) {
+	input := "let big = fn(x) { x > 2 };\nif (any([1, 3], big)) { sum([1, 2]) } else { 0 }"
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	comp := compiler.NewWithState(SymbolTable(), Constants())
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compilation error: %s", err)
+	}
+
+	code := Standalone(comp.Bytecode())
+	machine := vm.New(code)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if result := machine.LastPoppedStackElement().Inspect(); result != "3" {
+		t.Errorf("expected 3, got %s", result)
+	}
+
+	offset := len(Bytecode().Instructions)
+	if line := code.Lines.Line(offset); line != 1 {
+		t.Errorf("expected line 1 at offset %d, got %d", offset, line)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		files    fstest.MapFS
+		expected string
+	}{
+		{
+			fstest.MapFS{"a.sm": {Data: []byte("let x = ;")}},
+			"prelude a.sm has parse errors:\n\tno prefix parse function for ; found",
+		},
+		{
+			fstest.MapFS{"a.sm": {Data: []byte("log(1);")}},
+			"prelude a.sm: only let statements are allowed, got log(1)",
+		},
+		{
+			fstest.MapFS{"a.sm": {Data: []byte("let x = 1;")}, "b.sm": {Data: []byte("let x = 2;")}},
+			"prelude b.sm: x is already defined in a.sm",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := parse(tt.files)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("expected error %q, got %v", tt.expected, err)
+		}
+	}
+}
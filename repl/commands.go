@@ -0,0 +1,175 @@
+package repl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/disasm"
+)
+
+// command is a meta-command, typed with a leading colon
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(s *session, arg string)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"help", ":help", "list the commands", (*session).help},
+		{"ast", ":ast [input]", "print the syntax tree of the input or of the previous input", (*session).ast},
+		{"disasm", ":disasm", "print the bytecode of the previous input", (*session).disasm},
+		{"env", ":env", "list the globals defined in the session and their values", (*session).env},
+		{"engine", ":engine [vm|eval]", "print or switch the engine that runs the inputs", (*session).engineCommand},
+		{"compare", ":compare", "toggle running each input with both engines and reporting differences", (*session).compareCommand},
+		{"reset", ":reset", "forget the globals and the previous input", (*session).resetCommand},
+		{"load", ":load file", "run a script in the session, its globals stay defined", (*session).load},
+		{"time", ":time", "toggle printing the time taken to run each input", (*session).time},
+	}
+}
+
+// command runs a meta-command line, e.g. `:load script.sm`
+func (s *session) command(line string) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	for _, c := range commands {
+		if c.name == name {
+			c.run(s, strings.TrimSpace(arg))
+			return
+		}
+	}
+
+	fmt.Fprintf(s.out, "unknown command :%s, type :help to list the commands\n", name)
+}
+
+func (s *session) help(string) {
+	for _, c := range commands {
+		fmt.Fprintf(s.out, "  %-18s %s\n", c.usage, c.summary)
+	}
+}
+
+func (s *session) ast(arg string) {
+	program := s.lastProgram
+	if arg != "" {
+		program = s.parse(arg)
+		if program == nil {
+			return
+		}
+	}
+
+	if program == nil {
+		fmt.Fprintln(s.out, "nothing to print")
+		return
+	}
+
+	fmt.Fprint(s.out, ast.Tree(program))
+}
+
+func (s *session) disasm(string) {
+	if s.engine == s.eval && !s.compare {
+		fmt.Fprintln(s.out, "the eval engine does not compile its inputs, there is no bytecode")
+		return
+	}
+
+	if s.vm.last == nil {
+		fmt.Fprintln(s.out, "nothing to disassemble")
+		return
+	}
+
+	disasm.Disassemble(s.out, s.vm.last, disasm.Options{Source: s.vm.lastSource, FirstConstant: s.vm.lastFirstConstant})
+}
+
+// env lists the globals of the selected engine
+func (s *session) env(string) {
+	globals := s.engine.globals()
+	for _, g := range globals {
+		fmt.Fprintf(s.out, "%s = %s\n", g.name, g.value.Inspect())
+	}
+
+	if len(globals) == 0 {
+		fmt.Fprintln(s.out, "no globals defined")
+	}
+}
+
+func (s *session) engineCommand(name string) {
+	switch name {
+	case "":
+	case EngineVM:
+		s.engine = s.vm
+	case EngineEval:
+		s.engine = s.eval
+	default:
+		fmt.Fprintf(s.out, "unknown engine %q, use %s or %s\n", name, EngineVM, EngineEval)
+		return
+	}
+
+	s.replayed("engine "+s.engine.name(), s.catchUp(s.engine))
+}
+
+// replayed prints msg with the number of inputs run by catchUp, and warns that they
+// ran again when there are any
+func (s *session) replayed(msg string, n int) {
+	switch n {
+	case 0:
+		fmt.Fprintln(s.out, msg)
+		return
+	case 1:
+		fmt.Fprintf(s.out, "%s, ran the previous input again\n", msg)
+	default:
+		fmt.Fprintf(s.out, "%s, ran the %d previous inputs again\n", msg, n)
+	}
+	fmt.Fprintln(s.out, "warning: their side effects, e.g. writing files, were repeated and their output was not shown")
+}
+
+func (s *session) compareCommand(string) {
+	s.compare = !s.compare
+	if s.compare {
+		// both engines must have run the inputs to define the same globals
+		s.replayed("compare on", s.catchUp(s.vm)+s.catchUp(s.eval))
+	} else {
+		fmt.Fprintln(s.out, "compare off")
+	}
+}
+
+func (s *session) resetCommand(string) {
+	s.reset()
+	fmt.Fprintln(s.out, "session reset")
+}
+
+// load runs a script, a shebang line is blanked so line numbers are kept
+func (s *session) load(path string) {
+	if path == "" {
+		fmt.Fprintln(s.out, "usage: :load file")
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.out, "load error: %s\n", err)
+		return
+	}
+
+	src := string(data)
+	if strings.HasPrefix(src, "#!") {
+		if end := strings.IndexByte(src, '\n'); end >= 0 {
+			src = src[end:]
+		} else {
+			src = ""
+		}
+	}
+
+	s.run(src)
+}
+
+func (s *session) time(string) {
+	s.timing = !s.timing
+	if s.timing {
+		fmt.Fprintln(s.out, "timing on")
+	} else {
+		fmt.Fprintln(s.out, "timing off")
+	}
+}
@@ -0,0 +1,132 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/value"
+)
+
+// outcome is what an engine did with an input
+type outcome struct {
+	output string
+	// value is empty for statements without a value
+	value string
+	err   string
+}
+
+func newOutcome(output string, result value.Value, err error) outcome {
+	o := outcome{output: output}
+	switch result := result.(type) {
+	case nil:
+		// the messages are compared without the stage, e.g. compilation
+		var stage *stageError
+		if errors.As(err, &stage) {
+			err = stage.err
+		}
+		if err != nil {
+			o.err = err.Error()
+		}
+	case *value.Error:
+		o.err = result.Message
+	default:
+		o.value = inspect(result)
+	}
+
+	return o
+}
+
+// inspect prints a value like Inspect, with functions printed as `function` since
+// each engine prints its own function values
+func inspect(v value.Value) string {
+	switch v := v.(type) {
+	case *value.Function, *value.Closure, *value.CompiledFunction:
+		return "function"
+	case *value.Array:
+		elements := make([]string, len(v.Elements))
+		for i, e := range v.Elements {
+			elements[i] = inspect(e)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *value.Hash:
+		keys := make([]string, 0, len(v.Pairs))
+		for k := range v.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = fmt.Sprintf("%s: %s", k, inspect(v.Pairs[k]))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return v.Inspect()
+	}
+}
+
+// differs reports whether the outcomes have different outputs, values or errors.
+// A statement without a value matches any value, e.g. the evaluator does not give
+// let statements a value
+func (o outcome) differs(other outcome) bool {
+	if o.output != other.output || o.err != other.err {
+		return true
+	}
+
+	return o.value != "" && other.value != "" && o.value != other.value
+}
+
+func (o outcome) describe(withOutput bool) string {
+	var out strings.Builder
+	switch {
+	case o.err != "":
+		fmt.Fprintf(&out, "error %q", o.err)
+	case o.value != "":
+		out.WriteString(o.value)
+	default:
+		out.WriteString("no value")
+	}
+
+	if withOutput {
+		fmt.Fprintf(&out, ", output %q", o.output)
+	}
+	return out.String()
+}
+
+// runCompare runs src with both engines and prints the output and the value of the
+// selected engine, followed by both outcomes when they differ
+func (s *session) runCompare(src string, program *ast.Program) {
+	engines := []engine{s.vm, s.eval}
+	outcomes := make([]outcome, len(engines))
+	times := make([]string, len(engines))
+
+	for i, e := range engines {
+		var output strings.Builder
+		start := time.Now()
+		result, err := e.run(src, program, &output)
+		times[i] = fmt.Sprintf("%s %s", e.name(), time.Since(start).Round(time.Microsecond))
+		outcomes[i] = newOutcome(output.String(), result, err)
+
+		if e == s.engine {
+			io.WriteString(s.out, output.String())
+			s.print(result, err)
+		}
+	}
+
+	if outcomes[0].differs(outcomes[1]) {
+		withOutput := outcomes[0].output != outcomes[1].output
+		fmt.Fprintln(s.out, "engines differ:")
+		for i, e := range engines {
+			fmt.Fprintf(s.out, "  %-5s %s\n", e.name()+":", outcomes[i].describe(withOutput))
+		}
+	}
+
+	if s.timing {
+		fmt.Fprintf(s.out, "time: %s\n", strings.Join(times, ", "))
+	}
+}
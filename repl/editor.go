@@ -0,0 +1,274 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// errInterrupted is returned when the line is abandoned with Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads the lines of the inputs, prompt is printed before each line
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// plainReader reads lines from inputs that are not terminals, e.g. files and pipes
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (r *plainReader) readLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	line, err := r.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+
+	return trimNewline(line), err
+}
+
+func trimNewline(line string) string {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+		if n > 1 && line[n-2] == '\r' {
+			line = line[:n-2]
+		}
+	}
+	return line
+}
+
+// Keys read by the editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// editor reads lines from a terminal in raw mode. It supports moving the cursor,
+// deleting characters and words, and recalling the history with the arrow keys
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *history
+	// raw puts the terminal in raw mode while a line is read, it returns a function
+	// that restores the previous mode
+	raw func() (func(), error)
+
+	prompt string
+	line   []rune
+	cursor int
+	// recalled is the index of the history entry being edited, len(entries) for a new line
+	recalled int
+	// pending is the new line, kept while browsing the history
+	pending []rune
+}
+
+func (e *editor) readLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.prompt, e.line, e.cursor = prompt, nil, 0
+	e.recalled, e.pending = len(e.history.entries), nil
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(e.line) > 0 {
+				io.WriteString(e.out, "\r\n")
+				return string(e.line), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyLineFeed:
+			io.WriteString(e.out, "\r\n")
+			return string(e.line), nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+		case keyCtrlA:
+			e.cursor = 0
+		case keyCtrlE:
+			e.cursor = len(e.line)
+		case keyCtrlB:
+			e.left()
+		case keyCtrlF:
+			e.right()
+		case keyCtrlP:
+			e.recall(-1)
+		case keyCtrlN:
+			e.recall(1)
+		case keyBackspace, keyDelete:
+			if e.cursor > 0 {
+				e.line = append(e.line[:e.cursor-1], e.line[e.cursor:]...)
+				e.cursor--
+			}
+		case keyCtrlK:
+			e.line = e.line[:e.cursor]
+		case keyCtrlU:
+			e.line, e.cursor = e.line[e.cursor:], 0
+		case keyCtrlW:
+			e.deleteWord()
+		case keyCtrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case keyTab:
+			e.insert(' ', ' ')
+		case keyEscape:
+			e.escape()
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(r)
+			}
+		}
+
+		e.refresh()
+	}
+}
+
+// escape handles the sequences of the arrow, home, end and delete keys
+func (e *editor) escape() {
+	next, _, err := e.in.ReadRune()
+	if err != nil || next != '[' && next != 'O' {
+		return
+	}
+
+	key, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+
+	switch key {
+	case 'A':
+		e.recall(-1)
+	case 'B':
+		e.recall(1)
+	case 'C':
+		e.right()
+	case 'D':
+		e.left()
+	case 'H':
+		e.cursor = 0
+	case 'F':
+		e.cursor = len(e.line)
+	case '1', '3', '4', '7', '8':
+		// e.g. ESC [ 3 ~ is the delete key
+		if tilde, _, err := e.in.ReadRune(); err != nil || tilde != '~' {
+			return
+		}
+		switch key {
+		case '1', '7':
+			e.cursor = 0
+		case '4', '8':
+			e.cursor = len(e.line)
+		case '3':
+			e.deleteForward()
+		}
+	}
+}
+
+func (e *editor) insert(runes ...rune) {
+	line := make([]rune, 0, len(e.line)+len(runes))
+	line = append(line, e.line[:e.cursor]...)
+	line = append(line, runes...)
+	e.line = append(line, e.line[e.cursor:]...)
+	e.cursor += len(runes)
+}
+
+func (e *editor) left() {
+	if e.cursor > 0 {
+		e.cursor--
+	}
+}
+
+func (e *editor) right() {
+	if e.cursor < len(e.line) {
+		e.cursor++
+	}
+}
+
+func (e *editor) deleteForward() {
+	if e.cursor < len(e.line) {
+		e.line = append(e.line[:e.cursor], e.line[e.cursor+1:]...)
+	}
+}
+
+// deleteWord deletes the word before the cursor and the spaces after it
+func (e *editor) deleteWord() {
+	start := e.cursor
+	for start > 0 && e.line[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && e.line[start-1] != ' ' {
+		start--
+	}
+
+	e.line = append(e.line[:start], e.line[e.cursor:]...)
+	e.cursor = start
+}
+
+// recall replaces the line with an older (-1) or newer (1) history entry
+func (e *editor) recall(direction int) {
+	entries := e.history.entries
+	next := e.recalled + direction
+	if next < 0 || next > len(entries) {
+		return
+	}
+
+	if e.recalled == len(entries) {
+		e.pending = e.line
+	}
+
+	e.recalled = next
+	if next == len(entries) {
+		e.line = e.pending
+	} else {
+		e.line = []rune(entries[next])
+	}
+	e.cursor = len(e.line)
+}
+
+// refresh redraws the line and moves the terminal cursor to the editor cursor
+func (e *editor) refresh() {
+	column := utf8.RuneCountInString(e.prompt) + e.cursor
+	// newlines of recalled strings would break the line
+	line := strings.ReplaceAll(string(e.line), "\n", "↵")
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K\r", e.prompt, line)
+	if column > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dC", column)
+	}
+}
@@ -0,0 +1,159 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/evaluator"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/prelude"
+	"protiumx.dev/simia/value"
+	"protiumx.dev/simia/vm"
+)
+
+// Engines that run the inputs
+const (
+	EngineVM   = "vm"
+	EngineEval = "eval"
+)
+
+// engine runs the inputs of a session. Each engine keeps the globals defined by the
+// inputs it ran
+type engine interface {
+	name() string
+	// run returns the value of the last statement of the input, nil when the engine
+	// does not give statements a value
+	run(src string, program *ast.Program, out io.Writer) (value.Value, error)
+	// globals returns the globals defined by the inputs
+	globals() []global
+	reset()
+}
+
+type global struct {
+	name  string
+	value value.Value
+}
+
+// stageError is an error of a stage of running an input, e.g. compilation
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return fmt.Sprintf("%s error:\n %s", e.stage, e.err)
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// vmEngine compiles the inputs and runs them with the vm
+type vmEngine struct {
+	constants []value.Value
+	store     []value.Value
+	symbols   *compiler.SymbolTable
+
+	// last compiled input, printed by :disasm
+	lastSource        string
+	last              *compiler.Bytecode
+	lastFirstConstant int
+}
+
+func (e *vmEngine) name() string {
+	return EngineVM
+}
+
+func (e *vmEngine) reset() {
+	e.constants = prelude.Constants()
+	e.store = prelude.Globals()
+	e.symbols = prelude.SymbolTable()
+	e.lastSource, e.last, e.lastFirstConstant = "", nil, 0
+}
+
+func (e *vmEngine) run(src string, program *ast.Program, out io.Writer) (value.Value, error) {
+	// modules are imported relative to the working directory
+	comp := compiler.NewWithState(e.symbols, e.constants, compiler.WithResolver(module.NewDirResolver(".")))
+	if err := comp.Compile(program); err != nil {
+		return nil, &stageError{"compilation", err}
+	}
+
+	code := comp.Bytecode()
+	e.lastSource, e.last, e.lastFirstConstant = src, code, len(e.constants)
+	e.constants = code.Constants
+	v := vm.NewWithGlobalStore(code, e.store,
+		vm.WithPermissions(permissions),
+		vm.WithStdout(out),
+		vm.WithStderr(out),
+	)
+
+	if err := v.Run(); err != nil {
+		return nil, &stageError{"bytecode execution", err}
+	}
+
+	return v.LastPoppedStackElement(), nil
+}
+
+// globals returns the globals defined after the prelude in definition order, a global
+// whose definition failed to run has no value and is skipped
+func (e *vmEngine) globals() []global {
+	first := len(prelude.Names())
+	globals := []global{}
+	for _, sym := range e.symbols.Globals() {
+		if sym.Index >= first && e.store[sym.Index] != nil {
+			globals = append(globals, global{sym.Name, e.store[sym.Index]})
+		}
+	}
+
+	return globals
+}
+
+// evalEngine runs the inputs with the tree-walking evaluator
+type evalEngine struct {
+	env *value.Environment
+}
+
+func (e *evalEngine) name() string {
+	return EngineEval
+}
+
+func (e *evalEngine) reset() {
+	e.env = prelude.NewEnvironment()
+}
+
+func (e *evalEngine) run(src string, program *ast.Program, out io.Writer) (value.Value, error) {
+	ev := evaluator.New(
+		evaluator.WithPermissions(permissions),
+		evaluator.WithStdout(out),
+		evaluator.WithStderr(out),
+		evaluator.WithResolver(module.NewDirResolver(".")),
+	)
+
+	result, err := ev.EvalContext(context.Background(), program, e.env)
+	if err != nil {
+		return nil, &stageError{"evaluation", err}
+	}
+
+	return result, nil
+}
+
+// globals returns the globals that are not defined by the prelude, sorted by name
+func (e *evalEngine) globals() []global {
+	defined := map[string]bool{}
+	for _, name := range prelude.Names() {
+		defined[name] = true
+	}
+
+	globals := []global{}
+	for _, name := range e.env.Names() {
+		if !defined[name] {
+			val, _ := e.env.Get(name)
+			globals = append(globals, global{name, val})
+		}
+	}
+
+	return globals
+}
@@ -0,0 +1,143 @@
+package repl
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/token"
+)
+
+// MaxHistory is the number of inputs kept in the history
+const MaxHistory = 1000
+
+// history holds the previous inputs, one per line. Inputs that span several lines are
+// joined with spaces, without their comments, so they can be recalled and edited as a
+// single line. Newlines in strings are kept and escaped in the file
+type history struct {
+	entries []string
+	// path is the file the entries are appended to, empty to keep them in memory
+	path string
+}
+
+// loadHistory reads the entries of the file at path, a missing file is an empty history
+func loadHistory(path string) (*history, error) {
+	h := &history{path: path}
+	if path == "" {
+		return h, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.entries = append(h.entries, unescape(line))
+		}
+	}
+
+	// the file is truncated when it has more entries than the history keeps
+	if len(h.entries) > MaxHistory {
+		h.entries = h.entries[len(h.entries)-MaxHistory:]
+		var data strings.Builder
+		for _, entry := range h.entries {
+			data.WriteString(escaper.Replace(entry) + "\n")
+		}
+		return h, os.WriteFile(path, []byte(data.String()), 0o600)
+	}
+
+	return h, nil
+}
+
+// add appends an input to the history unless it repeats the last one
+func (h *history) add(input string) error {
+	entry := oneLine(input)
+	if entry == "" || len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return nil
+	}
+
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > MaxHistory {
+		h.entries = h.entries[1:]
+	}
+
+	if h.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(escaper.Replace(entry) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// oneLine joins the lines of input with spaces and drops its comments. The tokens are
+// copied from the source, so the newlines in strings are kept
+func oneLine(input string) string {
+	// offsets of the start of each line
+	starts := []int{0}
+	for i := 0; i < len(input); i++ {
+		if input[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+
+	var out strings.Builder
+	end := 0
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		start := starts[tok.Pos.Line-1] + tok.Pos.Column - 1
+
+		// tokens are separated by spaces and comments, a comment always ends a line
+		if gap := input[end:start]; out.Len() > 0 {
+			if strings.Contains(gap, "\n") {
+				gap = " "
+			}
+			out.WriteString(gap)
+		}
+
+		end = start + len(tok.Literal)
+		if tok.Type == token.STRING {
+			// the quotes, an unterminated string runs until the end of the input
+			end++
+			if end < len(input) && input[end] == '"' {
+				end++
+			}
+		}
+		out.WriteString(input[start:end])
+	}
+
+	return out.String()
+}
+
+// escaper keeps each entry on one line of the file
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// unescape reverses escaper
+func unescape(line string) string {
+	var out strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) {
+			i++
+			if line[i] == 'n' {
+				out.WriteByte('\n')
+				continue
+			}
+		}
+		out.WriteByte(line[i])
+	}
+
+	return out.String()
+}
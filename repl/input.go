@@ -0,0 +1,22 @@
+package repl
+
+import (
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/token"
+)
+
+// depth returns the number of braces, brackets and parentheses of src that are not
+// closed. Brackets in strings and comments are skipped by the lexer
+func depth(src string) int {
+	l := lexer.New(src)
+	n := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE, token.LBRACKET, token.LPAREN:
+			n++
+		case token.RBRACE, token.RBRACKET, token.RPAREN:
+			n--
+		}
+	}
+	return n
+}
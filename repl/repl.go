@@ -2,65 +2,234 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strings"
+	"time"
 
-	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/ast"
 	"protiumx.dev/simia/lexer"
 	"protiumx.dev/simia/parser"
 	"protiumx.dev/simia/value"
-	"protiumx.dev/simia/vm"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+// CONTINUATION_PROMPT is printed while braces, brackets or parentheses are open
+const CONTINUATION_PROMPT = ".. "
 
-	constants := []value.Value{}
-	globals := make([]value.Value, vm.GlobalsSize)
-	symbols := compiler.NewSymbolTable()
+// stdin is not granted since the REPL reads its input from it
+const permissions = value.PermReadFile | value.PermWriteFile | value.PermListDir | value.PermEnv
 
-	for i, v := range value.Builtins {
-		symbols.DefineBuiltin(i, v.Name)
+type config struct {
+	historyPath string
+	engine      string
+}
+
+type Option func(*config)
+
+// WithHistory keeps the inputs typed in a terminal in the file at path, so they can be
+// recalled in later sessions
+func WithHistory(path string) Option {
+	return func(c *config) {
+		c.historyPath = path
+	}
+}
+
+// WithEngine sets the engine that runs the inputs, EngineVM or EngineEval. It can be
+// changed with the :engine command
+func WithEngine(name string) Option {
+	return func(c *config) {
+		c.engine = name
 	}
+}
+
+// Start reads inputs until in is closed. An input continues on the next line while it
+// has unbalanced braces, brackets or parentheses. When in and out are terminals
+// the lines can be edited and previous inputs recalled with the arrow keys
+func Start(in io.Reader, out io.Writer, opts ...Option) {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	reader, h := newLineReader(in, out, cfg.historyPath)
+	s := newSession(out, cfg.engine)
 
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := readInput(reader)
+		if errors.Is(err, errInterrupted) {
+			continue
+		}
+		if err != nil {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
-
-		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
+		if strings.TrimSpace(input) == "" {
 			continue
 		}
 
-		comp := compiler.NewWithState(symbols, constants)
-		err := comp.Compile(program)
-		if err != nil {
-			fmt.Fprintf(out, "compilation error:\n %s\n", err)
+		if err := h.add(input); err != nil {
+			fmt.Fprintf(out, "history error: %s\n", err)
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(input), ":") {
+			s.command(strings.TrimSpace(input))
 			continue
 		}
 
-		code := comp.Bytecode()
-		constants = code.Constants
-		v := vm.NewWithGlobalStore(code, globals)
-		err = v.Run()
+		s.run(input)
+	}
+}
+
+// newLineReader returns an editor when in and out are terminals. The history of
+// other inputs is not saved
+func newLineReader(in io.Reader, out io.Writer, historyPath string) (lineReader, *history) {
+	inFile, inOK := in.(*os.File)
+	outFile, outOK := out.(*os.File)
+	if !inOK || !outOK || !isTerminal(inFile) || !isTerminal(outFile) {
+		return &plainReader{in: bufio.NewReader(in), out: out}, &history{}
+	}
+
+	h, err := loadHistory(historyPath)
+	if err != nil {
+		fmt.Fprintf(out, "history error: %s\n", err)
+	}
+
+	return &editor{
+		in:      bufio.NewReader(inFile),
+		out:     out,
+		history: h,
+		raw:     func() (func(), error) { return makeRaw(inFile) },
+	}, h
+}
+
+// readInput reads lines until the braces, brackets and parentheses are balanced.
+// Meta-commands are a single line
+func readInput(r lineReader) (string, error) {
+	input, err := r.readLine(PROMPT)
+	if err != nil || strings.HasPrefix(strings.TrimSpace(input), ":") {
+		return input, err
+	}
+
+	for depth(input) > 0 {
+		line, err := r.readLine(CONTINUATION_PROMPT)
+		if errors.Is(err, io.EOF) {
+			// the incomplete input is evaluated to report its errors
+			return input, nil
+		}
 		if err != nil {
-			fmt.Fprintf(out, "bytecode execution error:\n %s\n", err)
-			continue
+			return "", err
 		}
+		input += "\n" + line
+	}
+
+	return input, nil
+}
+
+// session holds the state shared by the inputs, so they can refer to the globals
+// defined by previous inputs
+type session struct {
+	out  io.Writer
+	vm   *vmEngine
+	eval *evalEngine
+	// engine runs the inputs, both engines run them in compare mode
+	engine  engine
+	compare bool
+	// timing prints the time taken to run each input
+	timing bool
+
+	// inputs run since the last reset, an engine that did not run them runs them when
+	// it is selected so both engines define the same globals
+	inputs []string
+	// ran counts the inputs run by each engine, by name
+	ran map[string]int
+
+	// last parsed input, printed by :ast
+	lastProgram *ast.Program
+}
+
+func newSession(out io.Writer, engineName string) *session {
+	s := &session{out: out, vm: &vmEngine{}, eval: &evalEngine{}}
+	s.engine = s.vm
+	if engineName == EngineEval {
+		s.engine = s.eval
+	}
+
+	s.reset()
+	return s
+}
+
+// reset forgets the globals of both engines and the previous input
+func (s *session) reset() {
+	s.vm.reset()
+	s.eval.reset()
+	s.inputs, s.ran = nil, map[string]int{}
+	s.lastProgram = nil
+}
+
+// catchUp runs the inputs the engine did not run, without printing their output, and
+// returns how many it ran. Their errors are ignored like when they were first run
+func (s *session) catchUp(e engine) int {
+	pending := s.inputs[s.ran[e.name()]:]
+	for _, src := range pending {
+		program := parser.New(lexer.New(src)).ParseProgram()
+		e.run(src, program, io.Discard)
+	}
+
+	s.ran[e.name()] = len(s.inputs)
+	return len(pending)
+}
+
+// parse parses src and prints its errors, it returns nil when src does not parse
+func (s *session) parse(src string) *ast.Program {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParseErrors(s.out, p.Errors())
+		return nil
+	}
+
+	return program
+}
+
+// run runs src and prints its value
+func (s *session) run(src string) {
+	program := s.parse(src)
+	if program == nil {
+		return
+	}
+
+	s.lastProgram = program
+	s.inputs = append(s.inputs, src)
+	if s.compare {
+		s.ran[EngineVM], s.ran[EngineEval] = len(s.inputs), len(s.inputs)
+		s.runCompare(src, program)
+		return
+	}
+
+	s.ran[s.engine.name()] = len(s.inputs)
+
+	start := time.Now()
+	result, err := s.engine.run(src, program, s.out)
+	elapsed := time.Since(start)
+
+	s.print(result, err)
+	if s.timing {
+		fmt.Fprintf(s.out, "time: %s\n", elapsed.Round(time.Microsecond))
+	}
+}
 
-		top := v.LastPoppedStackElement()
-		io.WriteString(out, top.Inspect())
-		io.WriteString(out, "\n")
+// print prints the value of an input, statements without a value print nothing
+func (s *session) print(result value.Value, err error) {
+	switch {
+	case err != nil:
+		fmt.Fprintf(s.out, "%s\n", err)
+	case result != nil:
+		io.WriteString(s.out, result.Inspect())
+		io.WriteString(s.out, "\n")
 	}
 }
 
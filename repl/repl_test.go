@@ -0,0 +1,323 @@
+package repl
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"1 + 1", 0},
+		{"let f = fn(x) {", 1},
+		{"let a = [1, {", 2},
+		{"if (x) { [1] } else {", 1},
+		{`"{[(" + "`, 0},
+		{"// {", 0},
+		{"}", -1},
+	}
+
+	for _, tt := range tests {
+		if got := depth(tt.input); got != tt.expected {
+			t.Errorf("depth(%q): expected %d, got %d", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.sm")
+	if err := os.WriteFile(script, []byte("#!/usr/bin/env simia\nlet square = fn(x) {\n  x * x\n};\nsquare(4)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		"let add = fn(a, b) {",
+		"  a + b",
+		"};",
+		"let total = [",
+		"  add(1, 2),",
+		"  3",
+		"];",
+		":env",
+		":ast",
+		":ast 1 + x",
+		":load " + script,
+		"square(total[0])",
+		":load",
+		":load missing.sm",
+		":reset",
+		":env",
+		"total",
+		":disasm",
+		":unknown",
+		"",
+	}, "\n")
+
+	var out strings.Builder
+	Start(strings.NewReader(input), &out)
+
+	expected := []string{
+		">> .. .. Closure",
+		">> .. .. .. [3, 3]",
+		">> add = Closure",
+		"total = [3, 3]",
+		">> Program",
+		"  LetStatement total 1:1",
+		"    ArrayLiteral 1:13",
+		"      CallExpression 2:6",
+		"        Identifier add 2:3",
+		"        IntegerLiteral 1 2:7",
+		"        IntegerLiteral 2 2:10",
+		"      IntegerLiteral 3 3:3",
+		">> Program",
+		"  ExpressionStatement 1:1",
+		"    InfixExpression + 1:3",
+		"      IntegerLiteral 1 1:1",
+		"      Identifier x 1:5",
+		">> 16",
+		">> 9",
+		">> usage: :load file",
+		">> load error: open missing.sm: no such file or directory",
+		">> session reset",
+		">> no globals defined",
+		">> compilation error:",
+		" undefined variable total",
+		">> nothing to disassemble",
+		">> unknown command :unknown, type :help to list the commands",
+		">> ",
+	}
+
+	// closures print their address
+	got := regexp.MustCompile(`Closure\[0x[0-9a-f]+\]`).ReplaceAllString(out.String(), "Closure")
+	if got != strings.Join(expected, "\n") {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), got)
+	}
+}
+
+func TestEngines(t *testing.T) {
+	input := strings.Join([]string{
+		"let double = fn(x) { x * 2 };",
+		":engine",
+		":engine eval",
+		":disasm",
+		"let triple = fn(x) { x * 3 };",
+		":env",
+		"double(2)",
+		"triple(2)",
+		":engine js",
+		":compare",
+		"let n = 4;",
+		"n + 1",
+		"1 + \"a\"",
+		"log(n)",
+		":engine vm",
+		"[n, triple]",
+		"let inc = fn(x) { x + 1 };",
+		"[inc, {\"a\": [inc]}][1]",
+		":env",
+		"",
+	}, "\n")
+
+	var out strings.Builder
+	Start(strings.NewReader(input), &out)
+
+	expected := []string{
+		">> Closure",
+		">> engine vm",
+		// the evaluator runs the inputs of the vm
+		">> engine eval, ran the previous input again",
+		"warning: their side effects, e.g. writing files, were repeated and their output was not shown",
+		">> the eval engine does not compile its inputs, there is no bytecode",
+		">> >> double = fn(x) {",
+		"(x * 2)",
+		"}",
+		"triple = fn(x) {",
+		"(x * 3)",
+		"}",
+		">> 4",
+		">> 6",
+		">> unknown engine \"js\", use vm or eval",
+		// and the vm the inputs of the evaluator
+		">> compare on, ran the 3 previous inputs again",
+		"warning: their side effects, e.g. writing files, were repeated and their output was not shown",
+		">> >> 5",
+		">> ERROR: type mismatch: INTEGER + STRING",
+		"engines differ:",
+		"  vm:   error \"unsupported types for binary operation: INTEGER 2 STRING\"",
+		"  eval: error \"type mismatch: INTEGER + STRING\"",
+		">> 4",
+		"nil",
+		">> engine vm",
+		">> [4, Closure]",
+		">> Closure",
+		">> {a: [Closure]}",
+		">> double = Closure",
+		"triple = Closure",
+		"n = 4",
+		"inc = Closure",
+		">> ",
+	}
+
+	got := regexp.MustCompile(`Closure\[0x[0-9a-f]+\]`).ReplaceAllString(out.String(), "Closure")
+	if got != strings.Join(expected, "\n") {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), got)
+	}
+}
+
+func TestOutcomeDiffers(t *testing.T) {
+	tests := []struct {
+		a, b     outcome
+		expected bool
+	}{
+		{outcome{value: "1"}, outcome{value: "1"}, false},
+		{outcome{value: "1"}, outcome{value: "2"}, true},
+		// statements without a value
+		{outcome{value: "1"}, outcome{}, false},
+		{outcome{value: "1"}, outcome{err: "boom"}, true},
+		{outcome{err: "a"}, outcome{err: "b"}, true},
+		{outcome{output: "a\n", value: "1"}, outcome{output: "b\n", value: "1"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.differs(tt.b); got != tt.expected {
+			t.Errorf("%+v differs %+v: expected %t, got %t", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	var out strings.Builder
+	Start(strings.NewReader(":time\n1 + 1\n:time\n2\n"), &out)
+
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != 6 || lines[1] != ">> 2" || !strings.HasPrefix(lines[2], "time: ") || lines[3] != ">> timing off" || lines[4] != ">> 2" {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+// keys are the bytes sent by a terminal
+func readKeys(t *testing.T, h *history, keys string) (string, error) {
+	t.Helper()
+	e := &editor{in: bufio.NewReader(strings.NewReader(keys)), out: io.Discard, history: h}
+	return e.readLine(PROMPT)
+}
+
+func TestEditor(t *testing.T) {
+	h := &history{entries: []string{"let a = 1;", "a + 1"}}
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"1 + 2\r", "1 + 2"},
+		{"1 2\x1b[D+ \r", "1 + 2"},
+		{"abc\x01x\x05y\r", "xabcy"},
+		{"abc\x02\x02\x06\x08\r", "ac"},
+		{"abc\x01\x1b[3~\x04\r", "c"},
+		{"let x = 1\x17y\r", "let x = y"},
+		{"abc def\x02\x02\x0b\r", "abc d"},
+		{"abc def\x02\x02\x15\r", "ef"},
+		{"a\x7f\x7fb\r", "b"},
+		{"\x1b[A\r", "a + 1"},
+		{"\x1b[A\x1b[A\x1b[A\r", "let a = 1;"},
+		{"new\x10\x10\x0e\x0e\r", "new"},
+		{"\x1b[A\x1b[H!\x1b[F!\r", "!a + 1!"},
+		{"\tx\r", "  x"},
+		{"partial", "partial"},
+	}
+
+	for _, tt := range tests {
+		got, err := readKeys(t, h, tt.keys)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %s", tt.keys, err)
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.keys, tt.expected, got)
+		}
+	}
+
+	// a recalled newline is shown as a symbol and kept in the line
+	var out strings.Builder
+	h = &history{entries: []string{"\"a\nb\""}}
+	e := &editor{in: bufio.NewReader(strings.NewReader("\x1b[A\r")), out: &out, history: h}
+	if got, err := e.readLine(PROMPT); err != nil || got != h.entries[0] {
+		t.Errorf("expected the recalled entry, got %q %v", got, err)
+	}
+	if !strings.Contains(out.String(), PROMPT+"\"a↵b\"") {
+		t.Errorf("expected the newline to be shown as ↵, got %q", out.String())
+	}
+
+	if _, err := readKeys(t, h, "abc\x03"); err != errInterrupted {
+		t.Errorf("expected an interrupt, got %v", err)
+	}
+	if _, err := readKeys(t, h, "\x04"); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h, err := loadHistory(path)
+	if err != nil || len(h.entries) != 0 {
+		t.Fatalf("expected an empty history, got %v %v", h.entries, err)
+	}
+
+	inputs := []string{
+		"1 + 1",
+		"1 + 1",
+		"  ",
+		"let f = fn() {\n  1\n};",
+		"let g = fn() { // doubles\n  \"//\" + 2 // concatenates\n};",
+		"// only a comment",
+		"let s = \"a\n  b\"; // two lines\nlog(s, \"c\\n\")",
+	}
+	for _, input := range inputs {
+		if err := h.add(input); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err = loadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(h.entries, "|"); got != "1 + 1|let f = fn() { 1 };|let g = fn() { \"//\" + 2 };|let s = \"a\n  b\"; log(s, \"c\\n\")" {
+		t.Errorf("wrong entries %q", got)
+	}
+
+	// the newline in the string is escaped to keep the entry on one line
+	data, _ := os.ReadFile(path)
+	if !strings.HasSuffix(string(data), "\nlet s = \"a\\n  b\"; log(s, \"c\\\\n\")\n") {
+		t.Errorf("wrong history file %q", data)
+	}
+
+	var lines strings.Builder
+	for i := 0; i < MaxHistory+10; i++ {
+		lines.WriteString(strings.Repeat("x", i%7+1) + "\n")
+	}
+	if err := os.WriteFile(path, []byte(lines.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err = loadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.entries) != MaxHistory {
+		t.Errorf("expected %d entries, got %d", MaxHistory, len(h.entries))
+	}
+
+	data, _ = os.ReadFile(path)
+	if n := strings.Count(string(data), "\n"); n != MaxHistory {
+		t.Errorf("expected the file to be truncated to %d lines, got %d", MaxHistory, n)
+	}
+}
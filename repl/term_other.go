@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package repl
+
+import (
+	"errors"
+	"os"
+)
+
+// line editing is only supported on unix terminals, other inputs are read line by line
+func isTerminal(f *os.File) bool {
+	return false
+}
+
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw mode is not supported")
+}
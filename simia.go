@@ -0,0 +1,169 @@
+// Package simia embeds the simia language in Go programs.
+//
+//	prog, err := simia.Compile(`price * qty`, simia.WithGlobals("price", "qty"))
+//	result, err := prog.Run(ctx, simia.RunOptions{
+//		Globals: map[string]any{"price": 3, "qty": 4},
+//	})
+//	// result == int64(12)
+package simia
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/prelude"
+	"protiumx.dev/simia/value"
+	"protiumx.dev/simia/vm"
+)
+
+// ParseError holds all the errors reported by the parser
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse errors:\n\t" + strings.Join(e.Errors, "\n\t")
+}
+
+// RuntimeError is returned when a script evaluates to an error value
+type RuntimeError struct {
+	Message string
+}
+
+func (e *RuntimeError) Error() string {
+	return "runtime error: " + e.Message
+}
+
+type compileConfig struct {
+	globals  []string
+	resolver module.Resolver
+}
+
+type CompileOption func(*compileConfig)
+
+// WithGlobals declares names that will be provided by the host when running the program
+func WithGlobals(names ...string) CompileOption {
+	return func(c *compileConfig) {
+		c.globals = append(c.globals, names...)
+	}
+}
+
+// WithResolver sets where the modules loaded with `import` are read from
+func WithResolver(r module.Resolver) CompileOption {
+	return func(c *compileConfig) {
+		c.resolver = r
+	}
+}
+
+// Program is a compiled script that can be run multiple times, also concurrently
+type Program struct {
+	bytecode *compiler.Bytecode
+	globals  map[string]bool
+	pool     *vm.Pool
+}
+
+// Compile parses and compiles src to bytecode
+func Compile(src string, opts ...CompileOption) (*Program, error) {
+	cfg := &compileConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	symbols := prelude.SymbolTable()
+	globals := make(map[string]bool, len(cfg.globals))
+	for _, name := range cfg.globals {
+		symbols.Define(name)
+		globals[name] = true
+	}
+
+	comp := compiler.NewWithState(symbols, prelude.Constants(), compiler.WithResolver(cfg.resolver))
+	if err := comp.Compile(program); err != nil {
+		return nil, fmt.Errorf("compilation error: %w", err)
+	}
+
+	bytecode := comp.Bytecode()
+	return &Program{bytecode: bytecode, globals: globals, pool: vm.NewPool(bytecode, vm.WithInitialGlobals(prelude.Globals()))}, nil
+}
+
+// RunOptions configures a single execution of a program
+type RunOptions struct {
+	// Globals are converted with ToValue. Every name must be declared with WithGlobals
+	Globals map[string]any
+	// Seed makes builtins that use randomness reproducible when non-nil
+	Seed *int64
+	// Permissions granted to the script. Defaults to value.PermNone
+	Permissions value.Permissions
+	// Stdin is read by `read_line`. Defaults to os.Stdin
+	Stdin io.Reader
+	// Stdout receives the output of `log`. Defaults to os.Stdout
+	Stdout io.Writer
+	// Stderr receives the output of `log_error`. Defaults to os.Stderr
+	Stderr io.Writer
+	// Limits bounds the steps, call depth and time of the run
+	Limits value.Limits
+}
+
+// Run executes the program and converts its last evaluated value with ToGo.
+// Exceeding a limit returns a *value.LimitError and cancellation returns the context error
+func (p *Program) Run(ctx context.Context, opts RunOptions) (any, error) {
+	globals := make(map[string]value.Value, len(p.globals))
+	for name := range p.globals {
+		globals[name] = value.NIL
+	}
+
+	for _, name := range sortedNames(opts.Globals) {
+		if !p.globals[name] {
+			return nil, fmt.Errorf("global %s was not declared at compile time", name)
+		}
+
+		val, err := ToValue(opts.Globals[name])
+		if err != nil {
+			return nil, fmt.Errorf("global %s: %w", name, err)
+		}
+		globals[name] = val
+	}
+
+	vmOpts := []vm.Option{vm.WithPermissions(opts.Permissions), vm.WithLimits(opts.Limits)}
+	if opts.Seed != nil {
+		vmOpts = append(vmOpts, vm.WithSeed(*opts.Seed))
+	}
+	if opts.Stdin != nil {
+		vmOpts = append(vmOpts, vm.WithStdin(opts.Stdin))
+	}
+	if opts.Stdout != nil {
+		vmOpts = append(vmOpts, vm.WithStdout(opts.Stdout))
+	}
+	if opts.Stderr != nil {
+		vmOpts = append(vmOpts, vm.WithStderr(opts.Stderr))
+	}
+
+	machine := p.pool.Get(vmOpts...)
+	defer p.pool.Put(machine)
+
+	for name, val := range globals {
+		machine.SetGlobal(name, val)
+	}
+
+	if err := machine.RunContext(ctx); err != nil {
+		return nil, err
+	}
+
+	result := machine.LastPoppedStackElement()
+	if errVal, ok := result.(*value.Error); ok {
+		return nil, &RuntimeError{Message: errVal.Message}
+	}
+
+	return ToGo(result)
+}
@@ -0,0 +1,266 @@
+package simia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/value"
+)
+
+func TestCompileAndRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"1 + 2", int64(3)},
+		{`"foo" + "bar"`, "foobar"},
+		{"1 < 2", true},
+		{"", nil},
+		{"[1, \"a\", [true]]", []any{int64(1), "a", []any{true}}},
+		{`{"a": 1, "b": [2]}`, map[string]any{"a": int64(1), "b": []any{int64(2)}}},
+		{"let add = fn(a, b) { a + b }; add(2, 3)", int64(5)},
+		{"[1, 2, 3] |> map(fn(x) { x * 2 }) |> sum()", int64(12)},
+	}
+
+	for _, tt := range tests {
+		prog, err := Compile(tt.input)
+		if err != nil {
+			t.Fatalf("compile error for %q: %s", tt.input, err)
+		}
+
+		result, err := prog.Run(context.Background(), RunOptions{})
+		if err != nil {
+			t.Fatalf("run error for %q: %s", tt.input, err)
+		}
+
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("wrong result for %q. want=%#v, got=%#v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestRunWithGlobals(t *testing.T) {
+	type item struct {
+		Name   string `simia:"name"`
+		Price  uint
+		secret string
+		Skip   bool `simia:"-"`
+	}
+
+	prog, err := Compile(`[item["name"], item["Price"] * qty, len(tags), tags[1], limits["max"], missing]`,
+		WithGlobals("item", "qty", "tags", "limits", "missing"))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	result, err := prog.Run(context.Background(), RunOptions{
+		Globals: map[string]any{
+			"item":   &item{Name: "pen", Price: 3, secret: "x"},
+			"qty":    int8(4),
+			"tags":   [2]string{"a", "b"},
+			"limits": map[string]int{"max": 10},
+		},
+	})
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+
+	expected := []any{"pen", int64(12), int64(2), "b", int64(10), nil}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("wrong result. want=%#v, got=%#v", expected, result)
+	}
+
+	// a program can be run again with different globals
+	result, err = prog.Run(context.Background(), RunOptions{
+		Globals: map[string]any{"item": item{Name: "ink", Price: 1}, "qty": 2, "tags": []string{"x", "y"}, "limits": map[string]int{}},
+	})
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+
+	expected = []any{"ink", int64(2), int64(2), "y", nil, nil}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("wrong result. want=%#v, got=%#v", expected, result)
+	}
+}
+
+type user struct {
+	Name string
+}
+
+func TestRunWithHostObjects(t *testing.T) {
+	class := &value.HostClass{Name: "User", Fields: []string{"Name"}}
+	prog, err := Compile(`[u["Name"], u]`, WithGlobals("u"))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	u := &user{Name: "ana"}
+	result, err := prog.Run(context.Background(), RunOptions{
+		Globals: map[string]any{"u": value.NewHostObject(u, class)},
+	})
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+
+	// host objects are converted back to the Go value they wrap
+	expected := []any{"ana", u}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("wrong result. want=%#v, got=%#v", expected, result)
+	}
+}
+
+func TestRunWithModules(t *testing.T) {
+	resolver := module.MapResolver{"lib/math": "export let square = fn(x) { x * x };"}
+	prog, err := Compile(`import "lib/math"; math["square"](n)`, WithGlobals("n"), WithResolver(resolver))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	result, err := prog.Run(context.Background(), RunOptions{Globals: map[string]any{"n": 7}})
+	if err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+
+	if result != int64(49) {
+		t.Errorf("wrong result. want=49, got=%v", result)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	if _, err := Compile("let = 1"); err == nil {
+		t.Error("expected parse error")
+	} else if perr := (*ParseError)(nil); !errors.As(err, &perr) {
+		t.Errorf("expected *ParseError, got %T", err)
+	}
+
+	if _, err := Compile("undefined_name"); err == nil || !strings.Contains(err.Error(), "undefined variable undefined_name") {
+		t.Errorf("expected undefined variable error, got %v", err)
+	}
+
+	prog, _ := Compile(`len(1)`)
+	_, err := prog.Run(context.Background(), RunOptions{})
+	if rerr := (*RuntimeError)(nil); !errors.As(err, &rerr) {
+		t.Errorf("expected *RuntimeError, got %v", err)
+	}
+
+	prog, _ = Compile("x", WithGlobals("x"))
+	if _, err := prog.Run(context.Background(), RunOptions{Globals: map[string]any{"y": 1}}); err == nil {
+		t.Error("expected error for undeclared global")
+	}
+
+	if _, err := prog.Run(context.Background(), RunOptions{Globals: map[string]any{"x": 1.5}}); err == nil {
+		t.Error("expected error for unsupported global type")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := prog.Run(ctx, RunOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	prog, _ = Compile("let f = fn(x) { f(x + 1) }; f(0)")
+	_, err = prog.Run(context.Background(), RunOptions{Limits: value.Limits{MaxCallDepth: 100}})
+	if lerr := (*value.LimitError)(nil); !errors.As(err, &lerr) || lerr.Kind != value.CallDepthLimit {
+		t.Errorf("expected call depth limit error, got %v", err)
+	}
+
+	prog, _ = Compile("fn() { 1 }")
+	if _, err := prog.Run(context.Background(), RunOptions{}); err == nil {
+		t.Error("expected error converting a function")
+	}
+}
+
+func TestRunConcurrently(t *testing.T) {
+	prog, err := Compile(`let scale = fn(x) { x * factor }; map(items, scale) |> reduce(fn(a, b) { a + b }, 0)`,
+		WithGlobals("items", "factor"))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(factor int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				result, err := prog.Run(context.Background(), RunOptions{
+					Globals: map[string]any{"items": []int{1, 2, 3}, "factor": factor},
+				})
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if result != int64(6*factor) {
+					errs <- fmt.Errorf("wrong result for factor %d. got=%v", factor, result)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestToValue(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{nil, "nil"},
+		{(*int)(nil), "nil"},
+		{uint64(7), "7"},
+		{[]int(nil), "[]"},
+		{map[string]any{"b": []any{true, "x"}, "a": nil}, "{a: nil, b: [true, x]}"},
+		{&value.Integer{Value: 1}, "1"},
+	}
+
+	for _, tt := range tests {
+		val, err := ToValue(tt.input)
+		if err != nil {
+			t.Fatalf("unexpected error for %#v: %s", tt.input, err)
+		}
+
+		if val.Inspect() != tt.expected {
+			t.Errorf("wrong value for %#v. want=%q, got=%q", tt.input, tt.expected, val.Inspect())
+		}
+	}
+
+	if _, err := ToValue(map[int]int{}); err == nil {
+		t.Error("expected error for non-string map keys")
+	}
+
+	// a value shared twice is not a cycle
+	shared := &node{Name: "b"}
+	val, err := ToValue([]*node{shared, shared})
+	if err != nil || val.Inspect() != "[{Name: b, Next: nil}, {Name: b, Next: nil}]" {
+		t.Errorf("unexpected conversion of a shared pointer: %v, %v", val, err)
+	}
+
+	loop := &node{Name: "a"}
+	loop.Next = &node{Name: "b", Next: loop}
+	self := map[string]any{}
+	self["self"] = self
+	for _, input := range []any{loop, self} {
+		if _, err := ToValue(input); err == nil || !strings.Contains(err.Error(), "cycle through") {
+			t.Errorf("expected a cycle error for %T, got %v", input, err)
+		}
+	}
+}
+
+type node struct {
+	Name string
+	Next *node
+}
@@ -0,0 +1,215 @@
+package testrunner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Summary counts the results of files
+type Summary struct {
+	Passed, Failed, Errors int
+	Duration               time.Duration
+}
+
+func Summarize(files []*File) Summary {
+	var s Summary
+	for _, f := range files {
+		if f.Err != nil {
+			s.Errors++
+		}
+		for _, r := range f.Results {
+			s.Duration += r.Duration
+			switch r.Status {
+			case Pass:
+				s.Passed++
+			case Fail:
+				s.Failed++
+			default:
+				s.Errors++
+			}
+		}
+	}
+
+	return s
+}
+
+// WriteText prints a line for each test, with the message and the output of the
+// tests that did not pass, and a summary
+func WriteText(w io.Writer, files []*File) error {
+	for _, f := range files {
+		if f.Err != nil {
+			fmt.Fprintf(w, "ERROR %s: %s\n", f.Path, f.Err)
+			continue
+		}
+
+		for _, r := range f.Results {
+			fmt.Fprintf(w, "%-5s %s: %s (%s)\n", r.Status, f.Path, r.Name, formatDuration(r.Duration))
+			if r.Status != Pass {
+				writeIndented(w, r.Message)
+				writeIndented(w, r.Output)
+			}
+		}
+	}
+
+	s := Summarize(files)
+	_, err := fmt.Fprintf(w, "\n%d passed, %d failed, %d errors (%s)\n", s.Passed, s.Failed, s.Errors, formatDuration(s.Duration))
+	return err
+}
+
+func writeIndented(w io.Writer, text string) {
+	if text == "" {
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		fmt.Fprintf(w, "    %s\n", line)
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
+
+// WriteTAP prints the results in the Test Anything Protocol version 13, the message
+// and the output of the tests that did not pass are YAML blocks
+func WriteTAP(w io.Writer, files []*File) error {
+	fmt.Fprintln(w, "TAP version 13")
+
+	n := 0
+	for _, f := range files {
+		if f.Err != nil {
+			n++
+			fmt.Fprintf(w, "not ok %d - %s\n", n, f.Path)
+			writeYAML(w, map[string]string{"message": f.Err.Error()})
+			continue
+		}
+
+		for _, r := range f.Results {
+			n++
+			status := "ok"
+			if r.Status != Pass {
+				status = "not ok"
+			}
+			fmt.Fprintf(w, "%s %d - %s: %s # time=%s\n", status, n, f.Path, r.Name, formatDuration(r.Duration))
+			if r.Status != Pass {
+				writeYAML(w, map[string]string{"severity": strings.ToLower(r.Status.String()), "message": r.Message, "output": r.Output})
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "1..%d\n", n)
+	return err
+}
+
+// writeYAML writes a diagnostic block, the values are literal block scalars
+func writeYAML(w io.Writer, fields map[string]string) {
+	fmt.Fprintln(w, "  ---")
+	for _, key := range []string{"severity", "message", "output"} {
+		if value := fields[key]; value != "" {
+			fmt.Fprintf(w, "  %s: |\n", key)
+			for _, line := range strings.Split(strings.TrimSuffix(value, "\n"), "\n") {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+	}
+	fmt.Fprintln(w, "  ...")
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit prints the results as JUnit XML, with a test suite for each file. A file
+// that cannot be compiled is a suite with a single test case that has an error
+func WriteJUnit(w io.Writer, files []*File) error {
+	s := Summarize(files)
+	report := junitSuites{Failures: s.Failed, Errors: s.Errors, Time: seconds(s.Duration)}
+
+	for _, f := range files {
+		summary := Summarize([]*File{f})
+		suite := junitSuite{
+			Name:     f.Path,
+			Failures: summary.Failed,
+			Errors:   summary.Errors,
+			Time:     seconds(summary.Duration),
+		}
+
+		if f.Err != nil {
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      f.Path,
+				Classname: f.Path,
+				Time:      seconds(0),
+				Error:     &junitProblem{Message: firstLine(f.Err.Error()), Text: f.Err.Error()},
+			})
+		}
+
+		for _, r := range f.Results {
+			c := junitCase{Name: r.Name, Classname: f.Path, Time: seconds(r.Duration), SystemOut: r.Output}
+			problem := &junitProblem{Message: firstLine(r.Message), Text: r.Message}
+			switch r.Status {
+			case Fail:
+				c.Failure = problem
+			case Error:
+				c.Error = problem
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+
+		suite.Tests = len(suite.Cases)
+		report.Tests += suite.Tests
+		report.Suites = append(report.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
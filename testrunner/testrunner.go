@@ -0,0 +1,218 @@
+// Package testrunner runs the tests written in simia. Test files end in `_test.sm` and
+// every top-level `let test_name = fn() { ... }` is a test. Each test runs in a new VM
+// that first runs the whole file, so tests cannot see the state left by other tests
+package testrunner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"protiumx.dev/simia/ast"
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/module"
+	"protiumx.dev/simia/parser"
+	"protiumx.dev/simia/prelude"
+	"protiumx.dev/simia/value"
+	"protiumx.dev/simia/vm"
+)
+
+const (
+	// FileSuffix ends the names of test files
+	FileSuffix = "_test.sm"
+	// Prefix starts the names of test functions
+	Prefix = "test_"
+)
+
+type Status int
+
+const (
+	Pass Status = iota
+	// Fail is a failed assertion
+	Fail
+	// Error is any other runtime error, including a test that returns an error value
+	Error
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "PASS"
+	case Fail:
+		return "FAIL"
+	default:
+		return "ERROR"
+	}
+}
+
+// Result is the outcome of a test
+type Result struct {
+	Name     string
+	Status   Status
+	Message  string
+	Duration time.Duration
+	// Output is what the test wrote with `log` and `log_error`
+	Output string
+}
+
+// File holds the results of a test file. Err is set when the file could not be
+// compiled, then there are no results
+type File struct {
+	Path    string
+	Err     error
+	Results []Result
+}
+
+// Failed reports whether the file has errors or failed tests
+func (f *File) Failed() bool {
+	if f.Err != nil {
+		return true
+	}
+
+	for _, r := range f.Results {
+		if r.Status != Pass {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Discover returns the test files of paths, directories are walked recursively.
+// Files given explicitly are returned even if their name is not a test file name
+func Discover(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		var found []string
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(p, FileSuffix) {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+
+	return files, nil
+}
+
+// Run compiles the test file at path and runs its tests in definition order. Scripts
+// get every permission and import modules relative to their directory. Only the tests
+// whose name contains filter run
+func Run(ctx context.Context, path, filter string) *File {
+	file := &File{Path: path}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		file.Err = err
+		return file
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		file.Err = fmt.Errorf("parse errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+		return file
+	}
+
+	resolver := module.NewDirResolver(filepath.Dir(path))
+	comp := compiler.NewWithState(prelude.SymbolTable(), prelude.Constants(), compiler.WithResolver(resolver))
+	if err := comp.Compile(program); err != nil {
+		file.Err = fmt.Errorf("compilation error: %w", err)
+		return file
+	}
+
+	bytecode := comp.Bytecode()
+	for _, name := range Tests(program) {
+		if strings.Contains(name, filter) {
+			file.Results = append(file.Results, runTest(ctx, bytecode, name))
+		}
+	}
+
+	return file
+}
+
+// Tests returns the names of the test functions of a program
+func Tests(program *ast.Program) []string {
+	var names []string
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, Prefix) {
+			continue
+		}
+
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			names = append(names, let.Name.Value)
+		}
+	}
+
+	return names
+}
+
+func runTest(ctx context.Context, bytecode *compiler.Bytecode, name string) Result {
+	var output bytes.Buffer
+	machine := vm.New(bytecode,
+		vm.WithInitialGlobals(prelude.Globals()),
+		vm.WithPermissions(value.PermAll),
+		vm.WithFatalErrors(),
+		vm.WithStdin(strings.NewReader("")),
+		vm.WithStdout(&output),
+		vm.WithStderr(&output),
+	)
+
+	start := time.Now()
+	result, err := run(ctx, machine, name)
+	r := Result{Name: name, Duration: time.Since(start), Output: output.String()}
+
+	var assertErr *value.AssertionError
+	switch {
+	case errors.As(err, &assertErr):
+		r.Status, r.Message = Fail, assertErr.Message
+	case err != nil:
+		r.Status, r.Message = Error, err.Error()
+	case result != nil && result.Type() == value.ERROR_VALUE:
+		r.Status, r.Message = Error, result.(*value.Error).Message
+	}
+
+	return r
+}
+
+// run runs the file and then calls the test function
+func run(ctx context.Context, machine *vm.VM, name string) (value.Value, error) {
+	if err := machine.RunContext(ctx); err != nil {
+		return nil, err
+	}
+
+	fn, _ := machine.Global(name)
+	if cl, ok := fn.(*value.Closure); ok && cl.Fn.ArgumentsCount != 0 {
+		return nil, fmt.Errorf("test functions take no arguments, %s takes %d", name, cl.Fn.ArgumentsCount)
+	}
+
+	return machine.CallContext(ctx, fn)
+}
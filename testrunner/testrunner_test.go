@@ -0,0 +1,191 @@
+package testrunner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, src string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const mathTests = `import "math";
+log("setup");
+let test_add = fn() { assert_eq(math["add"](1, 2), 3) };
+let test_message = fn() { assert(len([]) == 0, "empty") };
+let test_fail = fn() {
+  log("checking");
+  assert_eq([1, 2], [1, 3]);
+  log("unreachable");
+};
+let test_error = fn() { 1 + "a" };
+let test_error_value = fn() { len(1) };
+let test_dropped_error = fn() { len(1); assert(true) };
+let test_expected_error = fn() { assert_error(fn() { len(1) }, "must be") };
+let test_args = fn(x) { x };
+let helper = fn() { assert(false) };
+`
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "math.sm", "export let add = fn(a, b) { a + b };")
+	path := writeFile(t, dir, "math_test.sm", mathTests)
+
+	file := Run(context.Background(), path, "")
+	if file.Err != nil {
+		t.Fatalf("unexpected error: %s", file.Err)
+	}
+
+	expected := []Result{
+		// the file runs again for each test
+		{Name: "test_add", Status: Pass, Output: "setup\n"},
+		{Name: "test_message", Status: Pass, Output: "setup\n"},
+		{Name: "test_fail", Status: Fail, Message: "values are not equal\nexpected: [1, 3]\n  actual: [1, 2]\n              ^", Output: "setup\nchecking\n"},
+		{Name: "test_error", Status: Error, Message: "unsupported types for binary operation: INTEGER 2 STRING", Output: "setup\n"},
+		{Name: "test_error_value", Status: Error, Message: "argument to `len` must be STRING or ARRAY or HASH, got INTEGER", Output: "setup\n"},
+		// the error is not the value of the test
+		{Name: "test_dropped_error", Status: Error, Message: "argument to `len` must be STRING or ARRAY or HASH, got INTEGER", Output: "setup\n"},
+		{Name: "test_expected_error", Status: Pass, Output: "setup\n"},
+		{Name: "test_args", Status: Error, Message: "test functions take no arguments, test_args takes 1", Output: "setup\n"},
+	}
+
+	if len(file.Results) != len(expected) {
+		t.Fatalf("expected %d results, got %+v", len(expected), file.Results)
+	}
+
+	for i, r := range file.Results {
+		r.Duration = 0
+		if r != expected[i] {
+			t.Errorf("wrong result %d.\nwant=%+v\ngot= %+v", i, expected[i], r)
+		}
+	}
+
+	if !file.Failed() {
+		t.Error("expected the file to fail")
+	}
+
+	filtered := Run(context.Background(), path, "add")
+	if len(filtered.Results) != 1 || filtered.Failed() {
+		t.Errorf("expected one passing test, got %+v", filtered.Results)
+	}
+
+	broken := Run(context.Background(), writeFile(t, dir, "broken_test.sm", "let test_x = fn() { y };"), "")
+	if broken.Err == nil || broken.Err.Error() != "compilation error: undefined variable y" {
+		t.Errorf("expected a compilation error, got %v", broken.Err)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a_test.sm", "")
+	b := writeFile(t, dir, "lib/b_test.sm", "")
+	writeFile(t, dir, "lib/b.sm", "")
+	other := writeFile(t, dir, "other.sm", "")
+
+	files, err := Discover([]string{dir, other})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{a, b, other}; strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+
+	if _, err := Discover([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+}
+
+func reportFiles() []*File {
+	return []*File{
+		{Path: "a_test.sm", Results: []Result{
+			{Name: "test_ok", Status: Pass},
+			{Name: "test_bad", Status: Fail, Message: "values are not equal\nexpected: 1\n  actual: 2", Output: "a < b\n"},
+		}},
+		{Path: "b_test.sm", Err: os.ErrNotExist},
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var out strings.Builder
+	WriteText(&out, reportFiles())
+
+	expected := `PASS  a_test.sm: test_ok (0s)
+FAIL  a_test.sm: test_bad (0s)
+    values are not equal
+    expected: 1
+      actual: 2
+    a < b
+ERROR b_test.sm: file does not exist
+
+1 passed, 1 failed, 1 errors (0s)
+`
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteTAP(t *testing.T) {
+	var out strings.Builder
+	WriteTAP(&out, reportFiles())
+
+	expected := `TAP version 13
+ok 1 - a_test.sm: test_ok # time=0s
+not ok 2 - a_test.sm: test_bad # time=0s
+  ---
+  severity: |
+    fail
+  message: |
+    values are not equal
+    expected: 1
+      actual: 2
+  output: |
+    a < b
+  ...
+not ok 3 - b_test.sm
+  ---
+  message: |
+    file does not exist
+  ...
+1..3
+`
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var out strings.Builder
+	WriteJUnit(&out, reportFiles())
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3" failures="1" errors="1" time="0.000">
+  <testsuite name="a_test.sm" tests="2" failures="1" errors="0" time="0.000">
+    <testcase name="test_ok" classname="a_test.sm" time="0.000"></testcase>
+    <testcase name="test_bad" classname="a_test.sm" time="0.000">
+      <failure message="values are not equal">values are not equal&#xA;expected: 1&#xA;  actual: 2</failure>
+      <system-out>a &lt; b&#xA;</system-out>
+    </testcase>
+  </testsuite>
+  <testsuite name="b_test.sm" tests="1" failures="0" errors="1" time="0.000">
+    <testcase name="b_test.sm" classname="b_test.sm" time="0.000">
+      <error message="file does not exist">file does not exist</error>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -1,5 +1,7 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 const (
@@ -13,6 +15,9 @@ const (
 	INT    = "INT"
 	STRING = "STRING"
 
+	// Comments are not returned by the lexer, see lexer.Comments
+	COMMENT = "COMMENT"
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -48,6 +53,8 @@ const (
 	RETURN   = "RETURN"
 	FOR      = "FOR"
 	IN       = "IN"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
 )
 
 var keywords = map[string]TokenType{
@@ -60,11 +67,25 @@ var keywords = map[string]TokenType{
 	"return": RETURN,
 	"for":    FOR,
 	"in":     IN,
+	"import": IMPORT,
+	"export": EXPORT,
 }
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position is where a token starts in the source. Lines and columns start at 1,
+// the zero value is an unknown position
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 func GetIdentifierType(ident string) TokenType {
@@ -1,74 +1,163 @@
 package value
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
-var Builtins = []struct {
-	Name    string
-	Builtin *Builtin
-}{
-	{
-		Name: "len",
-		Builtin: &Builtin{
-			Fn: func(args ...Value) Value {
-				if len(args) != 1 {
-					return newError("wrong number of arguments. got=%d, want=1", len(args))
-				}
+var (
+	iterableParam = Param{Name: "iterable", Types: []ValueType{ARRAY_VALUE, RANGE_VALUE}}
+	fnParam       = Param{Name: "fn", Types: FunctionTypes}
+)
 
-				switch arg := args[0].(type) {
-				case *String:
-					return &Integer{Value: int64(len(arg.Value))}
-				case *Array:
-					return &Integer{Value: int64(len(arg.Elements))}
-				default:
-					return newError("argument to `len` not supported, got %s", arg.Type())
-				}
-			},
+// coreBuiltins are registered in order, so new builtins must be appended to keep
+// the indexes used by compiled bytecode stable
+var coreBuiltins = []*Builtin{
+	{
+		Name:   "len",
+		Params: []Param{{Name: "value", Types: []ValueType{STRING_VALUE, ARRAY_VALUE, HASH_VALUE}}},
+		Fn: func(_ Runtime, args ...Value) Value {
+			switch arg := args[0].(type) {
+			case *String:
+				return &Integer{Value: int64(len(arg.Value))}
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			default:
+				return &Integer{Value: int64(len(arg.(*Hash).Pairs))}
+			}
 		},
 	},
 	{
-		Name: "log",
-		Builtin: &Builtin{
-			Fn: func(args ...Value) Value {
-				for _, arg := range args {
-					fmt.Println(arg.Inspect())
-				}
-				return nil
-			},
+		Name:     "log",
+		Params:   []Param{anyParam("args")},
+		Optional: 1,
+		Variadic: true,
+		Fn: func(rt Runtime, args ...Value) Value {
+			return writeLines(rt.Stdout(), args)
 		},
 	},
-
 	{
-		Name: "append",
-		Builtin: &Builtin{
-			Fn: func(args ...Value) Value {
-				if len(args) != 2 {
-					return newError("wrong number of arguments. got=%d, want=2", len(args))
-				}
-
-				if t := args[0].Type(); t != ARRAY_VALUE {
-					return newError("argument must be %s, got %s", ARRAY_VALUE, t)
-				}
+		Name:   "append",
+		Params: []Param{arrayParam("array"), anyParam("value")},
+		Fn: func(_ Runtime, args ...Value) Value {
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
 
-				arr := args[0].(*Array)
-				length := len(arr.Elements)
+			newElements := make([]Value, length+1, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
 
-				newElements := make([]Value, length+1, length+1)
-				copy(newElements, arr.Elements)
-				newElements[length] = args[1]
-
-				return &Array{Elements: newElements}
-			},
+			return &Array{Elements: newElements}
 		},
 	},
+	{Name: "map", Params: []Param{iterableParam, fnParam}, Fn: builtinMap},
+	{Name: "filter", Params: []Param{iterableParam, fnParam}, Fn: builtinFilter},
+	{Name: "reduce", Params: []Param{iterableParam, fnParam, anyParam("initial")}, Fn: builtinReduce},
+	{Name: "sort_by", Params: []Param{iterableParam, fnParam}, Fn: builtinSortBy},
+	{Name: "each", Params: []Param{iterableParam, fnParam}, Fn: builtinEach},
+	{Name: "keys", Params: []Param{hashParam("hash")}, Fn: builtinKeys},
+	{Name: "values", Params: []Param{hashParam("hash")}, Fn: builtinValues},
+	{Name: "entries", Params: []Param{hashParam("hash")}, Fn: builtinEntries},
+	{Name: "has", Params: []Param{hashParam("hash"), stringParam("key")}, Fn: builtinHas},
+	{Name: "get", Params: []Param{hashParam("hash"), stringParam("key"), anyParam("default")}, Fn: builtinGet},
+	{Name: "delete", Params: []Param{hashParam("hash"), stringParam("key")}, Fn: builtinDelete},
+	{Name: "merge", Params: []Param{hashParam("hashes")}, Variadic: true, Fn: builtinMerge},
+	{Name: "abs", Params: []Param{intParam("n")}, Fn: builtinAbs},
+	{Name: "min", Params: []Param{anyParam("values")}, Variadic: true, Fn: builtinMin},
+	{Name: "max", Params: []Param{anyParam("values")}, Variadic: true, Fn: builtinMax},
+	{Name: "pow", Params: []Param{intParam("base"), intParam("exp")}, Fn: builtinPow},
+	{Name: "clamp", Params: []Param{intParam("n"), intParam("lo"), intParam("hi")}, Fn: builtinClamp},
+	{Name: "sqrt", Params: []Param{intParam("n")}, Fn: builtinSqrt},
+	{Name: "rand_int", Params: []Param{intParam("lo"), intParam("hi")}, Fn: builtinRandInt},
+	{Name: "shuffle", Params: []Param{arrayParam("array")}, Fn: builtinShuffle},
+	{
+		Name:     "json_encode",
+		Params:   []Param{anyParam("value"), {Name: "pretty", Types: []ValueType{BOOLEAN_VALUE}}},
+		Optional: 1,
+		Fn:       builtinJSONEncode,
+	},
+	{Name: "json_decode", Params: []Param{stringParam("json")}, Fn: builtinJSONDecode},
+	{Name: "type", Params: []Param{anyParam("value")}, Fn: builtinType},
+	{Name: "str", Params: []Param{anyParam("value")}, Fn: builtinStr},
+	{Name: "int", Params: []Param{anyParam("value")}, Fn: builtinInt},
+	{Name: "bool", Params: []Param{anyParam("value")}, Fn: builtinBool},
+	{Name: "is_int", Params: []Param{anyParam("value")}, Fn: typePredicate("int")},
+	{Name: "is_string", Params: []Param{anyParam("value")}, Fn: typePredicate("string")},
+	{Name: "is_bool", Params: []Param{anyParam("value")}, Fn: typePredicate("bool")},
+	{Name: "is_array", Params: []Param{anyParam("value")}, Fn: typePredicate("array")},
+	{Name: "is_hash", Params: []Param{anyParam("value")}, Fn: typePredicate("hash")},
+	{Name: "is_range", Params: []Param{anyParam("value")}, Fn: typePredicate("range")},
+	{Name: "is_fn", Params: []Param{anyParam("value")}, Fn: typePredicate("fn")},
+	{Name: "is_nil", Params: []Param{anyParam("value")}, Fn: typePredicate("nil")},
+	{Name: "read_file", Params: []Param{stringParam("path")}, Fn: builtinReadFile},
+	{Name: "write_file", Params: []Param{stringParam("path"), stringParam("content")}, Fn: builtinWriteFile},
+	{Name: "list_dir", Params: []Param{stringParam("path")}, Fn: builtinListDir},
+	{Name: "read_line", Fn: builtinReadLine},
+	{Name: "env", Params: []Param{stringParam("name")}, Fn: builtinEnv},
+	{
+		Name:     "log_error",
+		Params:   []Param{anyParam("args")},
+		Optional: 1,
+		Variadic: true,
+		Fn: func(rt Runtime, args ...Value) Value {
+			return writeLines(rt.Stderr(), args)
+		},
+	},
+	{
+		Name:     "assert",
+		Params:   []Param{anyParam("condition"), anyParam("message")},
+		Optional: 1,
+		Fn:       builtinAssert,
+	},
+	{
+		Name:     "assert_eq",
+		Params:   []Param{anyParam("actual"), anyParam("expected"), anyParam("message")},
+		Optional: 1,
+		Fn:       builtinAssertEq,
+	},
+	{
+		Name:     "assert_error",
+		Params:   []Param{fnParam, stringParam("contains"), anyParam("message")},
+		Optional: 2,
+		Fn:       builtinAssertError,
+	},
 }
 
-func GetBuiltinByName(name string) *Builtin {
-	for _, b := range Builtins {
-		if b.Name == name {
-			return b.Builtin
+func init() {
+	for _, b := range coreBuiltins {
+		if err := RegisterBuiltin(b); err != nil {
+			panic(err)
 		}
 	}
+}
+
+func anyParam(name string) Param {
+	return Param{Name: name}
+}
+
+func intParam(name string) Param {
+	return Param{Name: name, Types: []ValueType{INTEGER_VALUE}}
+}
+
+func stringParam(name string) Param {
+	return Param{Name: name, Types: []ValueType{STRING_VALUE}}
+}
+
+func arrayParam(name string) Param {
+	return Param{Name: name, Types: []ValueType{ARRAY_VALUE}}
+}
 
+func hashParam(name string) Param {
+	return Param{Name: name, Types: []ValueType{HASH_VALUE}}
+}
+
+// writeLines writes each value on its own line
+func writeLines(w io.Writer, args []Value) Value {
+	for _, arg := range args {
+		if _, err := fmt.Fprintln(w, arg.Inspect()); err != nil {
+			return newError("%s", err)
+		}
+	}
 	return nil
 }
 
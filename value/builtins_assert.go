@@ -0,0 +1,123 @@
+package value
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AssertionError is the error a failed assertion stops the program with
+type AssertionError struct {
+	Message string
+}
+
+func (e *AssertionError) Error() string {
+	return e.Message
+}
+
+// fail aborts the program. args are the arguments of the assertion, the one at index
+// msg is the optional message
+func fail(rt Runtime, args []Value, msg int, format string, a ...any) Value {
+	text := fmt.Sprintf(format, a...)
+	if msg < len(args) {
+		text = args[msg].Inspect() + ": " + text
+	}
+
+	return rt.Abort(&AssertionError{Message: text})
+}
+
+func builtinAssert(rt Runtime, args ...Value) Value {
+	if !isTruthy(args[0]) {
+		return fail(rt, args, 1, "assertion failed")
+	}
+
+	return nil
+}
+
+func builtinAssertEq(rt Runtime, args ...Value) Value {
+	actual, expected := args[0], args[1]
+	if !equal(actual, expected) {
+		return fail(rt, args, 2, "values are not equal\n%s", diff(expected, actual))
+	}
+
+	return nil
+}
+
+// builtinAssertError calls fn and returns the message of the error it returns
+func builtinAssertError(rt Runtime, args ...Value) Value {
+	result := rt.Call(args[0])
+	errVal, ok := result.(*Error)
+	if !ok {
+		return fail(rt, args, 2, "expected an error, got %s", result.Inspect())
+	}
+
+	if len(args) > 1 {
+		if want := args[1].(*String).Value; !strings.Contains(errVal.Message, want) {
+			return fail(rt, args, 2, "expected an error containing %q, got %q", want, errVal.Message)
+		}
+	}
+
+	return &String{Value: errVal.Message}
+}
+
+// equal compares values structurally, functions are equal only to themselves
+func equal(a, b Value) bool {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Nil:
+		return b.Type() == NIL_VALUE
+	case *Error:
+		b, ok := b.(*Error)
+		return ok && a.Message == b.Message
+	case *Range:
+		b, ok := b.(*Range)
+		return ok && a.Start == b.Start && a.End == b.End
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !equal(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for k, v := range a.Pairs {
+			if other, ok := b.Pairs[k]; !ok || !equal(v, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// diff shows the Inspect output of both values and marks where they start to differ.
+// The types are shown when the outputs are the same, e.g. for 1 and "1"
+func diff(expected, actual Value) string {
+	want, got := expected.Inspect(), actual.Inspect()
+	if want == got {
+		return fmt.Sprintf("expected: %s (%s)\n  actual: %s (%s)", want, TypeName(expected), got, TypeName(actual))
+	}
+
+	i := 0
+	for i < len(want) && i < len(got) && want[i] == got[i] {
+		i++
+	}
+
+	return fmt.Sprintf("expected: %s\n  actual: %s\n          %s^", want, got, strings.Repeat(" ", i))
+}
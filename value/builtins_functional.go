@@ -0,0 +1,139 @@
+package value
+
+import "sort"
+
+func builtinMap(rt Runtime, args ...Value) Value {
+	elements, fn := iterableElements(args[0]), args[1]
+
+	mapped := make([]Value, len(elements))
+	for i, el := range elements {
+		result := rt.Call(fn, el)
+		if isError(result) {
+			return result
+		}
+		mapped[i] = result
+	}
+
+	return &Array{Elements: mapped}
+}
+
+func builtinFilter(rt Runtime, args ...Value) Value {
+	elements, fn := iterableElements(args[0]), args[1]
+
+	filtered := []Value{}
+	for _, el := range elements {
+		result := rt.Call(fn, el)
+		if isError(result) {
+			return result
+		}
+
+		if isTruthy(result) {
+			filtered = append(filtered, el)
+		}
+	}
+
+	return &Array{Elements: filtered}
+}
+
+func builtinEach(rt Runtime, args ...Value) Value {
+	elements, fn := iterableElements(args[0]), args[1]
+
+	for _, el := range elements {
+		result := rt.Call(fn, el)
+		if isError(result) {
+			return result
+		}
+	}
+
+	return nil
+}
+
+func builtinReduce(rt Runtime, args ...Value) Value {
+	elements, fn, acc := iterableElements(args[0]), args[1], args[2]
+
+	for _, el := range elements {
+		acc = rt.Call(fn, acc, el)
+		if isError(acc) {
+			return acc
+		}
+	}
+
+	return acc
+}
+
+func builtinSortBy(rt Runtime, args ...Value) Value {
+	elements, fn := iterableElements(args[0]), args[1]
+
+	keys := make([]Value, len(elements))
+	for i, el := range elements {
+		key := rt.Call(fn, el)
+		if isError(key) {
+			return key
+		}
+
+		if key.Type() != INTEGER_VALUE && key.Type() != STRING_VALUE {
+			return newError("sort_by key must be %s or %s, got %s", INTEGER_VALUE, STRING_VALUE, key.Type())
+		}
+
+		if i > 0 && key.Type() != keys[0].Type() {
+			return newError("sort_by keys must have the same type, got %s and %s", keys[0].Type(), key.Type())
+		}
+		keys[i] = key
+	}
+
+	indexes := make([]int, len(elements))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	sort.SliceStable(indexes, func(i, j int) bool {
+		switch left := keys[indexes[i]].(type) {
+		case *Integer:
+			return left.Value < keys[indexes[j]].(*Integer).Value
+		case *String:
+			return left.Value < keys[indexes[j]].(*String).Value
+		}
+		return false
+	})
+
+	sorted := make([]Value, len(elements))
+	for i, idx := range indexes {
+		sorted[i] = elements[idx]
+	}
+
+	return &Array{Elements: sorted}
+}
+
+// iterableElements returns the elements of an array or a range
+func iterableElements(iterable Value) []Value {
+	if arr, ok := iterable.(*Array); ok {
+		return arr.Elements
+	}
+
+	r := iterable.(*Range)
+	step := int64(1)
+	if r.End < r.Start {
+		step = -1
+	}
+
+	elements := []Value{}
+	for i := r.Start; i != r.End; i += step {
+		elements = append(elements, &Integer{Value: i})
+	}
+	return elements
+}
+
+func isError(val Value) bool {
+	return val != nil && val.Type() == ERROR_VALUE
+}
+
+func isTruthy(val Value) bool {
+	switch val := val.(type) {
+	case *Integer:
+		return val.Value != 0
+	case *Boolean:
+		return val.Value
+	default:
+		return false
+	}
+}
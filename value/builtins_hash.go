@@ -0,0 +1,92 @@
+package value
+
+import "sort"
+
+func builtinKeys(_ Runtime, args ...Value) Value {
+	hash := args[0].(*Hash)
+
+	keys := sortedKeys(hash)
+	elements := make([]Value, len(keys))
+	for i, k := range keys {
+		elements[i] = &String{Value: k}
+	}
+
+	return &Array{Elements: elements}
+}
+
+func builtinValues(_ Runtime, args ...Value) Value {
+	hash := args[0].(*Hash)
+
+	keys := sortedKeys(hash)
+	elements := make([]Value, len(keys))
+	for i, k := range keys {
+		elements[i] = hash.Pairs[k]
+	}
+
+	return &Array{Elements: elements}
+}
+
+func builtinEntries(_ Runtime, args ...Value) Value {
+	hash := args[0].(*Hash)
+
+	keys := sortedKeys(hash)
+	elements := make([]Value, len(keys))
+	for i, k := range keys {
+		elements[i] = &Array{Elements: []Value{&String{Value: k}, hash.Pairs[k]}}
+	}
+
+	return &Array{Elements: elements}
+}
+
+func builtinHas(_ Runtime, args ...Value) Value {
+	hash, key := args[0].(*Hash), args[1].(*String).Value
+
+	_, ok := hash.Pairs[key]
+	return BooleanValue(ok)
+}
+
+func builtinGet(_ Runtime, args ...Value) Value {
+	hash, key := args[0].(*Hash), args[1].(*String).Value
+
+	if val, ok := hash.Pairs[key]; ok {
+		return val
+	}
+
+	return args[2]
+}
+
+func builtinDelete(_ Runtime, args ...Value) Value {
+	hash, key := args[0].(*Hash), args[1].(*String).Value
+
+	pairs := make(map[string]Value, len(hash.Pairs))
+	for k, v := range hash.Pairs {
+		if k != key {
+			pairs[k] = v
+		}
+	}
+
+	return &Hash{Pairs: pairs}
+}
+
+func builtinMerge(_ Runtime, args ...Value) Value {
+	pairs := make(map[string]Value)
+	for _, arg := range args {
+		// later hashes take precedence
+		for k, v := range arg.(*Hash).Pairs {
+			pairs[k] = v
+		}
+	}
+
+	return &Hash{Pairs: pairs}
+}
+
+// sortedKeys returns the hash keys in a deterministic order
+func sortedKeys(hash *Hash) []string {
+	keys := make([]string, 0, len(hash.Pairs))
+	for k := range hash.Pairs {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,100 @@
+package value
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+func builtinReadFile(rt Runtime, args ...Value) Value {
+	if err := checkPermission(rt, PermReadFile, "read_file"); err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(args[0].(*String).Value)
+	if err != nil {
+		return newError("read_file: %s", err)
+	}
+
+	return &String{Value: string(content)}
+}
+
+func builtinWriteFile(rt Runtime, args ...Value) Value {
+	if err := checkPermission(rt, PermWriteFile, "write_file"); err != nil {
+		return err
+	}
+
+	path, content := args[0].(*String).Value, args[1].(*String).Value
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return newError("write_file: %s", err)
+	}
+
+	return nil
+}
+
+// builtinListDir returns the sorted names of the directory entries
+func builtinListDir(rt Runtime, args ...Value) Value {
+	if err := checkPermission(rt, PermListDir, "list_dir"); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(args[0].(*String).Value)
+	if err != nil {
+		return newError("list_dir: %s", err)
+	}
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	sort.Strings(names)
+
+	elements := make([]Value, len(names))
+	for i, name := range names {
+		elements[i] = &String{Value: name}
+	}
+
+	return &Array{Elements: elements}
+}
+
+// builtinReadLine returns the next line of the input without the line break, or nil at the end
+func builtinReadLine(rt Runtime, args ...Value) Value {
+	if err := checkPermission(rt, PermStdin, "read_line"); err != nil {
+		return err
+	}
+
+	line, err := rt.Stdin().ReadString('\n')
+	if err == io.EOF && line == "" {
+		return NIL
+	}
+
+	if err != nil && err != io.EOF {
+		return newError("read_line: %s", err)
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	return &String{Value: strings.TrimSuffix(line, "\r")}
+}
+
+// builtinEnv returns the value of the environment variable, or nil when it is not set
+func builtinEnv(rt Runtime, args ...Value) Value {
+	if err := checkPermission(rt, PermEnv, "env"); err != nil {
+		return err
+	}
+
+	val, ok := os.LookupEnv(args[0].(*String).Value)
+	if !ok {
+		return NIL
+	}
+
+	return &String{Value: val}
+}
+
+func checkPermission(rt Runtime, perm Permissions, name string) *Error {
+	if !rt.Permissions().Has(perm) {
+		return newError("permission denied: `%s` requires the %s capability", name, perm)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package value
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// builtinJSONEncode encodes a value as JSON. A second `true` argument pretty prints the output
+func builtinJSONEncode(_ Runtime, args ...Value) Value {
+	pretty := len(args) == 2 && args[1].(*Boolean).Value
+
+	native, err := toJSON(args[0], "$")
+	if err != nil {
+		return newError("json_encode: %s", err)
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+
+	if err := enc.Encode(native); err != nil {
+		return newError("json_encode: %s", err)
+	}
+
+	return &String{Value: strings.TrimSuffix(out.String(), "\n")}
+}
+
+func builtinJSONDecode(_ Runtime, args ...Value) Value {
+	str := args[0].(*String)
+	d := &jsonDecoder{input: str.Value, dec: json.NewDecoder(strings.NewReader(str.Value))}
+	d.dec.UseNumber()
+
+	val, err := d.decode()
+	if err != nil {
+		return newError("json_decode: %s", err)
+	}
+
+	// only a single top-level value is allowed
+	if _, err := d.dec.Token(); err != io.EOF {
+		return newError("json_decode: unexpected data after top-level value at %s", d.position(d.dec.InputOffset()))
+	}
+
+	return val
+}
+
+// toJSON converts a value into the Go representation used by encoding/json.
+// path is reported in errors to locate the value that cannot be encoded
+func toJSON(val Value, path string) (any, error) {
+	switch val := val.(type) {
+	case *Integer:
+		return val.Value, nil
+	case *String:
+		return val.Value, nil
+	case *Boolean:
+		return val.Value, nil
+	case *Nil:
+		return nil, nil
+	case *Array:
+		elements := make([]any, len(val.Elements))
+		for i, el := range val.Elements {
+			native, err := toJSON(el, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = native
+		}
+		return elements, nil
+	case *Hash:
+		pairs := make(map[string]any, len(val.Pairs))
+		for k, v := range val.Pairs {
+			native, err := toJSON(v, fmt.Sprintf("%s[%q]", path, k))
+			if err != nil {
+				return nil, err
+			}
+			pairs[k] = native
+		}
+		return pairs, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s at %s", val.Type(), path)
+	}
+}
+
+type jsonDecoder struct {
+	input string
+	dec   *json.Decoder
+}
+
+func (d *jsonDecoder) decode() (Value, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, d.wrapError(err)
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			return d.decodeArray()
+		}
+		return d.decodeObject()
+	case string:
+		return &String{Value: tok}, nil
+	case bool:
+		return BooleanValue(tok), nil
+	case nil:
+		return NIL, nil
+	case json.Number:
+		n, err := strconv.ParseInt(tok.String(), 10, 64)
+		if err != nil {
+			start := d.dec.InputOffset() - int64(len(tok.String()))
+			return nil, fmt.Errorf("number %s is not an integer at %s", tok, d.position(start))
+		}
+		return &Integer{Value: n}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected token %v at %s", tok, d.position(d.dec.InputOffset()))
+}
+
+func (d *jsonDecoder) decodeArray() (Value, error) {
+	elements := []Value{}
+	for d.dec.More() {
+		el, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, el)
+	}
+
+	// closing bracket
+	if _, err := d.dec.Token(); err != nil {
+		return nil, d.wrapError(err)
+	}
+
+	return &Array{Elements: elements}, nil
+}
+
+func (d *jsonDecoder) decodeObject() (Value, error) {
+	pairs := make(map[string]Value)
+	for d.dec.More() {
+		tok, err := d.dec.Token()
+		if err != nil {
+			return nil, d.wrapError(err)
+		}
+
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("object key is not string at %s", d.position(d.dec.InputOffset()))
+		}
+
+		val, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		pairs[key] = val
+	}
+
+	// closing brace
+	if _, err := d.dec.Token(); err != nil {
+		return nil, d.wrapError(err)
+	}
+
+	return &Hash{Pairs: pairs}, nil
+}
+
+// wrapError adds the line and column where decoding failed
+func (d *jsonDecoder) wrapError(err error) error {
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%s at %s", err, d.position(syntaxErr.Offset))
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("unexpected end of input at %s", d.position(int64(len(d.input))))
+	default:
+		return fmt.Errorf("%s at %s", err, d.position(d.dec.InputOffset()))
+	}
+}
+
+// position converts a byte offset into a 1-based line:column pair
+func (d *jsonDecoder) position(offset int64) string {
+	if offset > int64(len(d.input)) {
+		offset = int64(len(d.input))
+	}
+
+	consumed := d.input[:offset]
+	line := strings.Count(consumed, "\n") + 1
+	column := offset - int64(strings.LastIndex(consumed, "\n"))
+	return fmt.Sprintf("line %d, column %d", line, column)
+}
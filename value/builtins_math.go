@@ -0,0 +1,181 @@
+package value
+
+import "math"
+
+func builtinAbs(_ Runtime, args ...Value) Value {
+	n := args[0].(*Integer).Value
+	if n == math.MinInt64 {
+		return newError("integer overflow in `abs`: %d", n)
+	}
+	if n < 0 {
+		return &Integer{Value: -n}
+	}
+
+	return &Integer{Value: n}
+}
+
+func builtinMin(_ Runtime, args ...Value) Value {
+	return extremum("min", args, func(a, b int64) bool { return a < b })
+}
+
+func builtinMax(_ Runtime, args ...Value) Value {
+	return extremum("max", args, func(a, b int64) bool { return a > b })
+}
+
+func builtinPow(_ Runtime, args ...Value) Value {
+	base, exp := args[0].(*Integer).Value, args[1].(*Integer).Value
+	if exp < 0 {
+		return newError("negative exponent for `pow`: %d", exp)
+	}
+
+	// base is only squared while bits of exp are left, so an overflow of base means
+	// the result overflows too
+	result, ok := int64(1), true
+	for exp > 0 {
+		if exp&1 == 1 {
+			if result, ok = multiply(result, base); !ok {
+				break
+			}
+		}
+		if exp >>= 1; exp > 0 {
+			if base, ok = multiply(base, base); !ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return newError("integer overflow in `pow`: %d ** %d", args[0].(*Integer).Value, args[1].(*Integer).Value)
+	}
+
+	return &Integer{Value: result}
+}
+
+// multiply returns a*b and false when the product overflows int64
+func multiply(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+
+	product := a * b
+	if product/b != a || a == -1 && b == math.MinInt64 || b == -1 && a == math.MinInt64 {
+		return 0, false
+	}
+
+	return product, true
+}
+
+func builtinClamp(_ Runtime, args ...Value) Value {
+	n, lo, hi := args[0].(*Integer).Value, args[1].(*Integer).Value, args[2].(*Integer).Value
+	if lo > hi {
+		return newError("invalid bounds for `clamp`: %d > %d", lo, hi)
+	}
+
+	switch {
+	case n < lo:
+		n = lo
+	case n > hi:
+		n = hi
+	}
+
+	return &Integer{Value: n}
+}
+
+// builtinSqrt returns the integer square root, rounded down
+func builtinSqrt(_ Runtime, args ...Value) Value {
+	n := args[0].(*Integer).Value
+	if n < 0 {
+		return newError("square root of negative number: %d", n)
+	}
+
+	// floor(sqrt(math.MaxInt64)), larger roots would overflow when squared
+	const maxRoot = 3037000499
+
+	root := int64(math.Sqrt(float64(n)))
+	if root > maxRoot {
+		root = maxRoot
+	}
+
+	// correct float rounding for large values
+	for root*root > n {
+		root--
+	}
+	for root < maxRoot && (root+1)*(root+1) <= n {
+		root++
+	}
+
+	return &Integer{Value: root}
+}
+
+// builtinRandInt returns a random integer in [lo, hi), matching the range operator
+func builtinRandInt(rt Runtime, args ...Value) Value {
+	lo, hi := args[0].(*Integer).Value, args[1].(*Integer).Value
+	if lo >= hi {
+		return newError("invalid bounds for `rand_int`: %d >= %d", lo, hi)
+	}
+
+	// hi-lo overflows int64 when the bounds are far apart, the span always fits in uint64
+	span := uint64(hi) - uint64(lo)
+	if span <= math.MaxInt64 {
+		return &Integer{Value: lo + rt.Rand().Int63n(int64(span))}
+	}
+
+	// more than half of the draws are below a span wider than MaxInt64
+	n := rt.Rand().Uint64()
+	for n >= span {
+		n = rt.Rand().Uint64()
+	}
+
+	return &Integer{Value: int64(uint64(lo) + n)}
+}
+
+// builtinShuffle returns a shuffled copy of the array
+func builtinShuffle(rt Runtime, args ...Value) Value {
+	arr := args[0].(*Array)
+	elements := make([]Value, len(arr.Elements))
+	copy(elements, arr.Elements)
+	rt.Rand().Shuffle(len(elements), func(i, j int) {
+		elements[i], elements[j] = elements[j], elements[i]
+	})
+
+	return &Array{Elements: elements}
+}
+
+// extremum accepts either integers or a single array of integers
+func extremum(name string, args []Value, better func(a, b int64) bool) Value {
+	if len(args) == 1 {
+		if arr, ok := args[0].(*Array); ok {
+			args = arr.Elements
+		}
+	}
+
+	if len(args) == 0 {
+		return newError("`%s` requires at least one integer", name)
+	}
+
+	ints, err := integerArguments(name, args)
+	if err != nil {
+		return err
+	}
+
+	result := ints[0]
+	for _, n := range ints[1:] {
+		if better(n, result) {
+			result = n
+		}
+	}
+
+	return &Integer{Value: result}
+}
+
+func integerArguments(name string, args []Value) ([]int64, *Error) {
+	ints := make([]int64, len(args))
+	for i, arg := range args {
+		integer, ok := arg.(*Integer)
+		if !ok {
+			return nil, newError("argument to `%s` must be %s, got %s", name, INTEGER_VALUE, arg.Type())
+		}
+		ints[i] = integer.Value
+	}
+
+	return ints, nil
+}
@@ -0,0 +1,93 @@
+package value
+
+import "strconv"
+
+// typeNames maps value types to the names used in the language syntax
+var typeNames = map[ValueType]string{
+	INTEGER_VALUE:           "int",
+	STRING_VALUE:            "string",
+	BOOLEAN_VALUE:           "bool",
+	NIL_VALUE:               "nil",
+	ARRAY_VALUE:             "array",
+	HASH_VALUE:              "hash",
+	RANGE_VALUE:             "range",
+	FUNCTION_VALUE:          "fn",
+	CLOSURE_VALUE:           "fn",
+	BUILTIN_VALUE:           "fn",
+	COMPILED_FUNCTION_VALUE: "fn",
+	ERROR_VALUE:             "error",
+	HOST_VALUE:              "host",
+}
+
+// TypeName returns the name of the value type as exposed to scripts
+func TypeName(val Value) string {
+	if name, ok := typeNames[val.Type()]; ok {
+		return name
+	}
+
+	return string(val.Type())
+}
+
+func builtinType(_ Runtime, args ...Value) Value {
+	return &String{Value: TypeName(args[0])}
+}
+
+func builtinStr(_ Runtime, args ...Value) Value {
+	if str, ok := args[0].(*String); ok {
+		return str
+	}
+
+	return &String{Value: args[0].Inspect()}
+}
+
+func builtinInt(_ Runtime, args ...Value) Value {
+	switch arg := args[0].(type) {
+	case *Integer:
+		return arg
+	case *Boolean:
+		if arg.Value {
+			return &Integer{Value: 1}
+		}
+		return &Integer{Value: 0}
+	case *String:
+		n, err := strconv.ParseInt(arg.Value, 10, 64)
+		if err != nil {
+			if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+				return newError("cannot convert %q to int: out of range", arg.Value)
+			}
+			return newError("cannot convert %q to int: invalid syntax", arg.Value)
+		}
+		return &Integer{Value: n}
+	default:
+		return newError("cannot convert %s to int", TypeName(arg))
+	}
+}
+
+func builtinBool(_ Runtime, args ...Value) Value {
+	switch arg := args[0].(type) {
+	case *Boolean:
+		return arg
+	case *Integer:
+		return BooleanValue(arg.Value != 0)
+	case *Nil:
+		return FALSE
+	case *String:
+		switch arg.Value {
+		case "true":
+			return TRUE
+		case "false":
+			return FALSE
+		default:
+			return newError("cannot convert %q to bool", arg.Value)
+		}
+	default:
+		return newError("cannot convert %s to bool", TypeName(arg))
+	}
+}
+
+// typePredicate builds an `is_<type>` builtin
+func typePredicate(name string) BuiltinFunction {
+	return func(_ Runtime, args ...Value) Value {
+		return BooleanValue(TypeName(args[0]) == name)
+	}
+}
@@ -0,0 +1,338 @@
+package value
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// FromGo converts a Go value into a simia value using reflection.
+// Integers, strings, booleans, slices, arrays, maps with string keys and structs
+// are supported. Struct fields can be renamed or skipped with the `simia` tag.
+// Values that contain themselves, e.g. through a pointer, are rejected
+func FromGo(v any) (Value, error) {
+	return (&converter{}).fromGo(v)
+}
+
+// converter holds the state of a FromGo conversion
+type converter struct {
+	// visiting are the pointers and maps being converted, a cycle reaches one again
+	visiting map[visit]bool
+	// host wraps structs as host objects of class instead of converting them to hashes,
+	// so their fields are only exposed through a class. Structs are rejected when class
+	// is nil
+	host  bool
+	class *HostClass
+}
+
+type visit struct {
+	t   reflect.Type
+	ptr uintptr
+}
+
+func (c *converter) fromGo(v any) (Value, error) {
+	if v == nil {
+		return NIL, nil
+	}
+
+	if val, ok := v.(Value); ok {
+		return val, nil
+	}
+
+	return c.reflectToValue(reflect.ValueOf(v))
+}
+
+func (c *converter) reflectToValue(rv reflect.Value) (Value, error) {
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return NIL, nil
+
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return NIL, nil
+		}
+
+		if val, ok := rv.Interface().(Value); ok {
+			return val, nil
+		}
+
+		if rv.Kind() == reflect.Pointer {
+			if c.host && rv.Elem().Kind() == reflect.Struct {
+				return c.hostObject(rv)
+			}
+
+			leave, err := c.enter(rv)
+			if err != nil {
+				return nil, err
+			}
+			defer leave()
+		}
+		return c.reflectToValue(rv.Elem())
+
+	case reflect.Bool:
+		return BooleanValue(rv.Bool()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: rv.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := rv.Uint()
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d overflows int64", n)
+		}
+		return &Integer{Value: int64(n)}, nil
+
+	case reflect.String:
+		return &String{Value: rv.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return &Array{Elements: []Value{}}, nil
+		}
+
+		if rv.Kind() == reflect.Slice && rv.Len() > 0 {
+			leave, err := c.enter(rv)
+			if err != nil {
+				return nil, err
+			}
+			defer leave()
+		}
+
+		elements := make([]Value, rv.Len())
+		for i := range elements {
+			el, err := c.reflectToValue(rv.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elements[i] = el
+		}
+		return &Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", rv.Type().Key())
+		}
+
+		if rv.IsNil() {
+			return &Hash{Pairs: map[string]Value{}}, nil
+		}
+
+		leave, err := c.enter(rv)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+
+		pairs := make(map[string]Value, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			val, err := c.reflectToValue(iter.Value())
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", iter.Key().String(), err)
+			}
+			pairs[iter.Key().String()] = val
+		}
+		return &Hash{Pairs: pairs}, nil
+
+	case reflect.Struct:
+		if c.host {
+			return c.hostObject(rv)
+		}
+
+		pairs := make(map[string]Value)
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := field.Name
+			if tag, ok := field.Tag.Lookup("simia"); ok {
+				name = tag
+			}
+
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+
+			val, err := c.reflectToValue(rv.Field(i))
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			pairs[name] = val
+		}
+		return &Hash{Pairs: pairs}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported Go type %s", rv.Type())
+	}
+}
+
+// enter marks a pointer, slice or map as being converted. It fails when the value is
+// already being converted, i.e. it contains itself
+func (c *converter) enter(rv reflect.Value) (func(), error) {
+	v := visit{rv.Type(), rv.Pointer()}
+	if c.visiting[v] {
+		return nil, fmt.Errorf("cycle through %s", rv.Type())
+	}
+
+	if c.visiting == nil {
+		c.visiting = map[visit]bool{}
+	}
+	c.visiting[v] = true
+
+	return func() { delete(c.visiting, v) }, nil
+}
+
+// hostObject wraps a struct or struct pointer reached through a host object
+func (c *converter) hostObject(rv reflect.Value) (Value, error) {
+	if c.class == nil {
+		return nil, fmt.Errorf("struct %s has no class", rv.Type())
+	}
+
+	return NewHostObject(rv.Interface(), c.class), nil
+}
+
+// ToGo converts a simia value into int64, string, bool, nil, []any or map[string]any.
+// Host objects are converted to the Go value they wrap
+func ToGo(v Value) (any, error) {
+	switch v := v.(type) {
+	case nil, *Nil:
+		return nil, nil
+	case *HostObject:
+		return v.Value, nil
+	case *Integer:
+		return v.Value, nil
+	case *String:
+		return v.Value, nil
+	case *Boolean:
+		return v.Value, nil
+	case *Array:
+		elements := make([]any, len(v.Elements))
+		for i, el := range v.Elements {
+			native, err := ToGo(el)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = native
+		}
+		return elements, nil
+	case *Hash:
+		pairs := make(map[string]any, len(v.Pairs))
+		for k, val := range v.Pairs {
+			native, err := ToGo(val)
+			if err != nil {
+				return nil, err
+			}
+			pairs[k] = native
+		}
+		return pairs, nil
+	case *Range:
+		elements := []any{}
+		step := int64(1)
+		if v.End < v.Start {
+			step = -1
+		}
+		for i := v.Start; i != v.End; i += step {
+			elements = append(elements, i)
+		}
+		return elements, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", v.Type())
+	}
+}
+
+// toReflect converts a simia value into a Go value of type t
+func toReflect(v Value, t reflect.Type) (reflect.Value, error) {
+	if host, ok := v.(*HostObject); ok {
+		rv := reflect.ValueOf(host.Value)
+		if rv.Type().AssignableTo(t) {
+			return rv, nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		native, err := ToGo(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		if native == nil {
+			return reflect.Zero(t), nil
+		}
+
+		rv := reflect.ValueOf(native)
+		if !rv.Type().AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("cannot use %s as %s", v.Type(), t)
+		}
+		return rv, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := v.(*Integer)
+		if !ok {
+			break
+		}
+
+		rv := reflect.New(t).Elem()
+		if rv.OverflowInt(n.Value) {
+			return reflect.Value{}, fmt.Errorf("integer %d overflows %s", n.Value, t)
+		}
+		rv.SetInt(n.Value)
+		return rv, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := v.(*Integer)
+		if !ok {
+			break
+		}
+
+		rv := reflect.New(t).Elem()
+		if n.Value < 0 || rv.OverflowUint(uint64(n.Value)) {
+			return reflect.Value{}, fmt.Errorf("integer %d overflows %s", n.Value, t)
+		}
+		rv.SetUint(uint64(n.Value))
+		return rv, nil
+
+	case reflect.String:
+		if s, ok := v.(*String); ok {
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		}
+
+	case reflect.Bool:
+		if b, ok := v.(*Boolean); ok {
+			return reflect.ValueOf(b.Value).Convert(t), nil
+		}
+
+	case reflect.Slice:
+		arr, ok := v.(*Array)
+		if !ok {
+			break
+		}
+
+		rv := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+		for i, el := range arr.Elements {
+			elem, err := toReflect(el, t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("index %d: %w", i, err)
+			}
+			rv.Index(i).Set(elem)
+		}
+		return rv, nil
+
+	case reflect.Map:
+		hash, ok := v.(*Hash)
+		if !ok || t.Key().Kind() != reflect.String {
+			break
+		}
+
+		rv := reflect.MakeMapWithSize(t, len(hash.Pairs))
+		for k, val := range hash.Pairs {
+			elem, err := toReflect(val, t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("key %q: %w", k, err)
+			}
+			rv.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), elem)
+		}
+		return rv, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", v.Type(), t)
+}
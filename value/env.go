@@ -1,5 +1,7 @@
 package value
 
+import "sort"
+
 func NewEnvironment(outer *Environment) *Environment {
 	s := make(map[string]Value)
 	return &Environment{store: s, outer: outer}
@@ -26,3 +28,15 @@ func (e *Environment) Set(name string, val Value) Value {
 
 	return val
 }
+
+// Names returns the names defined in the environment, without its outer environments,
+// sorted
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,178 @@
+package value
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// HostClass lists the members of a Go type that scripts can access with the index
+// operator, e.g. `user["name"]` or `user["greet"]("hi")`. Members that are not listed
+// are not exposed
+type HostClass struct {
+	Name string
+	// Fields are read with reflection from the struct or the struct pointer
+	Fields []string
+	// Methods are called with reflection. Arguments are converted to the parameter
+	// types and results with FromGo. A last error result is returned as an error value
+	Methods []string
+	// Accessors compute members in Go and take precedence over fields and methods
+	Accessors map[string]func(obj any) Value
+	// Classes wrap the structs and struct pointers returned by fields and methods as
+	// host objects, by member name. Members that return structs without a class fail,
+	// so fields that are not listed are never exposed
+	Classes map[string]*HostClass
+}
+
+// HostObject wraps a Go value so scripts can use the members exposed by its class
+type HostObject struct {
+	Value any
+	Class *HostClass
+}
+
+func NewHostObject(v any, class *HostClass) *HostObject {
+	return &HostObject{Value: v, Class: class}
+}
+
+func (h *HostObject) Type() ValueType {
+	return HOST_VALUE
+}
+
+func (h *HostObject) Inspect() string {
+	return fmt.Sprintf("<%s>", h.Class.Name)
+}
+
+// Member returns the value of a field or accessor, or a method bound to the object
+func (h *HostObject) Member(name string) (Value, error) {
+	if accessor, ok := h.Class.Accessors[name]; ok {
+		if result := accessor(h.Value); result != nil {
+			return result, nil
+		}
+		return NIL, nil
+	}
+
+	if contains(h.Class.Fields, name) {
+		return h.field(name)
+	}
+
+	if contains(h.Class.Methods, name) {
+		return h.method(name)
+	}
+
+	return nil, fmt.Errorf("%s has no member %s", h.Class.Name, name)
+}
+
+func (h *HostObject) field(name string) (Value, error) {
+	rv := reflect.ValueOf(h.Value)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("%s is nil", h.Class.Name)
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s has no field %s", h.Class.Name, name)
+	}
+
+	field := rv.FieldByName(name)
+	if !field.IsValid() || !field.CanInterface() {
+		return nil, fmt.Errorf("%s has no field %s", h.Class.Name, name)
+	}
+
+	return h.fromGo(name, field.Interface())
+}
+
+// fromGo converts the value of a member, wrapping its structs with the member class
+func (h *HostObject) fromGo(name string, v any) (Value, error) {
+	c := &converter{host: true, class: h.Class.Classes[name]}
+	return c.fromGo(v)
+}
+
+// method returns a builtin that calls the Go method with the object as receiver
+func (h *HostObject) method(name string) (Value, error) {
+	method := reflect.ValueOf(h.Value).MethodByName(name)
+	if !method.IsValid() {
+		return nil, fmt.Errorf("%s has no method %s", h.Class.Name, name)
+	}
+
+	t := method.Type()
+	params := make([]Param, t.NumIn())
+	for i := range params {
+		params[i] = anyParam(fmt.Sprintf("arg%d", i))
+	}
+
+	optional := 0
+	if t.IsVariadic() {
+		optional = 1
+	}
+
+	fullName := h.Class.Name + "." + name
+	return &Builtin{
+		Name:     fullName,
+		Params:   params,
+		Optional: optional,
+		Variadic: t.IsVariadic(),
+		Fn: func(_ Runtime, args ...Value) Value {
+			in := make([]reflect.Value, len(args))
+			for i, arg := range args {
+				var paramType reflect.Type
+				if t.IsVariadic() && i >= t.NumIn()-1 {
+					paramType = t.In(t.NumIn() - 1).Elem()
+				} else {
+					paramType = t.In(i)
+				}
+
+				converted, err := toReflect(arg, paramType)
+				if err != nil {
+					return newError("argument %d to `%s`: %s", i+1, fullName, err)
+				}
+				in[i] = converted
+			}
+
+			return h.hostResult(name, fullName, method.Call(in))
+		},
+	}, nil
+}
+
+// hostResult converts the results of a Go method. A trailing non-nil error is
+// returned as an error value
+func (h *HostObject) hostResult(member, name string, out []reflect.Value) Value {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return newError("%s: %s", name, err)
+		}
+		out = out[:len(out)-1]
+	}
+
+	switch len(out) {
+	case 0:
+		return NIL
+	case 1:
+		val, err := h.fromGo(member, out[0].Interface())
+		if err != nil {
+			return newError("%s: %s", name, err)
+		}
+		return val
+	default:
+		elements := make([]Value, len(out))
+		for i, o := range out {
+			val, err := h.fromGo(member, o.Interface())
+			if err != nil {
+				return newError("%s: %s", name, err)
+			}
+			elements[i] = val
+		}
+		return &Array{Elements: elements}
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package value
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// the context and the clock are checked on the first step and then every checkInterval steps
+const checkInterval = 1 << 10
+
+// Limits bounds the resources used by a single execution. Zero values disable a limit
+type Limits struct {
+	// MaxSteps is the number of instructions run by the VM or nodes evaluated by the evaluator
+	MaxSteps int64
+	// MaxCallDepth is the number of nested function calls
+	MaxCallDepth int
+	// Timeout is the wall-clock time the execution can take
+	Timeout time.Duration
+}
+
+type LimitKind int
+
+const (
+	StepLimit LimitKind = iota + 1
+	CallDepthLimit
+	TimeLimit
+)
+
+// LimitError is returned when an execution exceeds one of its Limits
+type LimitError struct {
+	Kind  LimitKind
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	switch e.Kind {
+	case StepLimit:
+		return fmt.Sprintf("step limit of %d exceeded", e.Limit)
+	case CallDepthLimit:
+		return fmt.Sprintf("call depth limit of %d exceeded", e.Limit)
+	default:
+		return fmt.Sprintf("time limit of %s exceeded", time.Duration(e.Limit))
+	}
+}
+
+// Budget tracks the usage of Limits and the cancellation of a context during an execution.
+// A nil Budget has no limits
+type Budget struct {
+	ctx      context.Context
+	limits   Limits
+	deadline time.Time
+	steps    int64
+	err      error // once exceeded, every following step fails
+}
+
+func NewBudget(ctx context.Context, limits Limits) *Budget {
+	b := &Budget{ctx: ctx, limits: limits}
+	if limits.Timeout > 0 {
+		b.deadline = time.Now().Add(limits.Timeout)
+	}
+
+	return b
+}
+
+// Step counts one unit of work. It returns a *LimitError when a limit is exceeded
+// or the context error once it is done
+func (b *Budget) Step() error {
+	if b == nil {
+		return nil
+	}
+
+	if b.err != nil {
+		return b.err
+	}
+
+	b.steps++
+	if b.limits.MaxSteps > 0 && b.steps > b.limits.MaxSteps {
+		b.err = &LimitError{Kind: StepLimit, Limit: b.limits.MaxSteps}
+	} else if (b.steps-1)%checkInterval == 0 {
+		b.err = b.check()
+	}
+
+	return b.err
+}
+
+// CheckDepth returns a *LimitError when depth nested calls exceed the limit
+func (b *Budget) CheckDepth(depth int) error {
+	if b == nil || b.limits.MaxCallDepth <= 0 || depth <= b.limits.MaxCallDepth {
+		return nil
+	}
+
+	return &LimitError{Kind: CallDepthLimit, Limit: int64(b.limits.MaxCallDepth)}
+}
+
+func (b *Budget) check() error {
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return &LimitError{Kind: TimeLimit, Limit: int64(b.limits.Timeout)}
+	}
+
+	select {
+	case <-b.ctx.Done():
+		return b.ctx.Err()
+	default:
+		return nil
+	}
+}
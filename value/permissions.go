@@ -0,0 +1,48 @@
+package value
+
+import "strings"
+
+// Permissions is the set of capabilities the host grants to a script.
+// Builtins that touch the host system fail unless the capability is granted
+type Permissions uint
+
+const (
+	PermReadFile Permissions = 1 << iota
+	PermWriteFile
+	PermListDir
+	PermStdin
+	PermEnv
+
+	PermNone Permissions = 0
+	PermAll              = PermReadFile | PermWriteFile | PermListDir | PermStdin | PermEnv
+)
+
+var permissionNames = []struct {
+	perm Permissions
+	name string
+}{
+	{PermReadFile, "read_file"},
+	{PermWriteFile, "write_file"},
+	{PermListDir, "list_dir"},
+	{PermStdin, "stdin"},
+	{PermEnv, "env"},
+}
+
+func (p Permissions) Has(perm Permissions) bool {
+	return p&perm == perm
+}
+
+func (p Permissions) String() string {
+	names := []string{}
+	for _, pn := range permissionNames {
+		if p.Has(pn.perm) {
+			names = append(names, pn.name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, "|")
+}
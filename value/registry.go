@@ -0,0 +1,193 @@
+package value
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MaxBuiltins is limited by the 1 byte operand of code.OpGetBuiltin
+const MaxBuiltins = 1 << 8
+
+// FunctionTypes are the value types that can be called
+var FunctionTypes = []ValueType{FUNCTION_VALUE, CLOSURE_VALUE, BUILTIN_VALUE}
+
+type Param struct {
+	Name string
+	// Types accepted by the parameter. Empty accepts any type
+	Types []ValueType
+}
+
+// registry holds every builtin in definition order. The index of a builtin is
+// used by the compiler and the vm, so builtins can only be appended
+var registry = struct {
+	sync.RWMutex
+	builtins []*Builtin
+	index    map[string]int
+}{index: make(map[string]int)}
+
+// RegisterBuiltin makes a builtin available to the evaluator and to every
+// compiler and vm created afterwards
+func RegisterBuiltin(b *Builtin) error {
+	if b.Name == "" || b.Fn == nil {
+		return fmt.Errorf("builtin must have a name and a function")
+	}
+
+	if b.Optional > len(b.Params) {
+		return fmt.Errorf("builtin %s has more optional parameters than parameters", b.Name)
+	}
+
+	if b.Variadic && len(b.Params) == 0 {
+		return fmt.Errorf("variadic builtin %s must declare a parameter", b.Name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.index[b.Name]; ok {
+		return fmt.Errorf("builtin %s already registered", b.Name)
+	}
+
+	if len(registry.builtins) >= MaxBuiltins {
+		return fmt.Errorf("cannot register builtin %s: limit of %d builtins reached", b.Name, MaxBuiltins)
+	}
+
+	registry.index[b.Name] = len(registry.builtins)
+	registry.builtins = append(registry.builtins, b)
+	return nil
+}
+
+// Builtins returns the registered builtins, the position of each builtin is its index
+func Builtins() []*Builtin {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	builtins := make([]*Builtin, len(registry.builtins))
+	copy(builtins, registry.builtins)
+	return builtins
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	if i, ok := registry.index[name]; ok {
+		return registry.builtins[i]
+	}
+
+	return nil
+}
+
+func GetBuiltinByIndex(index int) *Builtin {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	if index < 0 || index >= len(registry.builtins) {
+		return nil
+	}
+
+	return registry.builtins[index]
+}
+
+// MinArgs is the number of required arguments
+func (b *Builtin) MinArgs() int {
+	return len(b.Params) - b.Optional
+}
+
+// MaxArgs is the maximum number of arguments, -1 if the builtin is variadic
+func (b *Builtin) MaxArgs() int {
+	if b.Variadic {
+		return -1
+	}
+
+	return len(b.Params)
+}
+
+// Signature describes the builtin parameters, e.g. `has(hash: HASH, key: STRING)`
+func (b *Builtin) Signature() string {
+	params := make([]string, len(b.Params))
+	for i, p := range b.Params {
+		param := p.Name
+		if len(p.Types) > 0 {
+			param += ": " + typeLabels(p.Types)
+		}
+
+		if b.Variadic && i == len(b.Params)-1 {
+			param = "..." + param
+		}
+
+		if i >= len(b.Params)-b.Optional {
+			param += "?"
+		}
+		params[i] = param
+	}
+
+	return fmt.Sprintf("%s(%s)", b.Name, strings.Join(params, ", "))
+}
+
+// Call validates the arguments against the builtin signature before calling it
+func (b *Builtin) Call(rt Runtime, args ...Value) Value {
+	if err := b.checkArguments(args); err != nil {
+		return err
+	}
+
+	return b.Fn(rt, args...)
+}
+
+func (b *Builtin) checkArguments(args []Value) *Error {
+	min, max := b.MinArgs(), b.MaxArgs()
+	switch {
+	case min == max && len(args) != min:
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), min)
+	case len(args) < min:
+		return newError("wrong number of arguments. got=%d, want at least %d", len(args), min)
+	case max != -1 && len(args) > max:
+		return newError("wrong number of arguments. got=%d, want at most %d", len(args), max)
+	}
+
+	for i, arg := range args {
+		param := b.Params[len(b.Params)-1]
+		if i < len(b.Params) {
+			param = b.Params[i]
+		}
+
+		if !acceptsType(param.Types, arg.Type()) {
+			return newError("argument to `%s` must be %s, got %s", b.Name, typeLabels(param.Types), arg.Type())
+		}
+	}
+
+	return nil
+}
+
+func acceptsType(types []ValueType, t ValueType) bool {
+	if len(types) == 0 {
+		return true
+	}
+
+	for _, accepted := range types {
+		if accepted == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typeLabels joins the types, all the callable types are shown as FN
+func typeLabels(types []ValueType) string {
+	labels := []string{}
+	seen := make(map[string]bool)
+	for _, t := range types {
+		label := string(t)
+		if acceptsType(FunctionTypes, t) {
+			label = FUNCTION_VALUE
+		}
+
+		if !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+	}
+
+	return strings.Join(labels, " or ")
+}
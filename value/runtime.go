@@ -0,0 +1,27 @@
+package value
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+)
+
+// Runtime is implemented by the execution engines and handed to every builtin,
+// so native functions can call back into simia code
+type Runtime interface {
+	// Call applies fn to args. Errors are returned as *Error values
+	Call(fn Value, args ...Value) Value
+	// Abort stops the program with err, which the engine returns like a *LimitError.
+	// The result is the value returned by the builtin
+	Abort(err error) Value
+	// Rand is the random source configured by the host
+	Rand() *rand.Rand
+	// Permissions are the capabilities granted by the host
+	Permissions() Permissions
+	// Stdin is the input read by `read_line`
+	Stdin() *bufio.Reader
+	// Stdout receives the output of `log`
+	Stdout() io.Writer
+	// Stderr receives the output of `log_error`
+	Stderr() io.Writer
+}
@@ -24,6 +24,7 @@ const (
 	HASH_VALUE                        = "HASH"
 	RANGE_VALUE                       = "RANGE"
 	CLOSURE_VALUE                     = "CLOSURE"
+	HOST_VALUE                        = "HOST"
 	// For expressions that do not return a value
 	EMPTY_VALUE = "EMPTY"
 )
@@ -33,6 +34,20 @@ type Value interface {
 	Inspect() string
 }
 
+// Boolean and nil values are singletons so engines can compare them by pointer
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NIL   = &Nil{}
+)
+
+func BooleanValue(v bool) *Boolean {
+	if v {
+		return TRUE
+	}
+	return FALSE
+}
+
 type Integer struct {
 	Value int64
 }
@@ -129,10 +144,16 @@ func (fn *Function) Inspect() string {
 	return out.String()
 }
 
-type BuiltinFunction func(args ...Value) Value
+type BuiltinFunction func(rt Runtime, args ...Value) Value
 
 type Builtin struct {
-	Fn BuiltinFunction
+	Name   string
+	Params []Param
+	// Optional is the number of trailing params that can be omitted
+	Optional int
+	// Variadic allows repeating the last param
+	Variadic bool
+	Fn       BuiltinFunction
 }
 
 func (b *Builtin) Type() ValueType {
@@ -177,11 +198,10 @@ func (h *Hash) Type() ValueType {
 func (h *Hash) Inspect() string {
 	var out strings.Builder
 
-	pairs := make([]string, len(h.Pairs), len(h.Pairs))
-	i := 0
-	for k, v := range h.Pairs {
-		pairs[i] = fmt.Sprintf("%s: %s", k, v.Inspect())
-		i++
+	keys := sortedKeys(h)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s: %s", k, h.Pairs[k].Inspect())
 	}
 
 	out.WriteString("{")
@@ -213,6 +233,15 @@ type CompiledFunction struct {
 	Instructions   code.Instructions
 	LocalsCount    int
 	ArgumentsCount int
+	// Name is the binding the function was defined with, if any
+	Name string
+	// File is the module or library the function was compiled from, empty for the main program
+	File string
+	// Lines maps the instructions to lines of File
+	Lines code.LineTable
+	// Locals names the local slots, parameters first. Slots of bindings shadowed by a
+	// later definition with the same name keep their own name
+	Locals []string
 }
 
 func (cf *CompiledFunction) Type() ValueType {
@@ -0,0 +1,101 @@
+package vm
+
+import (
+	"sort"
+
+	"protiumx.dev/simia/value"
+)
+
+// LineHook is called before a frame runs the first instruction of a source line. file
+// is the module or library of the function, empty for the main program
+type LineHook func(vm *VM, file string, line int) error
+
+// WithLineHook calls hook each time a frame reaches a new source line, e.g. to stop at
+// breakpoints or step through a program. The VM can be inspected from the hook with
+// Depth, Frames, Locals and Globals. An error returned by the hook stops the run
+func WithLineHook(hook LineHook) Option {
+	return func(vm *VM) {
+		vm.hook = hook
+	}
+}
+
+// StackFrame describes a function being run
+type StackFrame struct {
+	// Function is the binding the function was defined with, empty for anonymous
+	// functions and the main program
+	Function string
+	File     string
+	Line     int
+}
+
+// Variable is a named value of a frame or of the globals
+type Variable struct {
+	Name  string
+	Value value.Value
+}
+
+// reportLine calls the hook when the instruction at ip starts a new line of the frame
+func (vm *VM) reportLine(frame *Frame, ip int) error {
+	fn := frame.cl.Fn
+	line := fn.Lines.Line(ip)
+	if line == 0 || line == frame.line {
+		return nil
+	}
+
+	frame.line = line
+	if err := vm.hook(vm, fn.File, line); err != nil {
+		// stops the builtins that call back into the program, e.g. map
+		vm.aborted = err
+		return err
+	}
+
+	return nil
+}
+
+// Depth returns the number of frames in the call stack, 1 while the main program runs
+func (vm *VM) Depth() int {
+	return vm.framesIndex
+}
+
+// Frames returns the call stack, the innermost frame first
+func (vm *VM) Frames() []StackFrame {
+	frames := make([]StackFrame, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+		frames = append(frames, StackFrame{Function: fn.Name, File: fn.File, Line: fn.Lines.Line(frame.ip)})
+	}
+
+	return frames
+}
+
+// Locals returns the locals of a frame that have a value, by slot. depth is the index
+// of the frame in Frames. Functions compiled without local names have no locals
+func (vm *VM) Locals(depth int) []Variable {
+	if depth < 0 || depth >= vm.framesIndex {
+		return nil
+	}
+
+	frame := vm.frames[vm.framesIndex-1-depth]
+	locals := []Variable{}
+	for i, name := range frame.cl.Fn.Locals {
+		if val := vm.stack[frame.basePointer+i]; val != nil && name != "" {
+			locals = append(locals, Variable{name, val})
+		}
+	}
+
+	return locals
+}
+
+// Globals returns the globals of the program that have a value, by index
+func (vm *VM) Globals() []Variable {
+	globals := []Variable{}
+	for name, idx := range vm.names {
+		if val := vm.globals[idx]; val != nil {
+			globals = append(globals, Variable{name, val})
+		}
+	}
+
+	sort.Slice(globals, func(i, j int) bool { return vm.names[globals[i].Name] < vm.names[globals[j].Name] })
+	return globals
+}
@@ -9,10 +9,12 @@ type Frame struct {
 	cl          *value.Closure
 	ip          int
 	basePointer int // also called frame pointer
+	// line is the last source line reported to the line hook
+	line int
 }
 
 func NewFrame(cl *value.Closure, basePointer int) *Frame {
-	return &Frame{cl, -1, basePointer}
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
 }
 
 func (f *Frame) Instructions() code.Instructions {
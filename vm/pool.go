@@ -0,0 +1,53 @@
+package vm
+
+import (
+	"sync"
+
+	"protiumx.dev/simia/compiler"
+	"protiumx.dev/simia/value"
+)
+
+// Pool reuses VMs to run the same bytecode many times, possibly from many goroutines.
+// Each VM taken from the pool starts with empty globals
+type Pool struct {
+	bytecode *compiler.Bytecode
+	opts     []Option
+	vms      sync.Pool
+}
+
+// NewPool creates a pool of VMs for the bytecode. opts are applied to every VM
+func NewPool(bytecode *compiler.Bytecode, opts ...Option) *Pool {
+	return &Pool{bytecode: bytecode, opts: opts}
+}
+
+// Get returns a VM ready to run. opts are applied after the options of the pool
+func (p *Pool) Get(opts ...Option) *VM {
+	vm, ok := p.vms.Get().(*VM)
+	if !ok {
+		return New(p.bytecode, append(p.opts[:len(p.opts):len(p.opts)], opts...)...)
+	}
+
+	vm.reset(p.bytecode, p.opts...)
+	for _, opt := range opts {
+		opt(vm)
+	}
+
+	return vm
+}
+
+// Put returns a VM taken with Get to the pool. The VM must not be used afterwards
+func (p *Pool) Put(vm *VM) {
+	clearValues(vm.stack)
+	clearValues(vm.globals)
+	for i := range vm.frames {
+		vm.frames[i] = nil
+	}
+
+	p.vms.Put(vm)
+}
+
+func clearValues(values []value.Value) {
+	for i := range values {
+		values[i] = nil
+	}
+}
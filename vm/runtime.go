@@ -0,0 +1,60 @@
+package vm
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+
+	"protiumx.dev/simia/value"
+)
+
+// runtime lets builtins call back into closures running on the VM
+type runtime struct {
+	vm *VM
+}
+
+func (r *runtime) Call(fn value.Value, args ...value.Value) value.Value {
+	result, err := r.vm.call(fn, args...)
+	if err != nil {
+		// the builtin cannot handle the limits and the cancellation, they stop the program
+		// like in the evaluator
+		if isLimit(err) {
+			r.vm.aborted = err
+		}
+		return &value.Error{Message: err.Error()}
+	}
+
+	return result
+}
+
+func isLimit(err error) bool {
+	var limitErr *value.LimitError
+	return errors.As(err, &limitErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (r *runtime) Abort(err error) value.Value {
+	r.vm.aborted = err
+	return &value.Error{Message: err.Error()}
+}
+
+func (r *runtime) Rand() *rand.Rand {
+	return r.vm.rand
+}
+
+func (r *runtime) Permissions() value.Permissions {
+	return r.vm.permissions
+}
+
+func (r *runtime) Stdin() *bufio.Reader {
+	return r.vm.stdin
+}
+
+func (r *runtime) Stdout() io.Writer {
+	return r.vm.stdout
+}
+
+func (r *runtime) Stderr() io.Writer {
+	return r.vm.stderr
+}
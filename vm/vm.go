@@ -1,7 +1,14 @@
 package vm
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
 
 	"protiumx.dev/simia/code"
 	"protiumx.dev/simia/compiler"
@@ -15,40 +22,135 @@ const (
 )
 
 var (
-	True  = &value.Boolean{Value: true}
-	False = &value.Boolean{Value: false}
-	Nil   = &value.Nil{}
+	True  = value.TRUE
+	False = value.FALSE
+	Nil   = value.NIL
 )
 
 type VM struct {
 	constants   []value.Value
+	names       map[string]int
 	globals     []value.Value
 	stack       []value.Value
 	frames      []*Frame
 	framesIndex int
 	sp          int // Stack pointer points to next free slot in stack
+	rand        *rand.Rand
+	permissions value.Permissions
+	stdin       *bufio.Reader
+	stdout      io.Writer
+	stderr      io.Writer
+	limits      value.Limits
+	budget      *value.Budget
+	// aborted is the error passed to Runtime.Abort by a builtin
+	aborted error
+	hook    LineHook
+	// fatalErrors stops the run when a builtin returns an error value
+	fatalErrors bool
 }
 
-func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &value.CompiledFunction{Instructions: bytecode.Instructions}
-	mainClosure := &value.Closure{Fn: mainFn}
-	mainFrame := NewFrame(mainClosure, 0)
+type Option func(*VM)
+
+// WithSeed makes builtins that use randomness reproducible
+func WithSeed(seed int64) Option {
+	return func(vm *VM) {
+		vm.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithPermissions grants capabilities to the script. By default none are granted
+func WithPermissions(p value.Permissions) Option {
+	return func(vm *VM) {
+		vm.permissions = p
+	}
+}
+
+// WithStdin sets the input read by `read_line`. Defaults to os.Stdin
+func WithStdin(r io.Reader) Option {
+	return func(vm *VM) {
+		vm.stdin = bufio.NewReader(r)
+	}
+}
+
+// WithStdout sets the writer used by `log`. Defaults to os.Stdout
+func WithStdout(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.stdout = w
+	}
+}
+
+// WithStderr sets the writer used by `log_error`. Defaults to os.Stderr
+func WithStderr(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.stderr = w
+	}
+}
+
+// WithLimits bounds the steps, call depth and time used by each run
+func WithLimits(l value.Limits) Option {
+	return func(vm *VM) {
+		vm.limits = l
+	}
+}
+
+// WithFatalErrors stops the run with an error when a builtin returns an error value,
+// which is how the evaluator runs scripts. By default error values are pushed like any
+// other result and dropped by expression statements
+func WithFatalErrors() Option {
+	return func(vm *VM) {
+		vm.fatalErrors = true
+	}
+}
 
-	frames := make([]*Frame, MaxFrames)
-	frames[0] = mainFrame
-	return &VM{
-		constants:   bytecode.Constants,
-		globals:     make([]value.Value, GlobalsSize),
-		stack:       make([]value.Value, StackSize),
-		frames:      frames,
-		framesIndex: 1,
-		sp:          0,
+// WithInitialGlobals copies values to the start of the global store when the VM is
+// created or taken from a Pool, e.g. the store returned by prelude.Globals
+func WithInitialGlobals(values []value.Value) Option {
+	return func(vm *VM) {
+		copy(vm.globals, values)
 	}
 }
 
-func NewWithGlobalStore(bytecode *compiler.Bytecode, s []value.Value) *VM {
-	vm := New(bytecode)
-	vm.globals = s
+// New creates a VM to run the bytecode. The bytecode is never modified, so the same
+// bytecode can be run by many VMs concurrently
+func New(bytecode *compiler.Bytecode, opts ...Option) *VM {
+	return NewWithGlobalStore(bytecode, make([]value.Value, GlobalsSize), opts...)
+}
+
+// reset prepares the VM to run the bytecode from the start with the default settings
+func (vm *VM) reset(bytecode *compiler.Bytecode, opts ...Option) {
+	mainFn := &value.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
+	mainClosure := &value.Closure{Fn: mainFn}
+	vm.frames[0] = NewFrame(mainClosure, 0)
+
+	vm.constants = bytecode.Constants
+	vm.names = bytecode.Globals
+	vm.framesIndex = 1
+	vm.sp = 0
+	vm.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	vm.permissions = value.PermNone
+	vm.stdin = bufio.NewReader(os.Stdin)
+	vm.stdout = os.Stdout
+	vm.stderr = os.Stderr
+	vm.limits = value.Limits{}
+	vm.budget = nil
+	vm.hook = nil
+	vm.fatalErrors = false
+
+	for _, opt := range opts {
+		opt(vm)
+	}
+}
+
+// NewWithGlobalStore creates a VM that reads and writes globals in s, which lets
+// successive programs share state. VMs sharing a store must not run concurrently
+func NewWithGlobalStore(bytecode *compiler.Bytecode, s []value.Value, opts ...Option) *VM {
+	vm := &VM{
+		globals: s,
+		stack:   make([]value.Value, StackSize),
+		frames:  make([]*Frame, MaxFrames),
+	}
+	vm.reset(bytecode, opts...)
+
 	return vm
 }
 
@@ -61,17 +163,39 @@ func (vm *VM) StackTop() value.Value {
 }
 
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program until it finishes, a limit is exceeded or ctx is done
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.budget, vm.aborted = value.NewBudget(ctx, vm.limits), nil
+	return vm.run(0)
+}
+
+// run executes instructions until the main frame is exhausted or the frame stack
+// drops to depth, which is how re-entrant calls return to their caller
+func (vm *VM) run(depth int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if err := vm.budget.Step(); err != nil {
+			return err
+		}
+
 		currentFrame := vm.currentFrame()
 		currentFrame.ip++
 		ip = currentFrame.ip
 		ins = currentFrame.Instructions()
 		op = code.Opcode(ins[ip])
 
+		if vm.hook != nil {
+			if err := vm.reportLine(currentFrame, ip); err != nil {
+				return err
+			}
+		}
+
 		switch op {
 		case code.OpConstant:
 			idx := code.ReadUint16(ins[ip+1:])
@@ -237,9 +361,12 @@ func (vm *VM) Run() error {
 			index := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
-			definition := value.Builtins[index]
+			builtin := value.GetBuiltinByIndex(int(index))
+			if builtin == nil {
+				return fmt.Errorf("undefined builtin %d", index)
+			}
 
-			err := vm.push(definition.Builtin)
+			err := vm.push(builtin)
 			if err != nil {
 				return err
 			}
@@ -265,6 +392,32 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			gIndex := code.ReadUint16(ins[ip+3:])
+			currentFrame.ip += 4
+
+			// modules run once, the first time they are imported
+			exports := vm.globals[gIndex]
+			if exports == nil {
+				fn, ok := vm.constants[constIndex].(*value.CompiledFunction)
+				if !ok {
+					return fmt.Errorf("not a module: %+v", vm.constants[constIndex])
+				}
+
+				var err error
+				exports, err = vm.call(&value.Closure{Fn: fn})
+				if err != nil {
+					return err
+				}
+				vm.globals[gIndex] = exports
+			}
+
+			err := vm.push(exports)
+			if err != nil {
+				return err
+			}
+
 		case code.OpCurrentClosure:
 			cl := vm.currentFrame().cl
 			err := vm.push(cl)
@@ -292,8 +445,15 @@ func (vm *VM) executeCall(argsCount int) error {
 
 func (vm *VM) callBuiltin(builtin *value.Builtin, argsCount int) error {
 	args := vm.stack[vm.sp-argsCount : vm.sp]
-	result := builtin.Fn(args...)
+	result := builtin.Call(&runtime{vm}, args...)
 	vm.sp = vm.sp - argsCount - 1
+	if vm.aborted != nil {
+		return vm.aborted
+	}
+
+	if errVal, ok := result.(*value.Error); ok && vm.fatalErrors {
+		return errors.New(errVal.Message)
+	}
 
 	if result != nil {
 		vm.push(result)
@@ -309,13 +469,95 @@ func (vm *VM) callFunction(cl *value.Closure, argsCount int) error {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.ArgumentsCount, argsCount)
 	}
 
+	// the main frame takes one of the MaxFrames slots
+	if vm.framesIndex >= MaxFrames {
+		return &value.LimitError{Kind: value.CallDepthLimit, Limit: MaxFrames - 1}
+	}
+
+	if err := vm.budget.CheckDepth(vm.framesIndex); err != nil {
+		return err
+	}
+
 	frame := NewFrame(cl, vm.sp-argsCount)
 	vm.pushFrame(frame)
 	// create space for function locals
 	vm.sp = frame.basePointer + cl.Fn.LocalsCount
+	if vm.hook != nil {
+		// locals that are not defined yet are not listed with stale values
+		for i := frame.basePointer + argsCount; i < vm.sp; i++ {
+			vm.stack[i] = nil
+		}
+	}
 	return nil
 }
 
+// Call invokes a closure or builtin produced by the program and returns its result.
+// It is meant to be used once Run has returned, reusing the globals of the program
+func (vm *VM) Call(fn value.Value, args ...value.Value) (value.Value, error) {
+	return vm.CallContext(context.Background(), fn, args...)
+}
+
+// CallContext is like Call but the limits of the VM apply to this call and ctx can cancel it
+func (vm *VM) CallContext(ctx context.Context, fn value.Value, args ...value.Value) (value.Value, error) {
+	switch fn.(type) {
+	case *value.Closure, *value.Builtin:
+		vm.budget, vm.aborted = value.NewBudget(ctx, vm.limits), nil
+		return vm.call(fn, args...)
+	default:
+		return nil, fmt.Errorf("calling non-function")
+	}
+}
+
+// Global returns the value bound to a global name
+func (vm *VM) Global(name string) (value.Value, bool) {
+	idx, ok := vm.names[name]
+	if !ok || vm.globals[idx] == nil {
+		return nil, false
+	}
+
+	return vm.globals[idx], true
+}
+
+// SetGlobal binds val to a global name of the program. It returns false when the name is unknown
+func (vm *VM) SetGlobal(name string, val value.Value) bool {
+	idx, ok := vm.names[name]
+	if ok {
+		vm.globals[idx] = val
+	}
+
+	return ok
+}
+
+// call invokes fn on top of the current stack and runs it to completion
+func (vm *VM) call(fn value.Value, args ...value.Value) (value.Value, error) {
+	sp, depth := vm.sp, vm.framesIndex
+
+	err := vm.push(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args {
+		err := vm.push(arg)
+		if err != nil {
+			vm.sp = sp
+			return nil, err
+		}
+	}
+
+	err = vm.executeCall(len(args))
+	if err == nil {
+		err = vm.run(depth)
+	}
+
+	if err != nil {
+		vm.sp, vm.framesIndex = sp, depth
+		return nil, err
+	}
+
+	return vm.pop(), nil
+}
+
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
@@ -476,6 +718,12 @@ func (vm *VM) execIndexExpression(left, index value.Value) error {
 		return vm.execArrayIndex(left, index)
 	case left.Type() == value.HASH_VALUE && index.Type() == value.STRING_VALUE:
 		return vm.execHashIndex(left, index)
+	case left.Type() == value.HOST_VALUE && index.Type() == value.STRING_VALUE:
+		member, err := left.(*value.HostObject).Member(index.(*value.String).Value)
+		if err != nil {
+			return err
+		}
+		return vm.push(member)
 	default:
 		return fmt.Errorf("index operator not supported: %s", left.Type())
 	}
@@ -1,12 +1,21 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"protiumx.dev/simia/ast"
 	"protiumx.dev/simia/compiler"
 	"protiumx.dev/simia/lexer"
+	"protiumx.dev/simia/module"
 	"protiumx.dev/simia/parser"
 	"protiumx.dev/simia/value"
 )
@@ -77,6 +86,25 @@ func testExpectedValue(t *testing.T, expected any, actual value.Value) {
 		if err != nil {
 			t.Errorf("test string value failed: %s", err)
 		}
+	case []string:
+		arr, ok := actual.(*value.Array)
+		if !ok {
+			t.Errorf("value is not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(arr.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(arr.Elements))
+			return
+		}
+
+		for i, expElement := range expected {
+			err := testStringValue(expElement, arr.Elements[i])
+			if err != nil {
+				t.Errorf("testStringValue failed: %s", err)
+			}
+		}
+
 	case []int:
 		arr, ok := actual.(*value.Array)
 		if !ok {
@@ -456,12 +484,165 @@ func TestBuiltinFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{`len("")`, 0},
 		{`len("1234")`, 4},
-		{`len(0)`, &value.Error{Message: "argument to `len` not supported, got INTEGER"}},
+		{`len(0)`, &value.Error{Message: "argument to `len` must be STRING or ARRAY or HASH, got INTEGER"}},
 		{`len(1,2)`, &value.Error{Message: "wrong number of arguments. got=2, want=1"}},
 		{`len([1])`, 1},
 		{`log("test")`, Nil},
 		{`append([], 1)`, []int{1}},
-		{`append(1, 1)`, &value.Error{Message: "argument must be ARRAY, got INTEGER"}},
+		{`append(1, 1)`, &value.Error{Message: "argument to `append` must be ARRAY, got INTEGER"}},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int{3, 4}},
+		{`reduce([1, 2, 3], fn(acc, x) { acc + x }, 0)`, 6},
+		{`sort_by([3, 1, 2], fn(x) { 0 - x })`, []int{3, 2, 1}},
+		{`let add = fn(a) { fn(b) { a + b } }; map([1, 2], add(10))`, []int{11, 12}},
+		{`[1, 2, 3] |> map(fn(x) { x * x }) |> filter(fn(x) { x > 1 })`, []int{4, 9}},
+		{`map([[1], [1, 2]], len)`, []int{1, 2}},
+		{`map([1], fn(a, b) { a })`, &value.Error{Message: "wrong number of arguments: want=2, got=1"}},
+		{`let f = fn(x) { map([x], fn(y) { y + x }) }; map([1, 2], f)[1][0]`, 4},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`keys({"b": 1, "a": 2})`, []string{"a", "b"}},
+		{`values({"b": 1, "a": 2})`, []int{2, 1}},
+		{`entries({"a": 1})[0][0]`, "a"},
+		{`has({"a": 1}, "a")`, true},
+		{`!has({"a": 1}, "b")`, true},
+		{`get({"a": 1}, "b", 0)`, 0},
+		{`delete({"a": 1, "b": 2}, "a")`, map[string]int64{"b": 2}},
+		{`let h = {"a": 1}; delete(h, "a"); h`, map[string]int64{"a": 1}},
+		{`merge({"a": 1, "b": 1}, {"b": 2})`, map[string]int64{"a": 1, "b": 2}},
+		{`len({"a": 1})`, 1},
+		{`merge({}, 1)`, &value.Error{Message: "argument to `merge` must be HASH, got INTEGER"}},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`abs(-3)`, 3},
+		{`min(3, 1, 2)`, 1},
+		{`max([3, 5, 2])`, 5},
+		{`pow(3, 3)`, 27},
+		{`clamp(15, 0, 10)`, 10},
+		{`sqrt(16)`, 4},
+		{`rand_int(3, 4)`, 3},
+		{`rand_int(-9223372036854775807, 9223372036854775807) < 9223372036854775807`, true},
+		{`rand_int(-9223372036854775807 - 1, 9223372036854775807) < 9223372036854775807`, true},
+		{`rand_int(-9223372036854775807 - 1, -9223372036854775807)`, math.MinInt64},
+		{`pow(-2, 63)`, math.MinInt64},
+		{`pow(2, 64)`, &value.Error{Message: "integer overflow in `pow`: 2 ** 64"}},
+		{`abs(-9223372036854775807 - 1)`, &value.Error{Message: "integer overflow in `abs`: -9223372036854775808"}},
+		{`clamp(1, 2, 0)`, &value.Error{Message: "invalid bounds for `clamp`: 2 > 0"}},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestSeededRandom(t *testing.T) {
+	program := parse(`[rand_int(0, 1000), rand_int(0, 1000), shuffle([1, 2, 3, 4, 5])]`)
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	results := make([]string, 2)
+	for i := range results {
+		vm := New(comp.Bytecode(), WithSeed(42))
+		err := vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		results[i] = vm.LastPoppedStackElement().Inspect()
+	}
+
+	if results[0] != results[1] {
+		t.Errorf("seeded runs differ. first=%q, second=%q", results[0], results[1])
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`json_encode({"b": [1, true], "a": "x"})`, `{"a":"x","b":[1,true]}`},
+		{`json_decode(json_encode({"a": 1, "b": 2}))`, map[string]int64{"a": 1, "b": 2}},
+		{`json_decode(json_encode([1, 2]))`, []int{1, 2}},
+		{`json_encode(fn() {})`, &value.Error{Message: "json_encode: unsupported type CLOSURE at $"}},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestTypeBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`type(1)`, "int"},
+		{`type(fn() {})`, "fn"},
+		{`str(12) + "!"`, "12!"},
+		{`int("42") + 1`, 43},
+		{`bool(1)`, true},
+		{`is_array([])`, true},
+		{`is_bool(1)`, false},
+		{`int("abc")`, &value.Error{Message: `cannot convert "abc" to int: invalid syntax`}},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestHostBuiltins(t *testing.T) {
+	tests := []struct {
+		input       string
+		permissions value.Permissions
+		expected    any
+	}{
+		{`read_line()`, value.PermNone, &value.Error{Message: "permission denied: `read_line` requires the stdin capability"}},
+		{`[read_line(), read_line()]`, value.PermStdin, []string{"first", "second"}},
+		{`list_dir("/")`, value.PermReadFile, &value.Error{Message: "permission denied: `list_dir` requires the list_dir capability"}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode(), WithPermissions(tt.permissions), WithStdin(strings.NewReader("first\nsecond\n")))
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedValue(t, tt.expected, vm.LastPoppedStackElement())
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	err := value.RegisterBuiltin(&value.Builtin{
+		Name:   "vm_twice",
+		Params: []value.Param{{Name: "n", Types: []value.ValueType{value.INTEGER_VALUE}}},
+		Fn: func(_ value.Runtime, args ...value.Value) value.Value {
+			return &value.Integer{Value: args[0].(*value.Integer).Value * 2}
+		},
+	})
+	if err != nil {
+		t.Fatalf("register error: %s", err)
+	}
+
+	tests := []vmTestCase{
+		{`vm_twice(21)`, 42},
+		{`fn(x) { vm_twice(x) }(2)`, 4},
+		{`vm_twice("a")`, &value.Error{Message: "argument to `vm_twice` must be INTEGER, got STRING"}},
 	}
 
 	runVMTests(t, tests)
@@ -553,3 +734,622 @@ func TestRecursiveClosure(t *testing.T) {
 
 	runVMTests(t, tests)
 }
+
+func TestCall(t *testing.T) {
+	program := parse(`
+	let count = 0;
+	let prefix = "event: ";
+	let handle = fn(event) { prefix + event["name"] };
+	let twice = fn(f, x) { f(f(x)) };
+	`)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	handle, ok := vm.Global("handle")
+	if !ok {
+		t.Fatal("global handle not found")
+	}
+
+	for _, name := range []string{"click", "scroll"} {
+		event := &value.Hash{Pairs: map[string]value.Value{"name": &value.String{Value: name}}}
+		result, err := vm.Call(handle, event)
+		if err != nil {
+			t.Fatalf("call error: %s", err)
+		}
+		testExpectedValue(t, "event: "+name, result)
+	}
+
+	twice, _ := vm.Global("twice")
+	appendFn := value.GetBuiltinByName("append")
+	result, err := vm.Call(twice, &value.Closure{Fn: &value.CompiledFunction{}}, &value.Integer{Value: 1})
+	if err == nil {
+		t.Errorf("expected error calling a closure with the wrong number of arguments, got %s", result.Inspect())
+	}
+
+	result, err = vm.Call(appendFn, &value.Array{Elements: []value.Value{}}, &value.Integer{Value: 1})
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	testExpectedValue(t, []int{1}, result)
+
+	count, ok := vm.Global("count")
+	if !ok {
+		t.Fatal("global count not found")
+	}
+	testExpectedValue(t, 0, count)
+
+	if _, ok := vm.Global("missing"); ok {
+		t.Error("expected missing global not to be found")
+	}
+
+	if _, err := vm.Call(count); err == nil {
+		t.Error("expected error calling a non-function")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   value.Limits
+		expected value.LimitKind
+	}{
+		{"let f = fn() { f() }; f()", value.Limits{}, value.CallDepthLimit},
+		{"let f = fn(x) { f(x + 1) }; f(0)", value.Limits{MaxCallDepth: 10}, value.CallDepthLimit},
+		{"let f = fn(x) { if (x == 0) { 0 } else { f(x - 1) } }; f(100)", value.Limits{MaxSteps: 50}, value.StepLimit},
+		// the error returned to `map` by the callback must not be swallowed
+		{"map([1, 2, 3, 4, 5, 6, 7, 8], fn(x) { x * 2 }); 1", value.Limits{MaxSteps: 20}, value.StepLimit},
+		{"let f = fn(x) { f(x) }; map([1], f); 5", value.Limits{MaxCallDepth: 10}, value.CallDepthLimit},
+		{"let f = fn(x) { f(x) }; map([1], f)", value.Limits{MaxCallDepth: 10}, value.CallDepthLimit},
+		{"let f = fn(x) { if (x == 0) { 0 } else { f(x - 1) } }; f(100)", value.Limits{Timeout: time.Nanosecond}, value.TimeLimit},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode(), WithLimits(tt.limits)).Run()
+		var limitErr *value.LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("expected *value.LimitError for %q, got %v", tt.input, err)
+			continue
+		}
+
+		if limitErr.Kind != tt.expected {
+			t.Errorf("wrong limit for %q. want=%d, got=%d (%s)", tt.input, tt.expected, limitErr.Kind, limitErr)
+		}
+	}
+
+	comp := compiler.New()
+	comp.Compile(parse("let f = fn(x) { if (x == 0) { 0 } else { f(x - 1) } }; f(10)"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := New(comp.Bytecode()).RunContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// the limits apply to each call separately
+	vm := New(comp.Bytecode(), WithLimits(value.Limits{MaxSteps: 200}))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	f, _ := vm.Global("f")
+	for i := 0; i < 3; i++ {
+		result, err := vm.Call(f, &value.Integer{Value: 5})
+		if err != nil {
+			t.Fatalf("call error: %s", err)
+		}
+		testExpectedValue(t, 0, result)
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input string
+		// expected is the message of the assertion error, empty when the assertions pass
+		expected string
+	}{
+		{"assert(1 == 1); assert_eq([1, {\"a\": 2}], [1, {\"a\": 2}]); 1", ""},
+		{"assert(1 > 2); 1", "assertion failed"},
+		{`assert(false, "setup"); 1`, "setup: assertion failed"},
+		{"assert_eq([1, 2, 3], [1, 5, 3]); 1", "values are not equal\nexpected: [1, 5, 3]\n  actual: [1, 2, 3]\n              ^"},
+		{`assert_eq(1, "1"); 1`, "values are not equal\nexpected: 1 (string)\n  actual: 1 (int)"},
+		{"map([1, 2], fn(x) { assert(x < 2) }); 1", "assertion failed"},
+		{`assert_eq(assert_error(fn() { len(1) }, "must be"), "argument to ` + "`len`" + ` must be STRING or ARRAY or HASH, got INTEGER"); 1`, ""},
+		{"assert_error(fn() { 1 }); 1", "expected an error, got 1"},
+		{`assert_error(fn() { len(1) }, "oops"); 1`, `expected an error containing "oops", got "argument to ` + "`len`" + ` must be STRING or ARRAY or HASH, got INTEGER"`},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+
+		var assertErr *value.AssertionError
+		if !errors.As(err, &assertErr) {
+			t.Errorf("expected *value.AssertionError for %q, got %v", tt.input, err)
+			continue
+		}
+
+		if assertErr.Message != tt.expected {
+			t.Errorf("wrong message for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, assertErr.Message)
+		}
+	}
+}
+
+func TestFatalErrors(t *testing.T) {
+	lenError := "argument to `len` must be STRING or ARRAY or HASH, got INTEGER"
+	tests := []struct {
+		input string
+		// expected is the message of the run error, empty when the run succeeds
+		expected string
+	}{
+		{"len(1); 2", lenError},
+		{"let x = len(1); 2", lenError},
+		{"map([1], fn(x) { len(x) }); 2", lenError},
+		{"assert_error(fn() { len(1) }); 2", ""},
+		{"len([1]); 2", ""},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		// error values are dropped by default
+		if err := New(comp.Bytecode()).Run(); err != nil {
+			t.Errorf("unexpected error for %q without WithFatalErrors: %s", tt.input, err)
+		}
+
+		err := New(comp.Bytecode(), WithFatalErrors()).Run()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.input, err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`log("hello", 1, [true]); log_error("oops"); each([1, 2], fn(x) { log(x) })`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var stdout, stderr strings.Builder
+	if err := New(comp.Bytecode(), WithStdout(&stdout), WithStderr(&stderr)).Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if expected := "hello\n1\n[true]\n1\n2\n"; stdout.String() != expected {
+		t.Errorf("wrong stdout. want=%q, got=%q", expected, stdout.String())
+	}
+
+	if expected := "oops\n"; stderr.String() != expected {
+		t.Errorf("wrong stderr. want=%q, got=%q", expected, stderr.String())
+	}
+}
+
+func TestPoolConcurrentRuns(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`
+	let counter = fn(start) { fn(x) { start + x } };
+	let add = counter(10);
+	let doubled = map([1, 2, 3], fn(x) { add(x) * 2 });
+	let totals = {"sum": reduce(doubled, fn(acc, x) { acc + x }, 0), "name": "pool"};
+	[totals["sum"], totals["name"] + "!", 1 < 2]
+	`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+	pool := NewPool(bytecode, WithLimits(value.Limits{MaxSteps: 10_000}))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				vm := pool.Get()
+				if err := vm.Run(); err != nil {
+					errs <- err
+					return
+				}
+
+				if result := vm.LastPoppedStackElement().Inspect(); result != "[72, pool!, true]" {
+					errs <- fmt.Errorf("wrong result %s", result)
+					return
+				}
+				pool.Put(vm)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// a VM taken from the pool does not see the globals of previous runs
+	vm := pool.Get()
+	if _, ok := vm.Global("add"); ok {
+		t.Error("expected globals to be cleared")
+	}
+}
+
+func TestInitialGlobals(t *testing.T) {
+	symbols := compiler.NewSymbolTable()
+	symbols.Define("x")
+	comp := compiler.NewWithState(symbols, []value.Value{})
+	if err := comp.Compile(parse("let y = x + 1; y")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	initial := WithInitialGlobals([]value.Value{&value.Integer{Value: 41}})
+
+	store := make([]value.Value, GlobalsSize)
+	vm := NewWithGlobalStore(comp.Bytecode(), store, initial)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	for _, result := range []value.Value{vm.LastPoppedStackElement(), store[1]} {
+		if err := testIntegerValue(42, result); err != nil {
+			t.Error(err)
+		}
+	}
+
+	pool := NewPool(comp.Bytecode(), initial)
+	for i := 0; i < 2; i++ {
+		vm := pool.Get()
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if err := testIntegerValue(42, vm.LastPoppedStackElement()); err != nil {
+			t.Error(err)
+		}
+		pool.Put(vm)
+	}
+}
+
+type account struct {
+	Owner   string
+	Balance int
+	Pin     int
+	Manager *account
+	secret  string
+}
+
+func (a *account) Deposit(amount int) (int, error) {
+	if amount <= 0 {
+		return 0, fmt.Errorf("invalid amount %d", amount)
+	}
+	a.Balance += amount
+	return a.Balance, nil
+}
+
+func (a *account) Tags(prefix string, names ...string) []string {
+	tags := make([]string, len(names))
+	for i, name := range names {
+		tags[i] = prefix + name
+	}
+	return tags
+}
+
+func (a *account) Close() {}
+
+func (a *account) Boss() *account {
+	return a.Manager
+}
+
+var accountClass = &value.HostClass{
+	Name:    "Account",
+	Fields:  []string{"Owner", "Balance", "Manager"},
+	Methods: []string{"Deposit", "Tags", "Boss"},
+	Accessors: map[string]func(obj any) value.Value{
+		"display": func(obj any) value.Value {
+			return &value.String{Value: "account of " + obj.(*account).Owner}
+		},
+	},
+}
+
+func init() {
+	accountClass.Classes = map[string]*value.HostClass{"Manager": accountClass, "Boss": accountClass}
+}
+
+// newAccount returns an account whose manager manages itself
+func newAccount() *account {
+	boss := &account{Owner: "bob", Pin: 1234}
+	boss.Manager = boss
+	return &account{Owner: "ana", Balance: 10, Manager: boss, secret: "x"}
+}
+
+func TestHostObjects(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`acc["Owner"]`, "ana"},
+		{`acc["display"]`, "account of ana"},
+		{`acc["Deposit"](5)`, "15"},
+		{`let deposit = acc["Deposit"]; deposit(1); acc["Balance"]`, "11"},
+		{`acc["Tags"]("#", "a", "b")`, "[#a, #b]"},
+		{`acc["Tags"]("#")`, "[]"},
+		{`acc["Deposit"](0)`, "ERROR: Account.Deposit: invalid amount 0"},
+		{`acc["Deposit"]("a")`, "ERROR: argument 1 to `Account.Deposit`: cannot use STRING as int"},
+		{`acc["Deposit"]()`, "ERROR: wrong number of arguments. got=0, want=1"},
+		{`type(acc)`, "host"},
+		{`acc`, "<Account>"},
+		{`acc["Manager"]`, "<Account>"},
+		{`acc["Manager"]["Manager"]["Owner"]`, "bob"},
+		{`acc["Boss"]()["Boss"]()["Owner"]`, "bob"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewWithState(hostSymbols(), []value.Value{})
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		globals := make([]value.Value, GlobalsSize)
+		globals[0] = value.NewHostObject(newAccount(), accountClass)
+
+		vm := NewWithGlobalStore(comp.Bytecode(), globals)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		if result := vm.LastPoppedStackElement().Inspect(); result != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+
+	for _, input := range []string{`acc["secret"]`, `acc["Close"]`, `acc["Pin"]`, `acc["Manager"]["Pin"]`} {
+		comp := compiler.NewWithState(hostSymbols(), []value.Value{})
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		globals := make([]value.Value, GlobalsSize)
+		globals[0] = value.NewHostObject(newAccount(), accountClass)
+
+		err := NewWithGlobalStore(comp.Bytecode(), globals).Run()
+		if err == nil || !strings.Contains(err.Error(), "Account has no member") {
+			t.Errorf("expected member error for %q, got %v", input, err)
+		}
+	}
+	// structs reached through members without a class are not converted to hashes
+	bare := &value.HostClass{Name: "Account", Fields: []string{"Manager"}, Methods: []string{"Boss"}}
+	for _, input := range []string{`acc["Manager"]`, `acc["Boss"]()`} {
+		comp := compiler.NewWithState(hostSymbols(), []value.Value{})
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		globals := make([]value.Value, GlobalsSize)
+		globals[0] = value.NewHostObject(newAccount(), bare)
+
+		vm := NewWithGlobalStore(comp.Bytecode(), globals)
+		err := vm.Run()
+		if err == nil {
+			err = fmt.Errorf("%s", vm.LastPoppedStackElement().Inspect())
+		}
+		if !strings.Contains(err.Error(), "struct *vm.account has no class") {
+			t.Errorf("expected a class error for %q, got %v", input, err)
+		}
+	}
+}
+
+// hostSymbols defines the builtins and the `acc` global at index 0
+func hostSymbols() *compiler.SymbolTable {
+	symbols := compiler.NewSymbolTable()
+	for i, b := range value.Builtins() {
+		symbols.DefineBuiltin(i, b.Name)
+	}
+	symbols.Define("acc")
+	return symbols
+}
+
+var testModules = module.MapResolver{
+	"lib/strings": `
+	let sep = ", ";
+	export let join = fn(items) {
+		reduce(items, fn(acc, s) { if (len(acc) == 0) { s } else { acc + sep + s } }, "")
+	};
+	export let shout = fn(s) { s + "!" };
+	`,
+	"lib/counter": `
+	import "lib/strings";
+	log("loading counter");
+	export let label = fn(n) { strings["shout"]("count " + str(n)) };
+	`,
+	"cycle/a": `import "cycle/b"; export let x = 1;`,
+	"cycle/b": `import "cycle/a"; export let y = 2;`,
+}
+
+func TestImports(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/strings"; strings["join"](["a", "b", "c"])`, "a, b, c"},
+		{`import "lib/strings" as s; s["shout"]("hey")`, "hey!"},
+		{`import "lib/strings"; strings["sep"]`, "nil"},
+		{`import "lib/counter"; import "lib/counter" as again; let f = fn() { again["label"](2) }; f()`, "count 2!"},
+		{`let f = fn() { import "lib/strings"; strings["shout"]("in fn") }; f()`, "in fn!"},
+		{`import "lib/strings"; keys(strings)`, "[join, shout]"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New(compiler.WithResolver(testModules))
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error for %q: %s", tt.input, err)
+		}
+
+		var out strings.Builder
+		vm := New(comp.Bytecode(), WithStdout(&out))
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		if result := vm.LastPoppedStackElement().Inspect(); result != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+
+		// modules run once
+		if strings.Count(out.String(), "loading counter") > 1 {
+			t.Errorf("module ran more than once for %q", tt.input)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		resolver module.Resolver
+		expected string
+	}{
+		{`import "cycle/a"`, testModules, "import cycle: cycle/a -> cycle/b -> cycle/a"},
+		{`import "lib/missing"`, testModules, `module "lib/missing" not found`},
+		{`import "lib/strings"; sep`, testModules, "undefined variable sep"},
+		{`let x = 1; import "lib/x"`, module.MapResolver{"lib/x": "x"}, `module "lib/x": undefined variable x`},
+		{`import "lib/strings"`, nil, "no module resolver configured"},
+	}
+
+	for _, tt := range errorTests {
+		comp := compiler.New(compiler.WithResolver(tt.resolver))
+		err := comp.Compile(parse(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error %q for %q, got %v", tt.expected, tt.input, err)
+		}
+	}
+}
+
+func TestDecodedBytecode(t *testing.T) {
+	input := `
+	import "lib/strings";
+	let makeAdder = fn(a) { fn(b) { a + b } };
+	let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+	[makeAdder(2)(fib(10)), strings["shout"]("saved"), {"k": -1}]
+	`
+	comp := compiler.New(compiler.WithResolver(testModules))
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, comp.Bytecode()); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	decoded, err := compiler.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	vm := New(decoded)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	expected := "[57, saved!, {k: -1}]"
+	if result := vm.LastPoppedStackElement().Inspect(); result != expected {
+		t.Errorf("wrong result. want=%q, got=%q", expected, result)
+	}
+}
+
+func TestLineHook(t *testing.T) {
+	input := `let base = 10;
+let add = fn(a, b) {
+  let sum = a + b;
+  let total = sum + base;
+  total
+};
+import "lib/strings";
+let result = add(1,
+  2);
+result`
+	comp := compiler.New(compiler.WithResolver(testModules))
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var events []string
+	var stack []StackFrame
+	var locals, globals []Variable
+	hook := func(vm *VM, file string, line int) error {
+		events = append(events, fmt.Sprintf("%s:%d@%d", file, line, vm.Depth()))
+		if file == "" && line == 4 {
+			stack, locals, globals = vm.Frames(), vm.Locals(0), vm.Globals()
+		}
+		return nil
+	}
+
+	vm := New(comp.Bytecode(), WithLineHook(hook))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// the call spans lines 8 and 9, the frame reports line 8 again when the call runs
+	expectedEvents := []string{":1@1", ":2@1", ":7@1", "lib/strings:2@2", "lib/strings:3@2", "lib/strings:6@2", ":8@1", ":9@1", ":8@1", ":3@2", ":4@2", ":5@2", ":10@1"}
+	if strings.Join(events, " ") != strings.Join(expectedEvents, " ") {
+		t.Errorf("wrong events.\nwant=%v\ngot= %v", expectedEvents, events)
+	}
+
+	expectedStack := []StackFrame{{Function: "add", Line: 4}, {Line: 8}}
+	if !reflect.DeepEqual(stack, expectedStack) {
+		t.Errorf("wrong stack.\nwant=%+v\ngot= %+v", expectedStack, stack)
+	}
+
+	// total is not defined yet
+	if got := inspectVariables(locals); got != "a=1 b=2 sum=3" {
+		t.Errorf("wrong locals %q", got)
+	}
+	if got := inspectVariables(globals); !strings.HasPrefix(got, "base=10 add=Closure") || !strings.Contains(got, "strings={") {
+		t.Errorf("wrong globals %q", got)
+	}
+
+	stop := errors.New("stopped")
+	vm = New(comp.Bytecode(), WithLineHook(func(vm *VM, file string, line int) error {
+		if line == 3 {
+			return stop
+		}
+		return nil
+	}))
+	if err := vm.Run(); err != stop {
+		t.Errorf("expected the hook error, got %v", err)
+	}
+}
+
+func inspectVariables(vars []Variable) string {
+	parts := make([]string, len(vars))
+	for i, v := range vars {
+		parts[i] = v.Name + "=" + v.Value.Inspect()
+	}
+	return strings.Join(parts, " ")
+}